@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mattdennewitz/mcpmydocs/internal/store"
+)
+
+var cacheGCUnusedFor time.Duration
+
+// NewCacheCmd creates the cache command and its subcommands.
+func NewCacheCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the embedding cache",
+	}
+
+	gc := &cobra.Command{
+		Use:   "gc",
+		Short: "Remove cached embeddings that no indexed document uses",
+		Args:  cobra.NoArgs,
+		RunE:  runCacheGC,
+	}
+	gc.Flags().DurationVar(&cacheGCUnusedFor, "unused-for", 30*24*time.Hour, "Keep entries used more recently than this, even if no document uses them")
+
+	cmd.AddCommand(gc)
+	return cmd
+}
+
+func runCacheGC(cmd *cobra.Command, args []string) error {
+	dbPath, err := existingDBPath()
+	if err != nil {
+		return err
+	}
+
+	st, err := store.New(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer st.Close()
+
+	removed, remaining, err := st.PruneEmbeddingCache(context.Background(), cacheGCUnusedFor)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Removed %d cached embeddings (%d remaining)\n", removed, remaining)
+	return nil
+}
@@ -2,14 +2,26 @@ package cmd
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 
+	"github.com/mattdennewitz/mcpmydocs/internal/chunker"
 	"github.com/mattdennewitz/mcpmydocs/internal/embedder"
+	"github.com/mattdennewitz/mcpmydocs/internal/frontmatter"
+	"github.com/mattdennewitz/mcpmydocs/internal/ignore"
+	"github.com/mattdennewitz/mcpmydocs/internal/paths"
 	"github.com/mattdennewitz/mcpmydocs/internal/search"
 	"github.com/mattdennewitz/mcpmydocs/internal/store"
 )
@@ -104,56 +116,1402 @@ func TestNewIndexCmd(t *testing.T) {
 	if cmd.Short == "" {
 		t.Error("Short description is empty")
 	}
+	for _, name := range []string{"dry-run", "json", "force-rehash"} {
+		if cmd.Flags().Lookup(name) == nil {
+			t.Errorf("missing flag --%s", name)
+		}
+	}
+}
+
+func TestNewSearchCmd(t *testing.T) {
+	cmd := NewSearchCmd()
+	if cmd == nil {
+		t.Fatal("NewSearchCmd returned nil")
+	}
+	if cmd.Use != "search [query]" {
+		t.Errorf("unexpected Use: %s", cmd.Use)
+	}
+}
+
+func TestNewRunCmd(t *testing.T) {
+	cmd := NewRunCmd()
+	if cmd == nil {
+		t.Fatal("NewRunCmd returned nil")
+	}
+	if cmd.Use != "run" {
+		t.Errorf("unexpected Use: %s", cmd.Use)
+	}
+}
+
+func TestNewCollectionsCmd(t *testing.T) {
+	cmd := NewCollectionsCmd()
+	if cmd == nil {
+		t.Fatal("NewCollectionsCmd returned nil")
+	}
+	if cmd.Use != "collections" {
+		t.Errorf("unexpected Use: %s", cmd.Use)
+	}
+
+	names := map[string]bool{}
+	for _, sub := range cmd.Commands() {
+		names[sub.Name()] = true
+	}
+	for _, want := range []string{"list", "drop"} {
+		if !names[want] {
+			t.Errorf("missing subcommand %q", want)
+		}
+	}
+}
+
+func TestNewWatchCmd(t *testing.T) {
+	cmd := NewWatchCmd()
+	if cmd == nil {
+		t.Fatal("NewWatchCmd returned nil")
+	}
+	if cmd.Use != "watch [directory]" {
+		t.Errorf("unexpected Use: %s", cmd.Use)
+	}
+	for _, name := range []string{"collection", "include", "exclude", "debounce"} {
+		if cmd.Flags().Lookup(name) == nil {
+			t.Errorf("missing flag --%s", name)
+		}
+	}
+}
+
+func TestDirWatcherQueue(t *testing.T) {
+	root := t.TempDir()
+	subDir := filepath.Join(root, "sub")
+	if err := os.Mkdir(subDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	w := &dirWatcher{absDir: root, pending: make(map[string]struct{})}
+
+	tests := []struct {
+		name  string
+		event fsnotify.Event
+		want  bool
+	}{
+		{"markdown write", fsnotify.Event{Name: filepath.Join(root, "a.md"), Op: fsnotify.Write}, true},
+		{"other file write", fsnotify.Event{Name: filepath.Join(root, "a.txt"), Op: fsnotify.Write}, false},
+		{"chmod only", fsnotify.Event{Name: filepath.Join(root, "b.md"), Op: fsnotify.Chmod}, false},
+		{"new directory", fsnotify.Event{Name: subDir, Op: fsnotify.Create}, true},
+		{"removed path", fsnotify.Event{Name: filepath.Join(root, "gone"), Op: fsnotify.Remove}, true},
+		{"renamed path", fsnotify.Event{Name: filepath.Join(root, "old.md"), Op: fsnotify.Rename}, true},
+	}
+
+	for _, tt := range tests {
+		if got := w.queue(tt.event); got != tt.want {
+			t.Errorf("%s: queue() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if len(w.pending) != 4 {
+		t.Errorf("expected 4 pending paths, got %d", len(w.pending))
+	}
+	if w.resync {
+		t.Error("resync should not be set")
+	}
+
+	if !w.queue(fsnotify.Event{Name: filepath.Join(subDir, ".gitignore"), Op: fsnotify.Write}) {
+		t.Error("ignore file change should be queued")
+	}
+	if !w.resync {
+		t.Error("ignore file change should trigger a resync")
+	}
+}
+
+func TestDirWatcherWithStoreRetry(t *testing.T) {
+	// A directory cannot be opened as a database
+	w := &dirWatcher{dbPath: t.TempDir()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	called := false
+	err := w.withStoreRetry(ctx, func(context.Context, *store.Store) error {
+		called = true
+		return nil
+	})
+	if err != nil || called {
+		t.Errorf("expected to keep retrying until cancelled, got %v (called: %v)", err, called)
+	}
+
+	// Other errors are not retried
+	w.dbPath = filepath.Join(t.TempDir(), "test.db")
+	want := errors.New("index failed")
+	err = w.withStoreRetry(context.Background(), func(context.Context, *store.Store) error {
+		return want
+	})
+	if !errors.Is(err, want) {
+		t.Errorf("expected %v, got %v", want, err)
+	}
+}
+
+func TestDirWatcherApply_RemovesDeletedFiles(t *testing.T) {
+	cleanup, root := setupTestMCPEnvironment(t)
+	defer cleanup()
+
+	indexCollection = store.DefaultCollection
+	ctx := context.Background()
+	deleted := filepath.Join(root, "docs", "deleted.md")
+	kept := filepath.Join(root, "docs", "kept.md")
+	mcpStore.InsertDocument(ctx, deleted, "hash1", "Deleted")
+	mcpStore.InsertDocument(ctx, kept, "hash2", "Kept")
+
+	matcher, err := ignore.New(ignore.Options{})
+	if err != nil {
+		t.Fatalf("ignore.New failed: %v", err)
+	}
+
+	w := &dirWatcher{
+		absDir:  root,
+		matcher: matcher,
+		pending: map[string]struct{}{filepath.Join(root, "docs"): {}},
+	}
+	// The whole directory was removed, including kept.md
+	if err := w.apply(ctx, mcpStore); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+
+	docs, err := mcpStore.ListDocuments(ctx)
+	if err != nil {
+		t.Fatalf("ListDocuments failed: %v", err)
+	}
+	if len(docs) != 0 {
+		t.Errorf("expected documents under removed directory to be deleted, got %d", len(docs))
+	}
+	if len(w.pending) != 0 {
+		t.Errorf("expected pending paths to be cleared, got %d", len(w.pending))
+	}
+}
+
+func TestDirWatcherApply_ReloadsIgnoreFiles(t *testing.T) {
+	cleanup, root := setupTestMCPEnvironment(t)
+	defer cleanup()
+
+	indexCollection = store.DefaultCollection
+
+	ctx := context.Background()
+	os.WriteFile(filepath.Join(root, "a.md"), []byte("# A\n\nFirst.\n"), 0644)
+	os.WriteFile(filepath.Join(root, "b.md"), []byte("# B\n\nSecond.\n"), 0644)
+	matcher, _ := newIndexMatcher()
+	emb := &stubEmbedder{}
+	if _, _, err := indexDirectory(ctx, root, matcher, mcpStore, emb); err != nil {
+		t.Fatalf("indexDirectory failed: %v", err)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatalf("failed to create watcher: %v", err)
+	}
+	defer watcher.Close()
+	w := &dirWatcher{
+		absDir:  root,
+		matcher: matcher,
+		watcher: watcher,
+		emb:     emb,
+		ch:      chunker.New(),
+		pending: make(map[string]struct{}),
+	}
+
+	titles := func() string {
+		docs, _ := mcpStore.ListDocuments(ctx)
+		var titles []string
+		for _, d := range docs {
+			titles = append(titles, d.Title)
+		}
+		return strings.Join(titles, " ")
+	}
+
+	// Ignoring a file removes it
+	gitignore := filepath.Join(root, ".gitignore")
+	os.WriteFile(gitignore, []byte("b.md\n"), 0644)
+	w.queue(fsnotify.Event{Name: gitignore, Op: fsnotify.Create})
+	if err := w.apply(ctx, mcpStore); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	if got := titles(); got != "A" {
+		t.Errorf("expected the ignored file to be removed, got %q", got)
+	}
+
+	// Un-ignoring it adds it back
+	os.WriteFile(gitignore, []byte("drafts/\n"), 0644)
+	w.queue(fsnotify.Event{Name: gitignore, Op: fsnotify.Write})
+	if err := w.apply(ctx, mcpStore); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	if got := titles(); got != "A B" {
+		t.Errorf("expected the file to be indexed again, got %q", got)
+	}
+}
+
+func TestRunIndex_InvalidDirectory(t *testing.T) {
+	cmd := NewIndexCmd()
+	cmd.SetArgs([]string{"/nonexistent/path/that/does/not/exist"})
+
+	err := cmd.Execute()
+	if err == nil {
+		t.Error("expected error for nonexistent directory")
+	}
+}
+
+func TestRunIndex_NotADirectory(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "mcpmydocs-test-*.txt")
+	if err != nil {
+		t.Fatalf("failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	tmpFile.Close()
+
+	cmd := NewIndexCmd()
+	cmd.SetArgs([]string{tmpFile.Name()})
+
+	err = cmd.Execute()
+	if err == nil {
+		t.Error("expected error when path is not a directory")
+	}
+}
+
+func TestCollectMarkdownFiles(t *testing.T) {
+	root := t.TempDir()
+	for path, content := range map[string]string{
+		".gitignore":                 "node_modules/\n",
+		".mcpmydocsignore":           "CHANGELOG.md\n",
+		"guide.md":                   "# Guide",
+		"notes.txt":                  "not markdown",
+		"CHANGELOG.md":               "# Changes",
+		"node_modules/pkg/README.md": "# Package",
+		".git/description.md":        "# Git",
+		"drafts/wip.md":              "# WIP",
+		"api/.gitignore":             "*.gen.md\n!keep.gen.md\n",
+		"api/types.gen.md":           "# Generated",
+		"api/keep.gen.md":            "# Kept",
+		"api/reference.md":           "# Reference",
+	} {
+		full := filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	matcher, err := ignore.New(ignore.Options{
+		IgnoreFiles: ignore.DefaultFiles,
+		Exclude:     []string{"drafts/"},
+	})
+	if err != nil {
+		t.Fatalf("ignore.New failed: %v", err)
+	}
+
+	files := collectMarkdownFiles(root, matcher)
+
+	var got []string
+	for _, f := range files {
+		rel, _ := filepath.Rel(root, f)
+		got = append(got, filepath.ToSlash(rel))
+	}
+	want := []string{"api/keep.gen.md", "api/reference.md", "guide.md"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestIsUnderDir(t *testing.T) {
+	tests := []struct {
+		path     string
+		dir      string
+		expected bool
+	}{
+		{"/docs/a.md", "/docs", true},
+		{"/docs/sub/b.md", "/docs", true},
+		{"/docs-other/a.md", "/docs", false},
+		{"/other/a.md", "/docs", false},
+		{"/a.md", "/docs", false},
+	}
+
+	for _, tt := range tests {
+		if got := isUnderDir(tt.path, tt.dir); got != tt.expected {
+			t.Errorf("isUnderDir(%q, %q) = %v, want %v", tt.path, tt.dir, got, tt.expected)
+		}
+	}
+}
+
+func TestPruneDocuments(t *testing.T) {
+	cleanup, _ := setupTestMCPEnvironment(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	mcpStore.InsertDocument(ctx, "/docs/keep.md", "hash1", "Keep")
+	mcpStore.InsertDocument(ctx, "/docs/sub/deleted.md", "hash2", "Deleted")
+	mcpStore.InsertDocument(ctx, "/elsewhere/other.md", "hash3", "Other Root")
+	otherID, _ := mcpStore.EnsureCollection(ctx, "other")
+	mcpStore.InsertDocumentInCollection(ctx, otherID, "/docs/other-collection.md", "hash4", "Other Collection")
+
+	pruned, err := pruneDocuments(ctx, mcpStore, "/docs", store.DefaultCollection, []string{"/docs/keep.md"})
+	if err != nil {
+		t.Fatalf("pruneDocuments failed: %v", err)
+	}
+	if pruned != 1 {
+		t.Errorf("expected 1 pruned document, got %d", pruned)
+	}
+
+	docs, err := mcpStore.ListDocuments(ctx)
+	if err != nil {
+		t.Fatalf("ListDocuments failed: %v", err)
+	}
+	if len(docs) != 3 {
+		t.Fatalf("expected 3 remaining documents, got %d", len(docs))
+	}
+	for _, d := range docs {
+		if d.FilePath == "/docs/sub/deleted.md" {
+			t.Error("deleted document should have been pruned")
+		}
+	}
+}
+
+// setupTestMCPEnvironment creates a test environment for MCP handler tests.
+// stubEmbedder returns fixed embeddings, or err if set. Texts containing
+// failOn (if non-empty) also fail.
+type stubEmbedder struct {
+	err    error
+	failOn string
+
+	model string // defaults to "stub"
+
+	embedded atomic.Int32 // number of texts embedded
+}
+
+func (e *stubEmbedder) Embed(texts []string) ([][]float32, error) {
+	if e.err != nil {
+		return nil, e.err
+	}
+	e.embedded.Add(int32(len(texts)))
+	for _, text := range texts {
+		if e.failOn != "" && strings.Contains(text, e.failOn) {
+			return nil, errors.New("embedding failed")
+		}
+	}
+	out := make([][]float32, len(texts))
+	for i := range texts {
+		out[i] = make([]float32, store.EmbeddingDim)
+		out[i][0] = 1
+	}
+	return out, nil
+}
+
+func (e *stubEmbedder) CountTokens(text string) int {
+	return len(strings.Fields(text)) + 2
+}
+
+func (e *stubEmbedder) ModelID() string {
+	if e.model != "" {
+		return e.model
+	}
+	return "stub"
+}
+
+func TestProcessFile_EmbedFailureKeepsPreviousVersion(t *testing.T) {
+	cleanup, root := setupTestMCPEnvironment(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	path := filepath.Join(root, "doc.md")
+	if err := os.WriteFile(path, []byte("# Doc\n\nFirst version.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sourceID, err := mcpStore.EnsureSource(ctx, root, store.DefaultCollectionID)
+	if err != nil {
+		t.Fatalf("EnsureSource failed: %v", err)
+	}
+
+	ch := chunker.New()
+	var printMu sync.Mutex
+	stats := &indexStats{}
+	if err := processFile(ctx, path, root, sourceID, store.DefaultCollectionID, 1, mcpStore, &stubEmbedder{}, ch, stats, &printMu); err != nil {
+		t.Fatalf("processFile failed: %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("# Doc\n\nSecond version.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err = processFile(ctx, path, root, sourceID, store.DefaultCollectionID, 1, mcpStore, &stubEmbedder{err: errors.New("model crashed")}, ch, stats, &printMu)
+	if err == nil {
+		t.Fatal("expected embedding error")
+	}
+
+	query := make([]float32, store.EmbeddingDim)
+	query[0] = 1
+	results, err := mcpStore.Search(ctx, query, 10)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 1 || !strings.Contains(results[0].Content, "First version") {
+		t.Errorf("expected the first version to remain indexed, got %+v", results)
+	}
+
+	// The file must not be considered unchanged, so the next run retries it
+	content, _ := os.ReadFile(path)
+	hash := sha256.Sum256(content)
+	if mcpStore.FileUnchanged(ctx, path, hex.EncodeToString(hash[:])) {
+		t.Error("failed file should be re-indexed on the next run")
+	}
+}
+
+func TestProcessFile_SkipsUnchangedStat(t *testing.T) {
+	cleanup, root := setupTestMCPEnvironment(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	path := filepath.Join(root, "doc.md")
+	os.WriteFile(path, []byte("# Doc\n\nVersion A.\n"), 0644)
+
+	sourceID, _ := mcpStore.EnsureSource(ctx, root, store.DefaultCollectionID)
+	index := func() *indexStats {
+		stats := processFiles(root, sourceID, store.DefaultCollectionID, []string{path}, mcpStore, &stubEmbedder{}, chunker.New())
+		if len(stats.sortedFailures()) > 0 {
+			t.Fatalf("indexing failed: %v", stats.sortedFailures()[0])
+		}
+		return stats
+	}
+	index()
+
+	// Same size and modification time: the new content is not read
+	info, _ := os.Stat(path)
+	os.WriteFile(path, []byte("# Doc\n\nVersion B.\n"), 0644)
+	os.Chtimes(path, info.ModTime(), info.ModTime())
+	if stats := index(); stats.skipped.Load() != 1 {
+		t.Errorf("expected the file to be skipped by its stat, got %d skipped", stats.skipped.Load())
+	}
+
+	indexForceRehash = true
+	defer func() { indexForceRehash = false }()
+	if stats := index(); stats.indexed.Load() != 1 {
+		t.Errorf("expected --force-rehash to re-index the file, got %d indexed", stats.indexed.Load())
+	}
+	indexForceRehash = false
+
+	// A touched file with the same content is hashed, skipped, and its stat recorded
+	later := info.ModTime().Add(time.Hour)
+	os.Chtimes(path, later, later)
+	if stats := index(); stats.skipped.Load() != 1 {
+		t.Errorf("expected the touched file to be skipped, got %d skipped", stats.skipped.Load())
+	}
+	if !mcpStore.FileStatUnchanged(ctx, sourceID, store.DefaultCollectionID, "doc.md", info.Size(), later, indexSettings()) {
+		t.Error("expected the new modification time to be recorded")
+	}
+}
+
+func TestProcessFile_ReusesUnchangedChunks(t *testing.T) {
+	cleanup, root := setupTestMCPEnvironment(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	path := filepath.Join(root, "doc.md")
+	os.WriteFile(path, []byte("# Doc\n\n## One\n\nFirst section.\n\n## Two\n\nSecond section.\n"), 0644)
+
+	sourceID, _ := mcpStore.EnsureSource(ctx, root, store.DefaultCollectionID)
+	emb := &stubEmbedder{}
+	processFiles(root, sourceID, store.DefaultCollectionID, []string{path}, mcpStore, emb, chunker.New())
+	if got := emb.embedded.Load(); got != 3 {
+		t.Fatalf("expected 3 embedded chunks, got %d", got)
+	}
+
+	// Editing one section and inserting lines above the other only embeds the edited one
+	os.WriteFile(path, []byte("# Doc\n\nIntro.\n\n## One\n\nFirst section, edited.\n\n## Two\n\nSecond section.\n"), 0644)
+	emb.embedded.Store(0)
+	stats := processFiles(root, sourceID, store.DefaultCollectionID, []string{path}, mcpStore, emb, chunker.New())
+	if len(stats.sortedFailures()) > 0 {
+		t.Fatalf("indexing failed: %v", stats.sortedFailures()[0])
+	}
+	if got := stats.reusedChunks.Load(); got != 1 {
+		t.Errorf("expected 1 reused chunk, got %d", got)
+	}
+	if got := emb.embedded.Load(); got != 2 {
+		t.Errorf("expected the intro and the edited section to be embedded, got %d chunks", got)
+	}
+
+	query := make([]float32, store.EmbeddingDim)
+	query[0] = 1
+	results, _ := mcpStore.Search(ctx, query, 10)
+	for _, r := range results {
+		if strings.Contains(r.Content, "Second section") && r.StartLine != 9 {
+			t.Errorf("expected the reused chunk's line number to be updated, got %d", r.StartLine)
+		}
+	}
+
+	// Embeddings from a different model are not reused
+	os.WriteFile(path, []byte("# Doc\n\nIntro, edited.\n\n## One\n\nFirst section, edited.\n\n## Two\n\nSecond section.\n"), 0644)
+	other := &stubEmbedder{model: "other"}
+	stats = processFiles(root, sourceID, store.DefaultCollectionID, []string{path}, mcpStore, other, chunker.New())
+	if got := stats.reusedChunks.Load(); got != 0 {
+		t.Errorf("expected no reused chunks after a model change, got %d", got)
+	}
+}
+
+func TestProcessFile_FrontMatter(t *testing.T) {
+	cleanup, root := setupTestMCPEnvironment(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	path := filepath.Join(root, "guide.md")
+	os.WriteFile(path, []byte("---\ntitle: Deploy Guide\ntags: [ops]\n---\n# Deploy\n\nSteps.\n"), 0644)
+
+	sourceID, _ := mcpStore.EnsureSource(ctx, root, store.DefaultCollectionID)
+	stats := processFiles(root, sourceID, store.DefaultCollectionID, []string{path}, mcpStore, &stubEmbedder{}, chunker.New())
+	if len(stats.sortedFailures()) > 0 {
+		t.Fatalf("indexing failed: %v", stats.sortedFailures()[0])
+	}
+
+	docs, _ := mcpStore.ListDocuments(ctx)
+	if len(docs) != 1 || docs[0].Title != "Deploy Guide" {
+		t.Fatalf("expected the front matter title, got %+v", docs)
+	}
+	if got := frontmatter.Metadata(docs[0].Metadata).String(); got != "tags: ops; title: Deploy Guide" {
+		t.Errorf("unexpected metadata: %q", got)
+	}
+
+	query := make([]float32, store.EmbeddingDim)
+	query[0] = 1
+	results, _ := mcpStore.Search(ctx, query, 10)
+	if len(results) != 1 {
+		t.Fatalf("expected only the heading chunk, got %d chunks", len(results))
+	}
+	if strings.Contains(results[0].Content, "tags:") || results[0].StartLine != 5 {
+		t.Errorf("front matter should be stripped with line numbers kept, got line %d: %q", results[0].StartLine, results[0].Content)
+	}
+
+	// A document opening with a thematic break is indexed as text
+	os.WriteFile(path, []byte("---\n\nIntro: read this first.\n\n- one\n\n---\n\n# Deploy\n\nSteps.\n"), 0644)
+	stats = processFiles(root, sourceID, store.DefaultCollectionID, []string{path}, mcpStore, &stubEmbedder{}, chunker.New())
+	if failures := stats.sortedFailures(); len(failures) != 0 {
+		t.Fatalf("expected the file to be indexed, got %v", failures)
+	}
+	docs, _ = mcpStore.ListDocuments(ctx)
+	if len(docs) != 1 || docs[0].Title != "Deploy" || docs[0].Metadata != nil {
+		t.Errorf("expected the heading title and no metadata, got %+v", docs)
+	}
+	results, _ = mcpStore.Search(ctx, query, 10)
+	var intro bool
+	for _, r := range results {
+		intro = intro || strings.Contains(r.Content, "read this first")
+	}
+	if !intro {
+		t.Errorf("expected the text between the breaks to be indexed, got %+v", results)
+	}
+}
+
+func TestProcessFiles_UsesEmbeddingCache(t *testing.T) {
+	cleanup, root := setupTestMCPEnvironment(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	shared := "## License\n\nReleased under the MIT license.\n"
+	first := filepath.Join(root, "first.md")
+	second := filepath.Join(root, "second.md")
+	os.WriteFile(first, []byte("# First\n\nAlpha.\n\n"+shared), 0644)
+	os.WriteFile(second, []byte("# Second\n\nBeta.\n\n"+shared), 0644)
+
+	// The documents have different titles, and index's default options must
+	// still embed the shared section the same way in both
+	sourceID, _ := mcpStore.EnsureSource(ctx, root, store.DefaultCollectionID)
+	emb := &stubEmbedder{}
+	ch := chunker.NewWithOptions(chunkerOptions(emb))
+	processFiles(root, sourceID, store.DefaultCollectionID, []string{first}, mcpStore, emb, ch)
+
+	emb.embedded.Store(0)
+	stats := processFiles(root, sourceID, store.DefaultCollectionID, []string{second}, mcpStore, emb, ch)
+	if got := stats.reusedChunks.Load(); got != 1 {
+		t.Errorf("expected the shared section to come from the cache, got %d reused", got)
+	}
+	if got := emb.embedded.Load(); got != 1 {
+		t.Errorf("expected only the new section to be embedded, got %d", got)
+	}
+}
+
+func TestNewCacheCmd(t *testing.T) {
+	cmd := NewCacheCmd()
+	gc, _, err := cmd.Find([]string{"gc"})
+	if err != nil || gc.Use != "gc" {
+		t.Fatalf("expected gc subcommand, got %v", err)
+	}
+	if gc.Flags().Lookup("unused-for") == nil {
+		t.Error("missing flag --unused-for")
+	}
+}
+
+func TestProcessFiles_CollectsFailures(t *testing.T) {
+	cleanup, root := setupTestMCPEnvironment(t)
+	defer cleanup()
+
+	files := []string{
+		filepath.Join(root, "a.md"),
+		filepath.Join(root, "b.md"),
+		filepath.Join(root, "c.md"),
+		filepath.Join(root, "missing.md"),
+	}
+	os.WriteFile(files[0], []byte("# A\n\nFine.\n"), 0644)
+	os.WriteFile(files[1], []byte("# B\n\nFAIL here.\n"), 0644)
+	os.WriteFile(files[2], []byte("# C\n\nAlso fine.\n"), 0644)
+
+	sourceID, _ := mcpStore.EnsureSource(context.Background(), root, store.DefaultCollectionID)
+	stats := processFiles(root, sourceID, store.DefaultCollectionID, files, mcpStore, &stubEmbedder{failOn: "FAIL"}, chunker.New())
+
+	// Failures must not stop the remaining files
+	if got := stats.indexed.Load(); got != 2 {
+		t.Errorf("expected 2 indexed files, got %d", got)
+	}
+
+	failures := stats.sortedFailures()
+	if len(failures) != 2 {
+		t.Fatalf("expected 2 failures, got %d", len(failures))
+	}
+	if failures[0].Path != files[1] || failures[0].Stage != stageEmbed {
+		t.Errorf("unexpected first failure: %+v", failures[0])
+	}
+	if failures[1].Path != files[3] || failures[1].Stage != stageRead {
+		t.Errorf("unexpected second failure: %+v", failures[1])
+	}
+}
+
+func TestWriteIndexReport(t *testing.T) {
+	stats := &indexStats{}
+	stats.indexed.Store(3)
+	stats.skipped.Store(1)
+	stats.addFailure(&indexFailure{Path: "/docs/b.md", Stage: stageStore, Err: errors.New("disk full")})
+
+	reportPath := filepath.Join(t.TempDir(), "report.json")
+	if err := writeIndexReport(reportPath, "/docs", stats, 2); err != nil {
+		t.Fatalf("writeIndexReport failed: %v", err)
+	}
+
+	data, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatalf("failed to read report: %v", err)
+	}
+	var report indexReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("report is not valid JSON: %v", err)
+	}
+
+	if report.Directory != "/docs" || report.Indexed != 3 || report.Skipped != 1 || report.Pruned != 2 {
+		t.Errorf("unexpected report counts: %+v", report)
+	}
+	if len(report.Failures) != 1 {
+		t.Fatalf("expected 1 failure in report, got %d", len(report.Failures))
+	}
+	want := indexReportFailure{Path: "/docs/b.md", Stage: "store", Error: "disk full"}
+	if report.Failures[0] != want {
+		t.Errorf("failure = %+v, want %+v", report.Failures[0], want)
+	}
+}
+
+func TestNewStatsCmd(t *testing.T) {
+	cmd := NewStatsCmd()
+	if cmd.Use != "stats" {
+		t.Errorf("unexpected Use: %s", cmd.Use)
+	}
+	if cmd.Flags().Lookup("collection") == nil {
+		t.Error("missing flag --collection")
+	}
+}
+
+func TestPlanIndex(t *testing.T) {
+	cleanup, root := setupTestMCPEnvironment(t)
+	defer cleanup()
+
+	indexCollection = store.DefaultCollection
+	ctx := context.Background()
+	write := func(name, content string) string {
+		path := filepath.Join(root, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	same := write("same.md", "# Same\n\nUnchanged.\n")
+	edited := write("edited.md", "# Edited\n\nOld.\n")
+	gone := write("gone.md", "# Gone\n\nDeleted later.\n")
+
+	sourceID, _ := mcpStore.EnsureSource(ctx, root, store.DefaultCollectionID)
+	processFiles(root, sourceID, store.DefaultCollectionID, []string{same, edited, gone}, mcpStore, &stubEmbedder{}, chunker.New())
+
+	write("edited.md", "# Edited\n\nNew and longer.\n\n## More\n\nText.\n")
+	added := write("added.md", "# Added\n\nBrand new.\n")
+	os.Remove(gone)
+
+	matcher, err := newIndexMatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := planIndex(ctx, root, matcher, mcpStore, nil)
+	if err != nil {
+		t.Fatalf("planIndex failed: %v", err)
+	}
+
+	if len(plan.Added) != 1 || plan.Added[0].Path != added || plan.Added[0].Chunks != 1 {
+		t.Errorf("unexpected added files: %+v", plan.Added)
+	}
+	if len(plan.Updated) != 1 || plan.Updated[0].Path != edited || plan.Updated[0].Chunks != 2 {
+		t.Errorf("unexpected updated files: %+v", plan.Updated)
+	}
+	if len(plan.Unchanged) != 1 || plan.Unchanged[0] != same {
+		t.Errorf("unexpected unchanged files: %v", plan.Unchanged)
+	}
+	if len(plan.Pruned) != 1 || plan.Pruned[0] != gone {
+		t.Errorf("unexpected pruned files: %v", plan.Pruned)
+	}
+	if plan.Chunks != 3 {
+		t.Errorf("expected 3 chunks to embed, got %d", plan.Chunks)
+	}
+
+	// Nothing is written
+	docs, _ := mcpStore.ListDocuments(ctx)
+	if len(docs) != 3 {
+		t.Errorf("expected the index to be unchanged, got %d documents", len(docs))
+	}
+
+	output := formatIndexPlan(plan)
+	for _, want := range []string{"Add:       1 files (1 chunks)", "+ added.md (1 chunks)", "~ edited.md (2 chunks)", "- gone.md"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("plan should contain %q, got:\n%s", want, output)
+		}
+	}
+
+	// Without a database every file is new
+	plan, err = planIndex(ctx, root, matcher, nil, nil)
+	if err != nil {
+		t.Fatalf("planIndex failed: %v", err)
+	}
+	if len(plan.Added) != 3 || len(plan.Pruned) != 0 {
+		t.Errorf("expected 3 added files and none pruned, got %+v", plan)
+	}
+}
+
+func TestPlanIndex_CountsTokens(t *testing.T) {
+	cleanup, root := setupTestMCPEnvironment(t)
+	defer cleanup()
+
+	indexCollection = store.DefaultCollection
+	indexMaxTokens = 20
+	defer func() { indexMaxTokens = 0 }()
+
+	ctx := context.Background()
+	var body strings.Builder
+	body.WriteString("# Guide\n\n")
+	for i := 0; i < 6; i++ {
+		body.WriteString("A paragraph of exactly eight words right here.\n\n")
+	}
+	os.WriteFile(filepath.Join(root, "guide.md"), []byte(body.String()), 0644)
+
+	emb := &stubEmbedder{}
+	matcher, _ := newIndexMatcher()
+	plan, err := planIndex(ctx, root, matcher, mcpStore, emb.CountTokens)
+	if err != nil {
+		t.Fatalf("planIndex failed: %v", err)
+	}
+	words, _ := planIndex(ctx, root, matcher, mcpStore, nil)
+
+	if _, _, err := indexDirectory(ctx, root, matcher, mcpStore, emb); err != nil {
+		t.Fatalf("indexDirectory failed: %v", err)
+	}
+	query := make([]float32, store.EmbeddingDim)
+	query[0] = 1
+	results, _ := mcpStore.Search(ctx, query, 100)
+	if plan.Chunks != len(results) {
+		t.Errorf("planned %d chunks with the tokenizer, index produced %d", plan.Chunks, len(results))
+	}
+	if words.Chunks == len(results) {
+		t.Errorf("expected counting words to differ from the tokenizer, both gave %d chunks", words.Chunks)
+	}
+}
+
+func TestReindexSources(t *testing.T) {
+	cleanup, root := setupTestMCPEnvironment(t)
+	defer cleanup()
+
+	defer func() {
+		indexCollection, indexInclude, indexExclude = store.DefaultCollection, nil, nil
+		indexMaxTokens, indexOverlap, indexMinTokens = 0, 0, 0
+	}()
+
+	ctx := context.Background()
+	docs := filepath.Join(root, "docs")
+	notes := filepath.Join(root, "notes")
+	for _, dir := range []string{docs, notes, filepath.Join(docs, "drafts")} {
+		os.MkdirAll(dir, 0755)
+	}
+	os.WriteFile(filepath.Join(docs, "guide.md"), []byte("# Guide\n\nText.\n"), 0644)
+	os.WriteFile(filepath.Join(docs, "drafts", "wip.md"), []byte("# WIP\n\nText.\n"), 0644)
+	os.WriteFile(filepath.Join(notes, "note.md"), []byte("# Note\n\nText.\n"), 0644)
+
+	emb := &stubEmbedder{}
+	indexCollection, indexInclude, indexExclude = store.DefaultCollection, nil, []string{"drafts/"}
+	matcher, _ := newIndexMatcher()
+	if _, _, err := indexDirectory(ctx, docs, matcher, mcpStore, emb); err != nil {
+		t.Fatalf("indexDirectory failed: %v", err)
+	}
+	indexCollection, indexInclude, indexExclude = "notes", nil, nil
+	matcher, _ = newIndexMatcher()
+	if _, _, err := indexDirectory(ctx, notes, matcher, mcpStore, emb); err != nil {
+		t.Fatalf("indexDirectory failed: %v", err)
+	}
+
+	// Changes in both directories are picked up with each source's own options
+	indexCollection = ""
+	os.WriteFile(filepath.Join(docs, "new.md"), []byte("# New\n\nText.\n"), 0644)
+	os.WriteFile(filepath.Join(notes, "note.md"), []byte("# Note\n\nEdited.\n"), 0644)
+	failed, missing, err := reindexSources(ctx, mcpStore, emb)
+	if err != nil {
+		t.Fatalf("reindexSources failed: %v", err)
+	}
+	if failed != 0 || missing != 0 {
+		t.Errorf("expected no failures, got %d failed, %d missing", failed, missing)
+	}
+
+	byPath := make(map[string]string)
+	all, _ := mcpStore.ListDocuments(ctx)
+	for _, d := range all {
+		byPath[d.RelPath] = d.Collection
+	}
+	want := map[string]string{"guide.md": store.DefaultCollection, "new.md": store.DefaultCollection, "note.md": "notes"}
+	if len(byPath) != len(want) {
+		t.Errorf("expected documents %v, got %v", want, byPath)
+	}
+	for path, collection := range want {
+		if byPath[path] != collection {
+			t.Errorf("expected %s in collection %q, got %q", path, collection, byPath[path])
+		}
+	}
+
+	// A directory that no longer exists is reported, not pruned
+	os.RemoveAll(notes)
+	_, missing, err = reindexSources(ctx, mcpStore, emb)
+	if err != nil {
+		t.Fatalf("reindexSources failed: %v", err)
+	}
+	if missing != 1 {
+		t.Errorf("expected 1 missing directory, got %d", missing)
+	}
+	if all, _ := mcpStore.ListDocuments(ctx); len(all) != 3 {
+		t.Errorf("expected documents of the missing directory to be kept, got %d documents", len(all))
+	}
+}
+
+func TestIndexDirectory_ChunkSettings(t *testing.T) {
+	cleanup, root := setupTestMCPEnvironment(t)
+	defer cleanup()
+
+	indexCollection = store.DefaultCollection
+	defer func() { indexMaxTokens, indexOverlap, indexMinTokens = 0, 0, 0 }()
+
+	ctx := context.Background()
+	var body strings.Builder
+	body.WriteString("# Guide\n\n")
+	for i := 0; i < 6; i++ {
+		body.WriteString("A paragraph of exactly eight words right here.\n\n")
+	}
+	os.WriteFile(filepath.Join(root, "guide.md"), []byte(body.String()), 0644)
+
+	emb := &stubEmbedder{}
+	matcher, _ := newIndexMatcher()
+	countChunks := func() int {
+		query := make([]float32, store.EmbeddingDim)
+		query[0] = 1
+		results, _ := mcpStore.Search(ctx, query, 100)
+		return len(results)
+	}
+
+	if _, _, err := indexDirectory(ctx, root, matcher, mcpStore, emb); err != nil {
+		t.Fatalf("indexDirectory failed: %v", err)
+	}
+	if got := countChunks(); got != 1 {
+		t.Fatalf("expected one chunk without a budget, got %d", got)
+	}
+
+	// Changing the settings re-indexes unchanged files
+	indexMaxTokens, indexOverlap = 25, 10
+	stats, _, err := indexDirectory(ctx, root, matcher, mcpStore, emb)
+	if err != nil {
+		t.Fatalf("indexDirectory failed: %v", err)
+	}
+	if stats.indexed.Load() != 1 {
+		t.Errorf("expected the file to be re-indexed after a settings change, got %d indexed", stats.indexed.Load())
+	}
+	if got := countChunks(); got < 3 {
+		t.Errorf("expected the section to be split, got %d chunks", got)
+	}
+
+	stats, _, _ = indexDirectory(ctx, root, matcher, mcpStore, emb)
+	if stats.skipped.Load() != 1 {
+		t.Errorf("expected the file to be skipped with the same settings, got %d skipped", stats.skipped.Load())
+	}
+
+	// A minimum size is part of the settings too
+	indexMinTokens = 5
+	stats, _, _ = indexDirectory(ctx, root, matcher, mcpStore, emb)
+	if stats.indexed.Load() != 1 {
+		t.Errorf("expected the file to be re-indexed after setting a minimum, got %d indexed", stats.indexed.Load())
+	}
+
+	sources, _ := mcpStore.ListSources(ctx)
+	if len(sources) != 1 || sources[0].Options.MaxChunkTokens != 25 || sources[0].Options.ChunkOverlap != 10 || sources[0].Options.MinChunkTokens != 5 {
+		t.Errorf("expected the chunk settings to be remembered, got %+v", sources)
+	}
 }
 
-func TestNewSearchCmd(t *testing.T) {
-	cmd := NewSearchCmd()
-	if cmd == nil {
-		t.Fatal("NewSearchCmd returned nil")
+func TestIndexDirectory_NestedRoot(t *testing.T) {
+	cleanup, root := setupTestMCPEnvironment(t)
+	defer cleanup()
+
+	indexCollection = store.DefaultCollection
+	defer func() { indexCollection = store.DefaultCollection }()
+
+	ctx := context.Background()
+	child := filepath.Join(root, "guides")
+	os.Mkdir(child, 0755)
+	os.WriteFile(filepath.Join(child, "setup.md"), []byte("# Setup\n\nInstall it.\n"), 0644)
+
+	emb := &stubEmbedder{}
+	matcher, _ := newIndexMatcher()
+	if _, _, err := indexDirectory(ctx, root, matcher, mcpStore, emb); err != nil {
+		t.Fatalf("indexDirectory failed: %v", err)
 	}
-	if cmd.Use != "search [query]" {
-		t.Errorf("unexpected Use: %s", cmd.Use)
+
+	// The subdirectory is refused by both the dry run and the real run
+	if _, err := planIndex(ctx, child, matcher, mcpStore, nil); !errors.Is(err, store.ErrSourceOverlap) {
+		t.Errorf("planIndex: expected ErrSourceOverlap, got %v", err)
+	}
+	if _, _, err := indexDirectory(ctx, child, matcher, mcpStore, emb); !errors.Is(err, store.ErrSourceOverlap) {
+		t.Errorf("indexDirectory: expected ErrSourceOverlap, got %v", err)
+	}
+
+	// So is moving the directory to another collection
+	indexCollection = "guides"
+	if _, _, err := indexDirectory(ctx, root, matcher, mcpStore, emb); !errors.Is(err, store.ErrSourceCollection) {
+		t.Errorf("expected ErrSourceCollection, got %v", err)
+	}
+
+	docs, _ := mcpStore.ListDocuments(ctx)
+	if len(docs) != 1 || docs[0].Collection != store.DefaultCollection {
+		t.Errorf("expected the file to be indexed once into the default collection, got %+v", docs)
+	}
+	sources, _ := mcpStore.ListSources(ctx)
+	if len(sources) != 1 || sources[0].Root != root {
+		t.Errorf("expected only %s to be registered, got %+v", root, sources)
 	}
 }
 
-func TestNewRunCmd(t *testing.T) {
-	cmd := NewRunCmd()
-	if cmd == nil {
-		t.Fatal("NewRunCmd returned nil")
+func TestIndexDirectory_EmbedTemplate(t *testing.T) {
+	cleanup, root := setupTestMCPEnvironment(t)
+	defer cleanup()
+
+	indexCollection = store.DefaultCollection
+	indexTemplate = contextTemplateName
+	defer func() { indexTemplate = "" }()
+
+	ctx := context.Background()
+	content := "# Payments Service\n\nHandles card payments.\n\n## Configuration\n\nSet the API key.\n"
+	os.WriteFile(filepath.Join(root, "payments.md"), []byte(content), 0644)
+	matcher, _ := newIndexMatcher()
+
+	// The context template adds the document title to every embedded text
+	emb := &stubEmbedder{failOn: "Payments Service\n# Payments Service > ## Configuration"}
+	stats, _, err := indexDirectory(ctx, root, matcher, mcpStore, emb)
+	if err != nil {
+		t.Fatalf("indexDirectory failed: %v", err)
 	}
-	if cmd.Use != "run" {
+	if len(stats.sortedFailures()) != 1 {
+		t.Fatalf("expected the section's embedded text to include the title, got %d failures", len(stats.sortedFailures()))
+	}
+
+	emb = &stubEmbedder{}
+	if _, _, err := indexDirectory(ctx, root, matcher, mcpStore, emb); err != nil {
+		t.Fatalf("indexDirectory failed: %v", err)
+	}
+	query := make([]float32, store.EmbeddingDim)
+	query[0] = 1
+	results, _ := mcpStore.Search(ctx, query, 10)
+	for _, r := range results {
+		if r.HeadingPath == "# Payments Service > ## Configuration" && r.Content != "## Configuration\n\nSet the API key." {
+			t.Errorf("expected the stored content to be the original text, got %q", r.Content)
+		}
+	}
+	if len(results) != 2 {
+		t.Errorf("expected 2 chunks, got %d", len(results))
+	}
+
+	// Changing the template re-embeds unchanged files
+	indexTemplate = "{{.Path}}: {{.Content}}"
+	stats, _, err = indexDirectory(ctx, root, matcher, mcpStore, emb)
+	if err != nil {
+		t.Fatalf("indexDirectory failed: %v", err)
+	}
+	if stats.indexed.Load() != 1 || stats.reusedChunks.Load() != 0 || emb.embedded.Load() != 4 {
+		t.Errorf("expected both chunks to be re-embedded, got %d indexed, %d reused, %d embedded",
+			stats.indexed.Load(), stats.reusedChunks.Load(), emb.embedded.Load())
+	}
+
+	sources, _ := mcpStore.ListSources(ctx)
+	if len(sources) != 1 || sources[0].Options.EmbedTemplate != indexTemplate {
+		t.Errorf("expected the template to be remembered, got %+v", sources)
+	}
+}
+
+func TestFormatSources(t *testing.T) {
+	output := formatSources([]store.Source{
+		{Root: "/docs", Collection: "default", DocumentCount: 12, Options: store.SourceOptions{Exclude: []string{"drafts/", "*.tmp.md"}}},
+		{Root: "/notes", Collection: "notes", DocumentCount: 3, Options: store.SourceOptions{MaxChunkTokens: 200, ChunkOverlap: 20, MinChunkTokens: 30, SeparateCode: true, Obsidian: true}},
+	})
+	want := "/docs (collection default, 12 documents)\n  exclude: drafts/, *.tmp.md\n/notes (collection notes, 3 documents)\n  max chunk tokens: 200 (overlap 20)\n  min chunk tokens: 30\n  code blocks: separate chunks\n  obsidian vault\n"
+	if output != want {
+		t.Errorf("unexpected output:\n%s", output)
+	}
+}
+
+func TestNewSourcesCmd(t *testing.T) {
+	cmd := NewSourcesCmd()
+	for _, name := range []string{"list", "remove"} {
+		if sub, _, err := cmd.Find([]string{name}); err != nil || sub == cmd {
+			t.Errorf("missing subcommand %s", name)
+		}
+	}
+}
+
+func TestNewRelocateCmd(t *testing.T) {
+	cmd := NewRelocateCmd()
+	if cmd.Use != "relocate [old-directory] [new-directory]" {
 		t.Errorf("unexpected Use: %s", cmd.Use)
 	}
+	if err := cmd.Args(cmd, []string{"/old"}); err == nil {
+		t.Error("expected an error with one argument")
+	}
 }
 
-func TestRunIndex_InvalidDirectory(t *testing.T) {
-	cmd := NewIndexCmd()
-	cmd.SetArgs([]string{"/nonexistent/path/that/does/not/exist"})
+func TestProcessFiles_StoresRelativePaths(t *testing.T) {
+	cleanup, root := setupTestMCPEnvironment(t)
+	defer cleanup()
 
-	err := cmd.Execute()
-	if err == nil {
-		t.Error("expected error for nonexistent directory")
+	ctx := context.Background()
+	content := []byte("# Setup\n\nInstall it.\n")
+	path := filepath.Join(root, "guides", "setup.md")
+	os.MkdirAll(filepath.Dir(path), 0755)
+	os.WriteFile(path, content, 0644)
+
+	sourceID, err := mcpStore.EnsureSource(ctx, root, store.DefaultCollectionID)
+	if err != nil {
+		t.Fatalf("EnsureSource failed: %v", err)
+	}
+	stats := processFiles(root, sourceID, store.DefaultCollectionID, []string{path}, mcpStore, &stubEmbedder{}, chunker.New())
+	if len(stats.sortedFailures()) > 0 {
+		t.Fatalf("indexing failed: %v", stats.sortedFailures()[0])
+	}
+
+	docs, err := mcpStore.ListDocuments(ctx)
+	if err != nil {
+		t.Fatalf("ListDocuments failed: %v", err)
+	}
+	if len(docs) != 1 || docs[0].RelPath != "guides/setup.md" || docs[0].FilePath != path {
+		t.Fatalf("unexpected documents: %+v", docs)
+	}
+
+	// After moving the directory, documents resolve to the new root and are not re-embedded
+	moved := filepath.Join(t.TempDir(), "docs")
+	if _, err := mcpStore.RelocateSource(ctx, root, moved); err != nil {
+		t.Fatalf("RelocateSource failed: %v", err)
+	}
+	docs, _ = mcpStore.ListDocuments(ctx)
+	if len(docs) != 1 || docs[0].FilePath != filepath.Join(moved, "guides", "setup.md") {
+		t.Errorf("expected document under the new root, got %+v", docs)
+	}
+	hash := sha256.Sum256(content)
+	if !mcpStore.FileUnchangedInSource(ctx, sourceID, store.DefaultCollectionID, "guides/setup.md", hex.EncodeToString(hash[:]), indexSettings()) {
+		t.Error("relocated document should be unchanged")
 	}
 }
 
-func TestRunIndex_NotADirectory(t *testing.T) {
-	tmpFile, err := os.CreateTemp("", "mcpmydocs-test-*.txt")
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{5 * 1024 * 1024, "5.0 MiB"},
+	}
+	for _, tt := range tests {
+		if got := formatBytes(tt.n); got != tt.want {
+			t.Errorf("formatBytes(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestHandleIndexStatus(t *testing.T) {
+	cleanup, root := setupTestMCPEnvironment(t)
+	defer cleanup()
+	mcpDBPath = filepath.Join(root, "test.db")
+
+	ctx := context.Background()
+	path := filepath.Join(root, "doc.md")
+	os.WriteFile(path, []byte("# Doc\n\nSome content here.\n"), 0644)
+	sourceID, _ := mcpStore.EnsureSource(ctx, root, store.DefaultCollectionID)
+	stats := processFiles(root, sourceID, store.DefaultCollectionID, []string{path}, mcpStore, &stubEmbedder{}, chunker.New())
+	if len(stats.sortedFailures()) > 0 {
+		t.Fatalf("indexing failed: %v", stats.sortedFailures()[0])
+	}
+
+	result, output, err := handleIndexStatus(ctx, &mcp.CallToolRequest{}, IndexStatusInput{})
 	if err != nil {
-		t.Fatalf("failed to create temp file: %v", err)
+		t.Fatalf("handleIndexStatus failed: %v", err)
+	}
+	if result == nil {
+		t.Fatal("expected non-nil result")
 	}
-	defer os.Remove(tmpFile.Name())
-	tmpFile.Close()
 
-	cmd := NewIndexCmd()
-	cmd.SetArgs([]string{tmpFile.Name()})
+	for _, want := range []string{"Documents:       1", "Chunks:          1", "Truncated:       0 chunks", "Models:          stub", mcpDBPath} {
+		if !strings.Contains(output.Status, want) {
+			t.Errorf("status should contain %q, got:\n%s", want, output.Status)
+		}
+	}
 
-	err = cmd.Execute()
-	if err == nil {
-		t.Error("expected error when path is not a directory")
+	if _, _, err := handleIndexStatus(ctx, &mcp.CallToolRequest{}, IndexStatusInput{Collection: "missing"}); !errors.Is(err, store.ErrCollectionNotFound) {
+		t.Errorf("expected ErrCollectionNotFound, got %v", err)
+	}
+}
+
+func TestResolveLink(t *testing.T) {
+	tests := []struct {
+		destination    string
+		target, anchor string
+	}{
+		{"setup.md", "docs/setup.md", ""},
+		{"../README.md#Install-It", "README.md", "install-it"},
+		{"./api/search.md#query", "docs/api/search.md", "query"},
+		{"/changelog.md", "changelog.md", ""},
+		{"#usage", "docs/guide.md", "usage"},
+		{"my%20notes.md", "docs/my notes.md", ""},
+		{"https://example.com/setup.md", "", ""},
+		{"mailto:someone@example.com", "", ""},
+		{"diagram.png", "", ""},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		target, anchor := resolveLink("docs/guide.md", tt.destination)
+		if target != tt.target || anchor != tt.anchor {
+			t.Errorf("resolveLink(%q) = %q, %q; want %q, %q", tt.destination, target, anchor, tt.target, tt.anchor)
+		}
+	}
+}
+
+func TestResolveWikiLink(t *testing.T) {
+	tests := []struct {
+		link                   chunker.Link
+		target, name, fragment string
+	}{
+		{chunker.Link{Page: "Setup"}, "", "Setup", ""},
+		{chunker.Link{Page: "guides/Setup.md", Heading: "Install the CLI"}, "", "guides/Setup", "install-the-cli"},
+		{chunker.Link{Page: "Setup", Heading: "Install#On Linux"}, "", "Setup", "on-linux"},
+		{chunker.Link{Page: "Setup", Heading: "^block-1"}, "", "Setup", ""},
+		{chunker.Link{Heading: "Notes"}, "notes/today.md", "", "notes"},
+		{chunker.Link{Page: "diagram.PNG", Embed: true}, "", "", ""},
+		{chunker.Link{Page: "Release 1.2"}, "", "Release 1.2", ""},
+	}
+	for _, tt := range tests {
+		target, name, fragment := resolveWikiLink("notes/today.md", tt.link)
+		if target != tt.target || name != tt.name || fragment != tt.fragment {
+			t.Errorf("resolveWikiLink(%+v) = %q, %q, %q; want %q, %q, %q", tt.link, target, name, fragment, tt.target, tt.name, tt.fragment)
+		}
+	}
+}
+
+func TestIndexDirectory_Obsidian(t *testing.T) {
+	cleanup, root := setupTestMCPEnvironment(t)
+	defer cleanup()
+
+	indexCollection = store.DefaultCollection
+	indexObsidian = true
+	indexTemplate = contextTemplateName
+	defer func() { indexObsidian, indexTemplate = false, "" }()
+
+	ctx := context.Background()
+	os.MkdirAll(filepath.Join(root, "ops"), 0755)
+	os.WriteFile(filepath.Join(root, "Daily.md"), []byte("# Daily\n\nShipped per [[Shipping#Checklist|the checklist]] and ![[Missing note]]. #standup\n"), 0644)
+	os.WriteFile(filepath.Join(root, "ops", "Deploy.md"), []byte("---\naliases: [Shipping]\ntags: ops\n---\n# Deploy\n\n## Checklist\n\nRun the #release/prod pipeline.\n"), 0644)
+	matcher, _ := newIndexMatcher()
+	emb := &stubEmbedder{failOn: "Deploy (Shipping)\n# Deploy > ## Checklist"}
+	stats, _, err := indexDirectory(ctx, root, matcher, mcpStore, emb)
+	if err != nil {
+		t.Fatalf("indexDirectory failed: %v", err)
+	}
+	if len(stats.sortedFailures()) != 1 {
+		t.Fatalf("expected the embedded text to include the aliases, got %d failures", len(stats.sortedFailures()))
+	}
+	if _, _, err := indexDirectory(ctx, root, matcher, mcpStore, &stubEmbedder{}); err != nil {
+		t.Fatalf("indexDirectory failed: %v", err)
+	}
+
+	// Inline tags join the front matter tags
+	docs, _ := mcpStore.ListDocuments(ctx)
+	tags := map[string]string{}
+	for _, d := range docs {
+		tags[d.Title] = frontmatter.Metadata{"tags": d.Metadata["tags"]}.String()
+	}
+	if tags["Daily"] != "tags: standup" || tags["Deploy"] != "tags: ops, release/prod" {
+		t.Errorf("unexpected tags: %v", tags)
+	}
+
+	deploy := filepath.Join(root, "ops", "Deploy.md")
+	_, output, err := handleBacklinks(ctx, &mcp.CallToolRequest{}, LinksInput{Path: deploy})
+	if err != nil {
+		t.Fatalf("handleBacklinks failed: %v", err)
+	}
+	if want := "[[Shipping#Checklist|the checklist]]"; !strings.Contains(output.Links, want) {
+		t.Errorf("backlinks should contain %q, got:\n%s", want, output.Links)
+	}
+
+	_, output, err = handleBrokenLinks(ctx, &mcp.CallToolRequest{}, BrokenLinksInput{})
+	if err != nil {
+		t.Fatalf("handleBrokenLinks failed: %v", err)
+	}
+	if want := "![[Missing note]] -> broken: " + filepath.Join(root, "Missing note.md") + " is not indexed"; !strings.Contains(output.Links, want) {
+		t.Errorf("broken links should contain %q, got:\n%s", want, output.Links)
+	}
+
+	// list_documents matches aliases
+	_, list, err := handleListDocuments(ctx, &mcp.CallToolRequest{}, ListDocumentsInput{Title: "shipping"})
+	if err != nil {
+		t.Fatalf("handleListDocuments failed: %v", err)
+	}
+	if !strings.Contains(list.Documents, "Indexed 1 documents") || !strings.Contains(list.Documents, deploy) {
+		t.Errorf("expected the aliased document, got:\n%s", list.Documents)
+	}
+	if _, list, _ := handleListDocuments(ctx, &mcp.CallToolRequest{}, ListDocumentsInput{Title: "nothing"}); list.Documents != `No documents titled "nothing".` {
+		t.Errorf("unexpected output: %s", list.Documents)
+	}
+}
+
+func TestHandleLinks(t *testing.T) {
+	cleanup, root := setupTestMCPEnvironment(t)
+	defer cleanup()
+
+	indexCollection = store.DefaultCollection
+
+	ctx := context.Background()
+	os.MkdirAll(filepath.Join(root, "guides"), 0755)
+	os.WriteFile(filepath.Join(root, "README.md"), []byte("# Docs\n\nStart with the [setup guide](guides/setup.md#install).\n\nSee also [the FAQ](faq.md).\n"), 0644)
+	os.WriteFile(filepath.Join(root, "guides", "setup.md"), []byte("# Setup\n\n## Install\n\nBack to [the docs](../README.md#nothing-here).\n"), 0644)
+	matcher, _ := newIndexMatcher()
+	if _, _, err := indexDirectory(ctx, root, matcher, mcpStore, &stubEmbedder{}); err != nil {
+		t.Fatalf("indexDirectory failed: %v", err)
+	}
+
+	readme := filepath.Join(root, "README.md")
+	setup := filepath.Join(root, "guides", "setup.md")
+
+	_, output, err := handleLinks(ctx, &mcp.CallToolRequest{}, LinksInput{Path: readme})
+	if err != nil {
+		t.Fatalf("handleLinks failed: %v", err)
+	}
+	for _, want := range []string{
+		"2 links in " + readme,
+		"line 3 (# Docs): [setup guide](guides/setup.md#install) -> " + setup + " (# Setup > ## Install)",
+		"[the FAQ](faq.md) -> broken: " + filepath.Join(root, "faq.md") + " is not indexed",
+	} {
+		if !strings.Contains(output.Links, want) {
+			t.Errorf("links should contain %q, got:\n%s", want, output.Links)
+		}
+	}
+
+	_, output, err = handleBacklinks(ctx, &mcp.CallToolRequest{}, LinksInput{Path: setup})
+	if err != nil {
+		t.Fatalf("handleBacklinks failed: %v", err)
+	}
+	if want := "1 links to " + setup + ":\n  " + readme + ":3 (# Docs): [setup guide](guides/setup.md#install)\n"; output.Links != want {
+		t.Errorf("got backlinks:\n%s\nwant:\n%s", output.Links, want)
+	}
+
+	_, output, err = handleBrokenLinks(ctx, &mcp.CallToolRequest{}, BrokenLinksInput{})
+	if err != nil {
+		t.Fatalf("handleBrokenLinks failed: %v", err)
+	}
+	for _, want := range []string{"2 broken links", "has no heading #nothing-here", "faq.md is not indexed"} {
+		if !strings.Contains(output.Links, want) {
+			t.Errorf("broken links should contain %q, got:\n%s", want, output.Links)
+		}
+	}
+
+	if _, _, err := handleLinks(ctx, &mcp.CallToolRequest{}, LinksInput{Path: filepath.Join(root, "missing.md")}); err == nil || !strings.Contains(err.Error(), "is not indexed") {
+		t.Errorf("expected error for a document that is not indexed, got %v", err)
+	}
+	if _, _, err := handleLinks(ctx, &mcp.CallToolRequest{}, LinksInput{}); err == nil {
+		t.Error("expected error for a missing path")
+	}
+	if _, _, err := handleBrokenLinks(ctx, &mcp.CallToolRequest{}, BrokenLinksInput{Collection: "missing"}); !errors.Is(err, store.ErrCollectionNotFound) {
+		t.Errorf("expected ErrCollectionNotFound, got %v", err)
+	}
+}
+
+func TestResolveCheck(t *testing.T) {
+	tmpDir := t.TempDir()
+	found := filepath.Join(tmpDir, "lib.so")
+	os.WriteFile(found, []byte("fake"), 0644)
+
+	c, path := resolveCheck("Library", func() ([]paths.Candidate, error) {
+		return []paths.Candidate{
+			{Source: "ENV_VAR"},
+			{Source: "missing", Path: filepath.Join(tmpDir, "missing.so")},
+			{Source: "found", Path: found},
+			{Source: "never checked", Path: filepath.Join(tmpDir, "later.so")},
+		}, nil
+	})
+
+	if c.Status != checkPass || path != found {
+		t.Errorf("expected pass with %s, got %s with %q", found, c.Status, path)
+	}
+	if len(c.Details) != 3 {
+		t.Fatalf("expected 3 candidates reported, got %v", c.Details)
+	}
+	if c.Details[0] != "ENV_VAR: not set" || !strings.HasSuffix(c.Details[1], "(missing): not found") {
+		t.Errorf("unexpected rejection reasons: %v", c.Details)
+	}
+
+	c, path = resolveCheck("Library", func() ([]paths.Candidate, error) {
+		return []paths.Candidate{{Source: "ENV_VAR"}}, nil
+	})
+	if c.Status != checkFail || path != "" {
+		t.Errorf("expected failure, got %s with %q", c.Status, path)
+	}
+
+	// A directory is what the lookup would use, so it fails the check
+	c, path = resolveCheck("Library", func() ([]paths.Candidate, error) {
+		return []paths.Candidate{{Source: "dir", Path: tmpDir}, {Source: "found", Path: found}}, nil
+	})
+	if c.Status != checkFail || path != "" || c.Detail != tmpDir+" is a directory, not a file" {
+		t.Errorf("expected failure for a directory, got %s with %q: %s", c.Status, path, c.Detail)
+	}
+}
+
+func TestFormatChecks(t *testing.T) {
+	output := formatChecks([]check{
+		{Name: "Library", Status: checkPass, Detail: "/usr/lib/lib.so"},
+		{Name: "Model", Status: checkFail, Detail: "not found", Details: []string{"MODEL_PATH: not set"}, Hint: "Run the install script"},
+	})
+
+	for _, want := range []string{
+		"[PASS] Library: /usr/lib/lib.so\n",
+		"[FAIL] Model: not found\n",
+		"- MODEL_PATH: not set\n",
+		"hint: Run the install script\n",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output should contain %q, got:\n%s", want, output)
+		}
 	}
 }
 
-// setupTestMCPEnvironment creates a test environment for MCP handler tests.
 func setupTestMCPEnvironment(t *testing.T) (func(), string) {
 	t.Helper()
 
@@ -239,6 +1597,34 @@ func TestHandleListDocuments_WithDocuments(t *testing.T) {
 	}
 }
 
+func TestHandleListDocuments_Collection(t *testing.T) {
+	cleanup, _ := setupTestMCPEnvironment(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	adrID, _ := mcpStore.EnsureCollection(ctx, "adrs")
+	mcpStore.InsertDocument(ctx, "/doc1.md", "hash1", "Default Document")
+	mcpStore.InsertDocumentInCollection(ctx, adrID, "/adr1.md", "hash2", "ADR Document")
+
+	req := &mcp.CallToolRequest{}
+
+	_, output, err := handleListDocuments(ctx, req, ListDocumentsInput{Collection: "adrs"})
+	if err != nil {
+		t.Fatalf("handleListDocuments failed: %v", err)
+	}
+	if !strings.Contains(output.Documents, "ADR Document") {
+		t.Error("output should contain 'ADR Document'")
+	}
+	if strings.Contains(output.Documents, "Default Document") {
+		t.Error("output should not contain documents from other collections")
+	}
+
+	if _, _, err := handleListDocuments(ctx, req, ListDocumentsInput{Collection: "missing"}); err == nil {
+		t.Error("expected error for unknown collection")
+	}
+}
+
 // TestHandleSearch_Integration tests the MCP handler with real components.
 // Unit tests for search logic are in internal/search/search_test.go.
 func TestHandleSearch_Integration(t *testing.T) {
@@ -312,6 +1698,72 @@ func TestHandleSearch_Integration(t *testing.T) {
 	})
 }
 
+func TestHandleSearch_Collection(t *testing.T) {
+	cleanup, _ := setupTestMCPEnvironment(t)
+	defer cleanup()
+
+	// Keyword search needs no embedder
+	mcpSearch = search.New(mcpStore, nil, nil)
+	defer func() { mcpSearch = nil }()
+
+	ctx := context.Background()
+	_, _, err := handleSearch(ctx, &mcp.CallToolRequest{}, SearchInput{Query: "deploy", Mode: "keyword", Collection: "missing"})
+	if !errors.Is(err, store.ErrCollectionNotFound) {
+		t.Errorf("expected ErrCollectionNotFound, got %v", err)
+	}
+	if _, _, err := handleSearch(ctx, &mcp.CallToolRequest{}, SearchInput{Query: "deploy", Mode: "keyword", Collection: store.DefaultCollection}); err != nil {
+		t.Errorf("handleSearch failed: %v", err)
+	}
+}
+
+func TestSearchFilterOptions(t *testing.T) {
+	f, err := searchFilterOptions{Collection: "runbooks", Path: "./guides/", IndexedAfter: "2024-03-01", ModifiedBefore: "2024-03-01T10:00:00Z"}.filter()
+	if err != nil {
+		t.Fatalf("filter failed: %v", err)
+	}
+	if f.Collection != "runbooks" {
+		t.Errorf("expected the collection in the filter, got %q", f.Collection)
+	}
+	if f.PathPrefix != "guides/" || f.PathGlob != "" {
+		t.Errorf("expected a path prefix, got %+v", f)
+	}
+	if want := time.Date(2024, 3, 1, 0, 0, 0, 0, time.Local); !f.IndexedAfter.Equal(want) {
+		t.Errorf("unexpected indexed-after date: %v", f.IndexedAfter)
+	}
+	if want := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC); !f.ModifiedBefore.Equal(want) {
+		t.Errorf("unexpected modified-before date: %v", f.ModifiedBefore)
+	}
+
+	if f, _ := (searchFilterOptions{Path: "guides/*.md"}).filter(); f.PathGlob != "guides/*.md" || f.PathPrefix != "" {
+		t.Errorf("expected a path glob, got %+v", f)
+	}
+
+	invalid := []searchFilterOptions{
+		{ModifiedAfter: "yesterday"},
+		{MinLevel: 3, MaxLevel: 1},
+		{Metadata: map[string]string{`a"b`: ""}},
+		{Kind: "prose"},
+	}
+	for _, opts := range invalid {
+		if _, err := opts.filter(); err == nil {
+			t.Errorf("expected %+v to be rejected", opts)
+		}
+	}
+}
+
+func TestParseMetadataFlags(t *testing.T) {
+	metadata, err := parseMetadataFlags([]string{"owner=alice", "draft", "title = a=b"})
+	if err != nil {
+		t.Fatalf("parseMetadataFlags failed: %v", err)
+	}
+	if metadata["owner"] != "alice" || metadata["draft"] != "" || metadata["title"] != "a=b" {
+		t.Errorf("unexpected metadata: %v", metadata)
+	}
+	if _, err := parseMetadataFlags([]string{"=x"}); err == nil {
+		t.Error("expected an empty key to be rejected")
+	}
+}
+
 func TestFormatResults(t *testing.T) {
 	t.Run("vector results", func(t *testing.T) {
 		result := &search.Result{
@@ -368,6 +1820,36 @@ func TestFormatResults(t *testing.T) {
 			t.Error("output should contain relevance score")
 		}
 	})
+
+	t.Run("keyword and hybrid results", func(t *testing.T) {
+		item := search.Item{FilePath: "/path/to/file.md", HeadingPath: "# Test", Content: "test content", Score: 3.25}
+
+		output := formatResults(&search.Result{Query: "ERR_42", Mode: search.ModeKeyword, Items: []search.Item{item}})
+		if !strings.Contains(output, "BM25: 3.25") {
+			t.Errorf("output should contain the BM25 score, got %q", output)
+		}
+
+		item.Score = 0.0325
+		output = formatResults(&search.Result{Query: "ERR_42", Mode: search.ModeHybrid, Items: []search.Item{item}})
+		if !strings.Contains(output, "fused: 0.0325") {
+			t.Errorf("output should contain the fused score, got %q", output)
+		}
+	})
+
+	t.Run("code", func(t *testing.T) {
+		items := []search.Item{
+			{FilePath: "/deploy.md", HeadingPath: "# Deploy", Content: "replicas: 3", Kind: store.ChunkKindCode, Lang: "yaml"},
+			{FilePath: "/deploy.md", HeadingPath: "# Deploy", Content: "Apply it.", Kind: store.ChunkKindText, Lang: "yaml json"},
+			{FilePath: "/deploy.md", HeadingPath: "# Deploy", Content: "Done.", Kind: store.ChunkKindText},
+		}
+		output := formatResults(&search.Result{Query: "replicas", Items: items})
+		if !strings.Contains(output, "**Code:** code block (yaml)\n") || !strings.Contains(output, "**Code:** contains yaml, json\n") {
+			t.Errorf("output should describe the code in each result, got %q", output)
+		}
+		if strings.Count(output, "**Code:**") != 2 {
+			t.Errorf("prose without code should have no code line, got %q", output)
+		}
+	})
 }
 
 // Helper functions for tests
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mattdennewitz/mcpmydocs/internal/paths"
+	"github.com/mattdennewitz/mcpmydocs/internal/store"
+)
+
+// NewCollectionsCmd creates the collections command and its subcommands.
+func NewCollectionsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "collections",
+		Short: "Manage named collections of indexed documents",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List collections and their document counts",
+		Args:  cobra.NoArgs,
+		RunE:  runCollectionsList,
+	}, &cobra.Command{
+		Use:   "drop [name]",
+		Short: "Remove a collection and all of its documents",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runCollectionsDrop,
+	})
+
+	return cmd
+}
+
+func runCollectionsList(cmd *cobra.Command, args []string) error {
+	dbPath, err := existingDBPath()
+	if err != nil {
+		return err
+	}
+
+	st, err := store.NewReadOnly(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer st.Close()
+
+	collections, err := st.ListCollections(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to list collections: %w", err)
+	}
+
+	for _, c := range collections {
+		fmt.Printf("%-20s %d documents\n", c.Name, c.DocumentCount)
+	}
+	return nil
+}
+
+func runCollectionsDrop(cmd *cobra.Command, args []string) error {
+	name := args[0]
+
+	dbPath, err := existingDBPath()
+	if err != nil {
+		return err
+	}
+
+	st, err := store.New(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer st.Close()
+
+	removed, err := st.DeleteCollection(context.Background(), name)
+	if err != nil {
+		return fmt.Errorf("failed to drop collection: %w", err)
+	}
+
+	fmt.Printf("Dropped collection %q (%d documents removed)\n", name, removed)
+	return nil
+}
+
+// existingDBPath resolves the database location and verifies that it has been created.
+func existingDBPath() (string, error) {
+	dbPath, err := paths.ResolveDBPath(DBPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve paths: %w", err)
+	}
+
+	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+		return "", fmt.Errorf("database not found at %s. Run 'mcpmydocs index' first", dbPath)
+	}
+	return dbPath, nil
+}
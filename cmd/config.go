@@ -2,3 +2,6 @@ package cmd
 
 // OnnxLibraryPath can be set via CLI flag to override the default resolution logic
 var OnnxLibraryPath string
+
+// DBPath can be set via CLI flag to override the database location
+var DBPath string
@@ -0,0 +1,240 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mattdennewitz/mcpmydocs/internal/embedder"
+	"github.com/mattdennewitz/mcpmydocs/internal/paths"
+	"github.com/mattdennewitz/mcpmydocs/internal/reranker"
+	"github.com/mattdennewitz/mcpmydocs/internal/store"
+)
+
+// NewDoctorCmd creates the doctor command.
+func NewDoctorCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "doctor",
+		Short: "Check the ONNX runtime, models, DuckDB extensions and database",
+		Args:  cobra.NoArgs,
+		RunE:  runDoctor,
+	}
+}
+
+type checkStatus string
+
+const (
+	checkPass checkStatus = "PASS"
+	checkWarn checkStatus = "WARN"
+	checkFail checkStatus = "FAIL"
+	checkSkip checkStatus = "SKIP"
+)
+
+// check is one line of the doctor checklist.
+type check struct {
+	Name    string
+	Status  checkStatus
+	Detail  string
+	Hint    string   // how to fix a warning or failure
+	Details []string // e.g. the candidate paths that were tried
+}
+
+func runDoctor(cmd *cobra.Command, args []string) error {
+	checks := runChecks()
+	fmt.Print(formatChecks(checks))
+
+	failed := 0
+	for _, c := range checks {
+		if c.Status == checkFail {
+			failed++
+		}
+	}
+	if failed > 0 {
+		cmd.SilenceUsage = true
+		return fmt.Errorf("%d checks failed", failed)
+	}
+	return nil
+}
+
+func runChecks() []check {
+	var checks []check
+
+	libCheck, libPath := resolveCheck("ONNX Runtime library", func() ([]paths.Candidate, error) {
+		return paths.ONNXLibraryCandidates(OnnxLibraryPath)
+	})
+	if libCheck.Status == checkFail {
+		libCheck.Hint = "Install ONNX Runtime (macOS: brew install onnxruntime), or point --onnx-lib or ONNX_LIBRARY_PATH at the library"
+	}
+	checks = append(checks, libCheck)
+
+	runtimeCheck := check{Name: "ONNX Runtime loads", Status: checkSkip, Detail: "library not found"}
+	if libPath != "" {
+		runtimeCheck.Status, runtimeCheck.Detail = checkPass, libPath
+		if err := embedder.LoadRuntime(libPath); err != nil {
+			runtimeCheck.Status, runtimeCheck.Detail = checkFail, err.Error()
+			runtimeCheck.Hint = "Make sure the library matches this machine's OS and architecture and a supported ONNX Runtime version"
+		}
+	}
+	checks = append(checks, runtimeCheck)
+	runtimeLoaded := runtimeCheck.Status == checkPass
+
+	modelCheck, modelPath := resolveCheck("Embedding model", func() ([]paths.Candidate, error) {
+		return paths.ModelCandidates(), nil
+	})
+	if modelCheck.Status == checkFail {
+		modelCheck.Hint = "Run the install script, or set MCPMYDOCS_MODEL_PATH to the embed.onnx file"
+	}
+	checks = append(checks, modelCheck)
+
+	if modelPath != "" {
+		checks = append(checks, modelIOCheck("Embedding model inputs/outputs", modelPath, runtimeLoaded, embedder.CheckModel,
+			"Use the all-MiniLM-L6-v2 ONNX export described in the installation instructions"))
+
+		tokCheck := check{Name: "Tokenizer", Status: checkPass}
+		if size, err := embedder.CheckTokenizer(modelPath); err != nil {
+			tokCheck.Status, tokCheck.Detail = checkFail, fmt.Sprintf("%s: %v", embedder.TokenizerPath(modelPath), err)
+			tokCheck.Hint = "Download tokenizer.json into the model directory (see Installation)"
+		} else {
+			tokCheck.Detail = fmt.Sprintf("%s (%d tokens)", embedder.TokenizerPath(modelPath), size)
+		}
+		checks = append(checks, tokCheck)
+	}
+
+	rerankCheck, rerankPath := resolveCheck("Reranker model", func() ([]paths.Candidate, error) {
+		return paths.RerankerModelCandidates(), nil
+	})
+	if rerankCheck.Status == checkFail {
+		// The reranker is optional
+		rerankCheck.Status = checkWarn
+		rerankCheck.Detail = "not found; search falls back to vector similarity"
+		rerankCheck.Hint = "Run the install script, or set MCPMYDOCS_RERANKER_PATH to the rerank.onnx file"
+	}
+	checks = append(checks, rerankCheck)
+
+	if rerankPath != "" {
+		checks = append(checks, modelIOCheck("Reranker model inputs/outputs", rerankPath, runtimeLoaded, reranker.CheckModel,
+			"Use the ms-marco-MiniLM-L-6-v2 ONNX export described in the installation instructions"))
+	}
+
+	vssCheck := check{Name: "DuckDB vss extension", Status: checkPass, Detail: "installed"}
+	if err := store.CheckVSS(); err != nil {
+		vssCheck.Status, vssCheck.Detail = checkFail, err.Error()
+		vssCheck.Hint = "Run 'mcpmydocs index' once with network access so DuckDB can download the extension"
+	}
+	checks = append(checks, vssCheck)
+
+	return append(checks, databaseCheck())
+}
+
+// resolveCheck reports the candidates tried for a file, up to the first one
+// that exists, and returns that path.
+func resolveCheck(name string, candidates func() ([]paths.Candidate, error)) (check, string) {
+	c := check{Name: name, Status: checkFail, Detail: "not found"}
+
+	list, err := candidates()
+	for _, cand := range list {
+		location := cand.Path
+		if location == "" {
+			location = cand.Source
+		} else {
+			location = fmt.Sprintf("%s (%s)", cand.Path, cand.Source)
+		}
+
+		if err := cand.Check(); err != nil {
+			c.Details = append(c.Details, fmt.Sprintf("%s: %v", location, err))
+			continue
+		}
+
+		// The lookup settles for any existing path, which fails to load
+		// later if it is a directory
+		if info, err := os.Stat(cand.Path); err == nil && info.IsDir() {
+			c.Details = append(c.Details, location+": is a directory")
+			c.Detail = cand.Path + " is a directory, not a file"
+			return c, ""
+		}
+
+		c.Details = append(c.Details, location+": ok")
+		c.Status, c.Detail = checkPass, cand.Path
+		return c, cand.Path
+	}
+
+	if err != nil {
+		c.Detail = err.Error()
+	}
+	return c, ""
+}
+
+func modelIOCheck(name, modelPath string, runtimeLoaded bool, validate func(string) error, hint string) check {
+	if !runtimeLoaded {
+		return check{Name: name, Status: checkSkip, Detail: "ONNX Runtime not loaded"}
+	}
+	if err := validate(modelPath); err != nil {
+		return check{Name: name, Status: checkFail, Detail: err.Error(), Hint: hint}
+	}
+	return check{Name: name, Status: checkPass, Detail: "ok"}
+}
+
+func databaseCheck() check {
+	c := check{Name: "Database"}
+
+	dbPath, err := paths.ResolveDBPath(DBPath)
+	if err != nil {
+		c.Status, c.Detail = checkFail, err.Error()
+		return c
+	}
+
+	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+		c.Status, c.Detail = checkWarn, dbPath+": not created yet"
+		c.Hint = "Run 'mcpmydocs index <directory>' to create it, or pass --db / set MCPMYDOCS_DB to use an existing one"
+		return c
+	}
+
+	st, err := store.NewReadOnly(dbPath)
+	if errors.Is(err, store.ErrSchemaOutdated) {
+		c.Status, c.Detail = checkWarn, fmt.Sprintf("%s: created by an older version", dbPath)
+		c.Hint = "Run 'mcpmydocs index <directory>' to upgrade it"
+		return c
+	}
+	if err != nil {
+		c.Status, c.Detail = checkFail, fmt.Sprintf("%s: %v", dbPath, err)
+		c.Hint = "Check the vss extension above; if another process is writing to the database, stop it and retry"
+		return c
+	}
+	defer st.Close()
+
+	collections, err := st.ListCollections(context.Background())
+	if err != nil {
+		c.Status, c.Detail = checkFail, fmt.Sprintf("%s: %v", dbPath, err)
+		c.Hint = "The database may be from an incompatible version; re-create it with 'mcpmydocs index'"
+		return c
+	}
+
+	docs := 0
+	for _, col := range collections {
+		docs += col.DocumentCount
+	}
+	c.Status, c.Detail = checkPass, fmt.Sprintf("%s (%d documents in %d collections)", dbPath, docs, len(collections))
+	return c
+}
+
+func formatChecks(checks []check) string {
+	var output string
+	for _, c := range checks {
+		output += fmt.Sprintf("[%s] %s", c.Status, c.Name)
+		if c.Detail != "" {
+			output += ": " + c.Detail
+		}
+		output += "\n"
+
+		for _, d := range c.Details {
+			output += fmt.Sprintf("       - %s\n", d)
+		}
+		if c.Hint != "" {
+			output += fmt.Sprintf("       hint: %s\n", c.Hint)
+		}
+	}
+	return output
+}
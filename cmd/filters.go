@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattdennewitz/mcpmydocs/internal/store"
+)
+
+// searchFilterOptions are the search filters as given on the command line or
+// to the MCP search tool.
+type searchFilterOptions struct {
+	Collection     string
+	Path           string
+	Tags           []string
+	Metadata       map[string]string
+	MinLevel       int
+	MaxLevel       int
+	IndexedAfter   string
+	IndexedBefore  string
+	ModifiedAfter  string
+	ModifiedBefore string
+	Kind           string
+	Lang           string
+}
+
+// filter converts the options into a store filter. A path containing glob
+// characters is matched as a glob, otherwise as a prefix.
+func (o searchFilterOptions) filter() (store.Filter, error) {
+	f := store.Filter{
+		Collection:      o.Collection,
+		Tags:            o.Tags,
+		Metadata:        o.Metadata,
+		MinHeadingLevel: o.MinLevel,
+		MaxHeadingLevel: o.MaxLevel,
+		Kind:            o.Kind,
+		Lang:            o.Lang,
+	}
+
+	path := strings.TrimPrefix(o.Path, "./")
+	if strings.ContainsAny(path, "*?[") {
+		f.PathGlob = path
+	} else {
+		f.PathPrefix = path
+	}
+
+	dates := []struct {
+		name  string
+		value string
+		dst   *time.Time
+	}{
+		{"indexed-after", o.IndexedAfter, &f.IndexedAfter},
+		{"indexed-before", o.IndexedBefore, &f.IndexedBefore},
+		{"modified-after", o.ModifiedAfter, &f.ModifiedAfter},
+		{"modified-before", o.ModifiedBefore, &f.ModifiedBefore},
+	}
+	for _, d := range dates {
+		if d.value == "" {
+			continue
+		}
+		t, err := parseFilterDate(d.value)
+		if err != nil {
+			return store.Filter{}, fmt.Errorf("invalid %s date %q: expected YYYY-MM-DD or RFC 3339", d.name, d.value)
+		}
+		*d.dst = t
+	}
+
+	return f, f.Validate()
+}
+
+// parseFilterDate parses a date (midnight local time) or an RFC 3339 timestamp.
+func parseFilterDate(value string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// parseMetadataFlags turns "key=value" or "key" flags into a metadata filter.
+func parseMetadataFlags(flags []string) (map[string]string, error) {
+	if len(flags) == 0 {
+		return nil, nil
+	}
+	metadata := make(map[string]string, len(flags))
+	for _, flag := range flags {
+		key, value, _ := strings.Cut(flag, "=")
+		key = strings.TrimSpace(key)
+		if key == "" {
+			return nil, fmt.Errorf("invalid --meta %q: expected key=value or key", flag)
+		}
+		metadata[key] = strings.TrimSpace(value)
+	}
+	return metadata, nil
+}
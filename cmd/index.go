@@ -4,11 +4,15 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/fs"
+	"maps"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -19,18 +23,99 @@ import (
 
 	"github.com/mattdennewitz/mcpmydocs/internal/app"
 	"github.com/mattdennewitz/mcpmydocs/internal/chunker"
+	"github.com/mattdennewitz/mcpmydocs/internal/frontmatter"
+	"github.com/mattdennewitz/mcpmydocs/internal/ignore"
 	"github.com/mattdennewitz/mcpmydocs/internal/logger"
 	"github.com/mattdennewitz/mcpmydocs/internal/store"
 )
 
+var (
+	indexNoPrune     bool
+	indexFailFast    bool
+	indexForceRehash bool
+	indexReportPath  string
+	indexDryRun      bool
+	indexJSON        bool
+	indexCollection  string
+	indexInclude     []string
+	indexExclude     []string
+	indexMaxTokens   int
+	indexOverlap     int
+	indexMinTokens   int
+	indexTemplate    string
+	indexSeparate    bool
+	indexObsidian    bool
+)
+
 // NewIndexCmd creates the index command.
 func NewIndexCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "index [directory]",
 		Short: "Index a directory of markdown files",
 		Args:  cobra.MinimumNArgs(1),
 		RunE:  runIndex,
 	}
+
+	cmd.Flags().BoolVar(&indexNoPrune, "no-prune", false, "Keep documents whose files no longer exist under the directory")
+	cmd.Flags().BoolVar(&indexFailFast, "fail-fast", false, "Stop at the first file that fails to index")
+	cmd.Flags().BoolVar(&indexForceRehash, "force-rehash", false, "Read and hash every file, even if its size and modification time are unchanged")
+	cmd.Flags().StringVar(&indexReportPath, "report", "", "Write a JSON report of the run, including failed files, to this path")
+	cmd.Flags().BoolVar(&indexDryRun, "dry-run", false, "Report which files would be added, updated or pruned without writing to the database")
+	cmd.Flags().BoolVar(&indexJSON, "json", false, "With --dry-run, print the plan as JSON")
+	addIndexFlags(cmd)
+
+	return cmd
+}
+
+// addIndexFlags registers the flags shared by index and watch.
+func addIndexFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&indexCollection, "collection", "c", store.DefaultCollection, "Collection to index the documents into")
+	cmd.Flags().StringArrayVar(&indexInclude, "include", nil, "Only index files matching this glob, relative to the directory (repeatable)")
+	cmd.Flags().StringArrayVar(&indexExclude, "exclude", nil, "Skip files and directories matching this glob, relative to the directory (repeatable)")
+	cmd.Flags().IntVar(&indexMaxTokens, "max-chunk-tokens", 0, "Split sections longer than this many tokens on paragraph, list and code block boundaries (0 disables splitting)")
+	cmd.Flags().IntVar(&indexOverlap, "chunk-overlap", 0, "Repeat up to this many tokens from the end of one piece of a split section at the start of the next")
+	cmd.Flags().IntVar(&indexMinTokens, "min-chunk-tokens", 0, "Fold sections shorter than this many tokens into their parent or next sibling (0 disables folding)")
+	cmd.Flags().BoolVar(&indexSeparate, "separate-code", false, "Index fenced code blocks as chunks of their own, under the heading path of their section")
+	cmd.Flags().BoolVar(&indexObsidian, "obsidian", false, "Treat the directory as an Obsidian vault: resolve [[wikilinks]] and ![[embeds]], and read aliases and #tags")
+	cmd.Flags().StringVar(&indexTemplate, "embed-template", "", "Go template for the text embedded for each chunk, over .Title, .Aliases, .Path, .HeadingPath and .Content, or \"context\" for the title, aliases and heading path before the content (default: the content alone)")
+}
+
+// contextTemplateName selects chunker.ContextTemplate with --embed-template.
+const contextTemplateName = "context"
+
+// chunkerOptions returns the chunking options set by the flags, counting
+// tokens with the embedder's tokenizer if there is one.
+func chunkerOptions(emb indexEmbedder) chunker.Options {
+	opts := chunker.Options{MaxTokens: indexMaxTokens, OverlapTokens: indexOverlap, MinTokens: indexMinTokens, SeparateCode: indexSeparate, Obsidian: indexObsidian, Template: indexTemplate}
+	if opts.Template == contextTemplateName {
+		opts.Template = chunker.ContextTemplate
+	}
+	if emb != nil {
+		opts.CountTokens = emb.CountTokens
+	}
+	return opts
+}
+
+// indexSettings describes the chunker and the flags that affect how documents
+// are chunked and embedded. Documents indexed with other settings are
+// re-indexed even if their content is unchanged.
+func indexSettings() string {
+	return fmt.Sprintf("chunker=%d %s", chunker.Version, chunkerOptions(nil))
+}
+
+// sourceOptions returns the options a source is indexed with, to be
+// remembered for reindex.
+func sourceOptions() store.SourceOptions {
+	return store.SourceOptions{
+		Include:        indexInclude,
+		Exclude:        indexExclude,
+		MaxChunkTokens: indexMaxTokens,
+		ChunkOverlap:   indexOverlap,
+		MinChunkTokens: indexMinTokens,
+		SeparateCode:   indexSeparate,
+		Obsidian:       indexObsidian,
+		EmbedTemplate:  indexTemplate,
+	}
 }
 
 func runIndex(cmd *cobra.Command, args []string) error {
@@ -41,23 +126,153 @@ func runIndex(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	matcher, err := newIndexMatcher()
+	if err != nil {
+		return err
+	}
+	if err := chunkerOptions(nil).Validate(); err != nil {
+		return err
+	}
+
+	if indexDryRun {
+		return runIndexPlan(absDir, matcher)
+	}
+	if indexJSON {
+		return fmt.Errorf("--json requires --dry-run")
+	}
+
 	application, cfg, err := initializeApp()
 	if err != nil {
 		return err
 	}
 	defer application.Close()
 
-	logger.Info("starting indexing", "directory", absDir, "database", cfg.DBPath)
+	logger.Info("starting indexing", "directory", absDir, "database", cfg.DBPath, "collection", indexCollection)
 	logger.Debug("configuration", "model", cfg.ModelPath, "onnxLib", cfg.OnnxLibraryPath)
 
-	files := collectMarkdownFiles(absDir)
-	stats := processFiles(absDir, files, application.Store, application.Embedder, chunker.New())
+	stats, pruned, err := indexDirectory(context.Background(), absDir, matcher, application.Store, application.Embedder)
+	if err != nil {
+		return err
+	}
+
+	printIndexSummary(stats, pruned)
+
+	if indexReportPath != "" {
+		if err := writeIndexReport(indexReportPath, absDir, stats, pruned); err != nil {
+			return err
+		}
+	}
+
+	if failures := stats.sortedFailures(); len(failures) > 0 {
+		cmd.SilenceUsage = true
+		return fmt.Errorf("%d files failed to index", len(failures))
+	}
+	return nil
+}
+
+// newIndexMatcher builds the ignore matcher from the --include and --exclude flags.
+func newIndexMatcher() (*ignore.Matcher, error) {
+	return ignore.New(ignore.Options{
+		IgnoreFiles: ignore.DefaultFiles,
+		Include:     indexInclude,
+		Exclude:     indexExclude,
+	})
+}
+
+// indexDirectory registers absDir as a source along with the index options,
+// indexes every markdown file under it into the collection named by
+// --collection and, unless --no-prune is set, removes documents whose files
+// are gone. It returns the indexing stats and the number of pruned documents.
+func indexDirectory(ctx context.Context, absDir string, matcher *ignore.Matcher, st *store.Store, emb indexEmbedder) (*indexStats, int, error) {
+	collectionID, err := st.EnsureCollection(ctx, indexCollection)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	sourceID, err := st.EnsureSource(ctx, absDir, collectionID)
+	if err != nil {
+		return nil, 0, err
+	}
+	// Remembered so that reindex can repeat the run
+	if err := st.SetSourceOptions(ctx, sourceID, sourceOptions()); err != nil {
+		return nil, 0, err
+	}
+
+	files := collectMarkdownFiles(absDir, matcher)
+	stats := processFiles(absDir, sourceID, collectionID, files, st, emb, chunker.NewWithOptions(chunkerOptions(emb)))
+
+	// A run stopped by --fail-fast did not look at every file, so nothing is pruned
+	aborted := indexFailFast && len(stats.sortedFailures()) > 0
 
+	pruned := 0
+	if !indexNoPrune && !aborted {
+		pruned, err = pruneDocuments(ctx, st, absDir, indexCollection, files)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return stats, pruned, nil
+}
+
+func printIndexSummary(stats *indexStats, pruned int) {
 	fmt.Printf("\r\033[K")
 	fmt.Printf("Indexing complete!\n")
 	fmt.Printf("  Indexed: %d files\n", stats.indexed.Load())
 	fmt.Printf("  Skipped: %d unchanged files\n", stats.skipped.Load())
+	if reused := stats.reusedChunks.Load(); reused > 0 {
+		fmt.Printf("  Reused:  %d previously embedded chunks\n", reused)
+	}
+	if !indexNoPrune {
+		fmt.Printf("  Pruned:  %d missing files\n", pruned)
+	}
+
+	failures := stats.sortedFailures()
+	if len(failures) == 0 {
+		return
+	}
+	fmt.Printf("  Failed:  %d files\n", len(failures))
+	for _, f := range failures {
+		fmt.Printf("    %s (%s): %v\n", f.Path, f.Stage, f.Err)
+	}
+}
 
+// indexReport is the JSON document written by --report.
+type indexReport struct {
+	Directory  string               `json:"directory"`
+	Collection string               `json:"collection"`
+	Indexed    int                  `json:"indexed"`
+	Skipped    int                  `json:"skipped"`
+	Pruned     int                  `json:"pruned"`
+	Failures   []indexReportFailure `json:"failures"`
+}
+
+type indexReportFailure struct {
+	Path  string `json:"path"`
+	Stage string `json:"stage"`
+	Error string `json:"error"`
+}
+
+func writeIndexReport(path, absDir string, stats *indexStats, pruned int) error {
+	report := indexReport{
+		Directory:  absDir,
+		Collection: indexCollection,
+		Indexed:    int(stats.indexed.Load()),
+		Skipped:    int(stats.skipped.Load()),
+		Pruned:     pruned,
+		Failures:   []indexReportFailure{},
+	}
+	for _, f := range stats.sortedFailures() {
+		report.Failures = append(report.Failures, indexReportFailure{Path: f.Path, Stage: f.Stage, Error: f.Err.Error()})
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
 	return nil
 }
 
@@ -79,7 +294,7 @@ func resolveDirectory(dir string) (string, error) {
 }
 
 func initializeApp() (*app.App, app.Config, error) {
-	cfg, err := app.DefaultPaths(OnnxLibraryPath)
+	cfg, err := app.DefaultPaths(OnnxLibraryPath, DBPath)
 	if err != nil {
 		return nil, app.Config{}, fmt.Errorf("failed to resolve paths: %w", err)
 	}
@@ -92,29 +307,173 @@ func initializeApp() (*app.App, app.Config, error) {
 	return application, cfg, nil
 }
 
-func collectMarkdownFiles(absDir string) []string {
+func collectMarkdownFiles(absDir string, matcher *ignore.Matcher) []string {
+	return walkMarkdownFiles(absDir, absDir, matcher, nil)
+}
+
+// walkMarkdownFiles returns the markdown files below start that are not
+// ignored, evaluating ignore rules relative to absDir. If onDir is non-nil it
+// is called for every directory that is descended into.
+func walkMarkdownFiles(absDir, start string, matcher *ignore.Matcher, onDir func(path string)) []string {
 	var files []string
-	_ = filepath.WalkDir(absDir, func(path string, d fs.DirEntry, err error) error {
+	_ = filepath.WalkDir(start, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return nil
 		}
-		if !d.IsDir() && strings.HasSuffix(strings.ToLower(d.Name()), ".md") {
-			files = append(files, path)
+
+		relPath, err := filepath.Rel(absDir, path)
+		if err != nil {
+			return nil
+		}
+		relPath = filepath.ToSlash(relPath)
+
+		if d.IsDir() {
+			if relPath != "." {
+				if skip, reason := matcher.Match(relPath, true); skip {
+					logger.Debug("skipping ignored directory", "path", path, "reason", reason)
+					return filepath.SkipDir
+				}
+			}
+			if err := matcher.LoadDir(path, relPath); err != nil {
+				logger.Warn("failed to read ignore files", "directory", path, "error", err)
+			}
+			if onDir != nil {
+				onDir(path)
+			}
+			return nil
+		}
+
+		if !isMarkdownFile(path) {
+			return nil
+		}
+		if skip, reason := matcher.Match(relPath, false); skip {
+			logger.Debug("skipping ignored file", "path", path, "reason", reason)
+			return nil
 		}
+		files = append(files, path)
 		return nil
 	})
 	return files
 }
 
+func isMarkdownFile(path string) bool {
+	return strings.HasSuffix(strings.ToLower(path), ".md")
+}
+
+// pruneDocuments removes documents of the collection under absDir whose files
+// were not found by the walk, i.e. files that have been deleted or moved since indexing.
+func pruneDocuments(ctx context.Context, st *store.Store, absDir, collection string, files []string) (int, error) {
+	missing, err := missingDocuments(ctx, st, absDir, collection, files)
+	if err != nil {
+		return 0, err
+	}
+
+	pruned := 0
+	for _, d := range missing {
+		if err := st.DeleteDocument(ctx, d.ID); err != nil {
+			return pruned, fmt.Errorf("failed to prune %s: %w", d.FilePath, err)
+		}
+		logger.Debug("pruned missing document", "path", d.FilePath)
+		pruned++
+	}
+
+	return pruned, nil
+}
+
+// missingDocuments returns the documents of the collection under absDir whose
+// files are not among files.
+func missingDocuments(ctx context.Context, st *store.Store, absDir, collection string, files []string) ([]store.Document, error) {
+	docs, err := st.ListDocuments(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list documents: %w", err)
+	}
+
+	present := make(map[string]struct{}, len(files))
+	for _, f := range files {
+		present[f] = struct{}{}
+	}
+
+	var missing []store.Document
+	for _, d := range docs {
+		if d.Collection != collection || !isUnderDir(d.FilePath, absDir) {
+			continue
+		}
+		if _, ok := present[d.FilePath]; ok {
+			continue
+		}
+		missing = append(missing, d)
+	}
+	return missing, nil
+}
+
+// isUnderDir reports whether path is located inside dir.
+func isUnderDir(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// indexEmbedder is the part of the embedder used while indexing.
+type indexEmbedder interface {
+	Embed(texts []string) ([][]float32, error)
+	CountTokens(text string) int
+	ModelID() string
+}
+
+// Stages at which indexing a file can fail.
+const (
+	stageRead  = "read"
+	stageChunk = "chunk"
+	stageEmbed = "embed"
+	stageStore = "store"
+)
+
+// indexFailure records why a single file could not be indexed.
+type indexFailure struct {
+	Path  string
+	Stage string
+	Err   error
+}
+
+func (f *indexFailure) Error() string {
+	return fmt.Sprintf("failed to %s %s: %v", f.Stage, f.Path, f.Err)
+}
+
+func (f *indexFailure) Unwrap() error {
+	return f.Err
+}
+
 type indexStats struct {
-	processed atomic.Int32
-	indexed   atomic.Int32
-	skipped   atomic.Int32
+	processed    atomic.Int32
+	indexed      atomic.Int32
+	skipped      atomic.Int32
+	reusedChunks atomic.Int32 // embeddings taken from the previous version of a file or the cache
+
+	mu       sync.Mutex
+	failures []*indexFailure
+}
+
+func (s *indexStats) addFailure(f *indexFailure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, f)
+}
+
+// sortedFailures returns the recorded failures sorted by path.
+func (s *indexStats) sortedFailures() []*indexFailure {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	failures := append([]*indexFailure(nil), s.failures...)
+	sort.Slice(failures, func(i, j int) bool { return failures[i].Path < failures[j].Path })
+	return failures
 }
 
-func processFiles(absDir string, files []string, st *store.Store, emb interface {
-	Embed([]string) ([][]float32, error)
-}, ch *chunker.Chunker) *indexStats {
+// processFiles indexes files concurrently, recording every failure in the
+// returned stats. With --fail-fast the first failure stops the remaining files.
+func processFiles(absDir string, sourceID, collectionID int, files []string, st *store.Store, emb indexEmbedder, ch *chunker.Chunker) *indexStats {
 	stats := &indexStats{}
 	var printMu sync.Mutex
 	totalFiles := len(files)
@@ -125,7 +484,26 @@ func processFiles(absDir string, files []string, st *store.Store, emb interface
 	for _, path := range files {
 		path := path
 		g.Go(func() error {
-			return processFile(ctx, path, absDir, totalFiles, st, emb, ch, stats, &printMu)
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			err := processFile(ctx, path, absDir, sourceID, collectionID, totalFiles, st, emb, ch, stats, &printMu)
+			var failure *indexFailure
+			if !errors.As(err, &failure) {
+				return err
+			}
+			// Files interrupted by an earlier failure under --fail-fast are not failures themselves
+			if errors.Is(err, context.Canceled) && ctx.Err() != nil {
+				return nil
+			}
+
+			stats.addFailure(failure)
+			if indexFailFast {
+				return err
+			}
+			logger.Debug("failed to index file", "path", path, "stage", failure.Stage, "error", failure.Err)
+			return nil
 		})
 	}
 
@@ -133,82 +511,185 @@ func processFiles(absDir string, files []string, st *store.Store, emb interface
 	return stats
 }
 
-func processFile(ctx context.Context, path, absDir string, totalFiles int, st *store.Store, emb interface {
-	Embed([]string) ([][]float32, error)
-}, ch *chunker.Chunker, stats *indexStats, printMu *sync.Mutex) error {
-	content, err := os.ReadFile(path)
+// processFile indexes one file of the source rooted at absDir.
+func processFile(ctx context.Context, path, absDir string, sourceID, collectionID, totalFiles int, st *store.Store, emb indexEmbedder, ch *chunker.Chunker, stats *indexStats, printMu *sync.Mutex) error {
+	relPath, err := filepath.Rel(absDir, path)
+	if err != nil {
+		return &indexFailure{Path: path, Stage: stageRead, Err: err}
+	}
+	relPath = filepath.ToSlash(relPath)
+
+	info, err := os.Stat(path)
 	if err != nil {
-		logger.Warn("skipping unreadable file", "path", path, "error", err)
+		return &indexFailure{Path: path, Stage: stageRead, Err: err}
+	}
+
+	// A file whose size and modification time are unchanged is skipped
+	// without reading it; otherwise the content hash decides.
+	settings := indexSettings()
+	if !indexForceRehash && st.FileStatUnchanged(ctx, sourceID, collectionID, relPath, info.Size(), info.ModTime(), settings) {
+		stats.skipped.Add(1)
 		return nil
 	}
 
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return &indexFailure{Path: path, Stage: stageRead, Err: err}
+	}
+
 	hash := sha256.Sum256(content)
 	hashStr := hex.EncodeToString(hash[:])
 
-	if st.FileUnchanged(ctx, path, hashStr) {
+	if st.FileUnchangedInSource(ctx, sourceID, collectionID, relPath, hashStr, settings) {
+		if err := st.UpdateFileStat(ctx, sourceID, relPath, info.Size(), info.ModTime()); err != nil {
+			logger.Debug("failed to update file stat", "path", path, "error", err)
+		}
 		stats.skipped.Add(1)
 		return nil
 	}
 
-	if err := st.DeleteDocumentByPath(ctx, path); err != nil {
-		logger.Warn("failed to delete existing document", "path", path, "error", err)
-	}
-
-	docID, err := st.InsertDocument(ctx, path, hashStr, extractTitle(content, path))
+	// Front matter is kept out of the chunks and stored as document metadata.
+	// A block that does not parse may be text between thematic breaks, so it
+	// is indexed as part of the body.
+	meta, body, err := frontmatter.Parse(content)
 	if err != nil {
-		return fmt.Errorf("failed to insert document %s: %w", path, err)
+		logger.Warn("indexing invalid front matter as text", "path", path, "error", err)
 	}
 
-	chunks, err := ch.ChunkFile(content)
+	// The embedded text puts each chunk in the context of its document
+	document := embedDocument(meta, body, path, relPath)
+	chunks, err := ch.ChunkDocument(document, body)
 	if err != nil {
-		return fmt.Errorf("failed to chunk %s: %w", path, err)
+		return &indexFailure{Path: path, Stage: stageChunk, Err: err}
+	}
+	links, anchors := ch.Links(body)
+	if indexObsidian {
+		meta = vaultMetadata(meta, document.Aliases, ch.Tags(body))
 	}
 
-	if len(chunks) == 0 {
-		stats.indexed.Add(1)
-		return nil
+	texts := make([]string, len(chunks))
+	for i, c := range chunks {
+		if texts[i], err = ch.EmbedText(document, c); err != nil {
+			return &indexFailure{Path: path, Stage: stageEmbed, Err: err}
+		}
 	}
 
+	// Embed before touching the database so a failure leaves the previous
+	// version of the document intact.
 	embedStart := time.Now()
-	if err := embedAndInsertChunks(ctx, docID, chunks, st, emb, path); err != nil {
-		return err
+	known := knownEmbeddings(ctx, st, sourceID, relPath, emb.ModelID(), texts)
+	storeChunks, embeddings, reused, err := embedChunks(chunks, texts, emb, known)
+	if err != nil {
+		return &indexFailure{Path: path, Stage: stageEmbed, Err: err}
+	}
+
+	doc := store.DocumentVersion{
+		SourceID:     sourceID,
+		CollectionID: collectionID,
+		FilePath:     relPath,
+		Hash:         hashStr,
+		Title:        document.Title,
+		Model:        emb.ModelID(),
+		Size:         info.Size(),
+		ModTime:      info.ModTime(),
+		Metadata:     meta,
+		Settings:     settings,
+	}
+	doc.Links, doc.Anchors = documentLinks(relPath, links, anchors)
+	if _, err := st.ReplaceDocument(ctx, doc, storeChunks, embeddings); err != nil {
+		return &indexFailure{Path: path, Stage: stageStore, Err: err}
 	}
 
 	stats.indexed.Add(1)
+	stats.reusedChunks.Add(int32(reused))
+	if len(chunks) == 0 {
+		return nil
+	}
 	newProcessed := stats.processed.Add(1)
 
 	printProgress(printMu, newProcessed, totalFiles, path, absDir, embedStart)
 	return nil
 }
 
-func embedAndInsertChunks(ctx context.Context, docID int, chunks []chunker.Chunk, st *store.Store, emb interface {
-	Embed([]string) ([][]float32, error)
-}, path string) error {
-	texts := make([]string, len(chunks))
-	for i, c := range chunks {
-		texts[i] = c.Content
+// knownEmbeddings collects the embeddings that need not be computed again for
+// the embedded texts of a file: those of its previous version and those in the
+// embedding cache, keyed by content hash. Lookup errors only cost re-embedding.
+func knownEmbeddings(ctx context.Context, st *store.Store, sourceID int, relPath, model string, texts []string) map[string][]float32 {
+	known, err := st.ChunkEmbeddings(ctx, sourceID, relPath, model)
+	if err != nil {
+		logger.Debug("failed to load previous embeddings", "path", relPath, "error", err)
+		known = make(map[string][]float32)
+	}
+
+	var missing []string
+	for _, text := range texts {
+		if hash := contentHash(text); known[hash] == nil {
+			missing = append(missing, hash)
+		}
 	}
 
-	embeddings, err := emb.Embed(texts)
+	cached, err := st.CachedEmbeddings(ctx, model, missing)
 	if err != nil {
-		return fmt.Errorf("failed to embed chunks for %s: %w", path, err)
+		logger.Debug("failed to load cached embeddings", "path", relPath, "error", err)
+	}
+	for hash, embedding := range cached {
+		known[hash] = embedding
+	}
+
+	return known
+}
+
+// embedChunks converts the chunks for storage, embedding texts[i] for
+// chunks[i]. Embeddings in existing (keyed by content hash) are reused and the
+// rest computed. It returns the number of reused embeddings.
+func embedChunks(chunks []chunker.Chunk, texts []string, emb indexEmbedder, existing map[string][]float32) ([]store.Chunk, [][]float32, int, error) {
+	if len(chunks) == 0 {
+		return nil, nil, 0, nil
 	}
 
 	storeChunks := make([]store.Chunk, len(chunks))
+	embeddings := make([][]float32, len(chunks))
+	var pending []string
+	var missing []int
 	for i, c := range chunks {
 		storeChunks[i] = store.Chunk{
 			HeadingPath:  c.HeadingPath,
 			HeadingLevel: c.HeadingLevel,
 			Content:      c.Content,
 			StartLine:    c.StartLine,
+			TokenCount:   emb.CountTokens(texts[i]),
+			ContentHash:  contentHash(texts[i]),
+			Kind:         c.Kind,
+			Lang:         c.Lang,
+		}
+		if embedding, ok := existing[storeChunks[i].ContentHash]; ok {
+			embeddings[i] = embedding
+			continue
 		}
+		pending = append(pending, texts[i])
+		missing = append(missing, i)
 	}
 
-	if err := st.InsertChunks(ctx, docID, storeChunks, embeddings); err != nil {
-		return fmt.Errorf("failed to insert chunks: %w", err)
+	if len(pending) > 0 {
+		computed, err := emb.Embed(pending)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		if len(computed) != len(pending) {
+			return nil, nil, 0, fmt.Errorf("expected %d embeddings, got %d", len(pending), len(computed))
+		}
+		for j, i := range missing {
+			embeddings[i] = computed[j]
+		}
 	}
 
-	return nil
+	return storeChunks, embeddings, len(chunks) - len(pending), nil
+}
+
+// contentHash identifies the text of a chunk.
+func contentHash(text string) string {
+	hash := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(hash[:])
 }
 
 func printProgress(printMu *sync.Mutex, processed int32, totalFiles int, path, absDir string, embedStart time.Time) {
@@ -226,6 +707,74 @@ func printProgress(printMu *sync.Mutex, processed int32, totalFiles int, path, a
 	fmt.Printf("\r\033[K[%d/%d] %s (Embed: %v)", processed, totalFiles, displayName, time.Since(embedStart).Round(time.Millisecond))
 }
 
+// embedDocument describes the document a file's chunks are embedded in the
+// context of.
+func embedDocument(meta frontmatter.Metadata, body []byte, path, relPath string) chunker.Document {
+	var aliases []string
+	if indexObsidian {
+		aliases = meta.Aliases()
+	}
+	return chunker.Document{Title: documentTitle(meta, body, path), Path: relPath, Aliases: aliases}
+}
+
+// vaultMetadata adds what an Obsidian note says about itself outside of its
+// front matter keys to its metadata. Inline tags join the tags key, so that
+// --tag matches them, and aliases are stored as a list under aliases, where
+// wikilinks are resolved against them.
+func vaultMetadata(meta frontmatter.Metadata, aliases, inlineTags []string) frontmatter.Metadata {
+	out := make(frontmatter.Metadata, len(meta)+2)
+	maps.Copy(out, meta)
+
+	if len(aliases) > 0 {
+		list := make([]any, len(aliases))
+		for i, alias := range aliases {
+			list[i] = alias
+		}
+		out["aliases"] = list
+	}
+
+	var tags []any
+	seen := make(map[string]bool)
+	addTag := func(tag string) {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "#")
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	switch v := meta["tags"].(type) {
+	case string:
+		addTag(v)
+	case []any:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				addTag(s)
+			} else {
+				tags = append(tags, item)
+			}
+		}
+	}
+	for _, tag := range inlineTags {
+		addTag(tag)
+	}
+	if len(tags) > 0 {
+		out["tags"] = tags
+	}
+
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// documentTitle prefers the front matter title over the first heading.
+func documentTitle(meta frontmatter.Metadata, body []byte, path string) string {
+	if title := meta.Title(); title != "" {
+		return title
+	}
+	return extractTitle(body, path)
+}
+
 func extractTitle(content []byte, path string) string {
 	lines := strings.Split(string(content), "\n")
 	for _, line := range lines {
@@ -0,0 +1,276 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mattdennewitz/mcpmydocs/internal/chunker"
+	"github.com/mattdennewitz/mcpmydocs/internal/store"
+)
+
+var (
+	linksBroken     bool
+	linksCollection string
+)
+
+// NewLinksCmd creates the links command.
+func NewLinksCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "links [file]",
+		Short: "List the links in a document, or the broken links in the index",
+		Long: `List the links in an indexed document and where they lead.
+
+With --broken, list the links in all indexed documents that point to a
+document that is not indexed or to a heading it does not have.`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if linksBroken {
+				return cobra.NoArgs(cmd, args)
+			}
+			return cobra.ExactArgs(1)(cmd, args)
+		},
+		RunE: runLinks,
+	}
+
+	cmd.Flags().BoolVar(&linksBroken, "broken", false, "Report broken internal links instead")
+	cmd.Flags().StringVarP(&linksCollection, "collection", "c", "", "With --broken, only report on this collection (default: all collections)")
+
+	return cmd
+}
+
+// NewBacklinksCmd creates the backlinks command.
+func NewBacklinksCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "backlinks [file]",
+		Short: "List the documents that link to a document",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runBacklinks,
+	}
+}
+
+func runLinks(cmd *cobra.Command, args []string) error {
+	if linksBroken {
+		return printLinkReport(func(ctx context.Context, st *store.Store) (string, error) {
+			return brokenLinksReport(ctx, st, linksCollection)
+		})
+	}
+	return printLinkReport(func(ctx context.Context, st *store.Store) (string, error) {
+		return linksReport(ctx, st, args[0], false)
+	})
+}
+
+func runBacklinks(cmd *cobra.Command, args []string) error {
+	return printLinkReport(func(ctx context.Context, st *store.Store) (string, error) {
+		return linksReport(ctx, st, args[0], true)
+	})
+}
+
+func printLinkReport(report func(context.Context, *store.Store) (string, error)) error {
+	dbPath, err := existingDBPath()
+	if err != nil {
+		return err
+	}
+
+	st, err := store.NewReadOnly(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer st.Close()
+
+	output, err := report(context.Background(), st)
+	if err != nil {
+		return err
+	}
+	fmt.Print(output)
+	return nil
+}
+
+// linksReport lists the links in the document at file, or with backlinks the
+// links to it. It is shared by the links and backlinks commands and tools.
+func linksReport(ctx context.Context, st *store.Store, file string, backlinks bool) (string, error) {
+	absPath, err := filepath.Abs(file)
+	if err != nil {
+		return "", fmt.Errorf("invalid path: %w", err)
+	}
+	state, err := st.FileState(ctx, absPath)
+	if err != nil {
+		return "", err
+	}
+	if state == nil {
+		return "", fmt.Errorf("%s is not indexed", absPath)
+	}
+
+	if !backlinks {
+		links, err := st.Links(ctx, absPath)
+		if err != nil {
+			return "", err
+		}
+		if len(links) == 0 {
+			return fmt.Sprintf("No links in %s\n", absPath), nil
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "%d links in %s:\n", len(links), absPath)
+		for _, l := range links {
+			fmt.Fprintf(&b, "  line %d (%s): %s -> %s\n", l.Line, l.HeadingPath, linkSource(l), linkTarget(l))
+		}
+		return b.String(), nil
+	}
+
+	links, err := st.Backlinks(ctx, absPath)
+	if err != nil {
+		return "", err
+	}
+	if len(links) == 0 {
+		return fmt.Sprintf("No documents link to %s\n", absPath), nil
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d links to %s:\n", len(links), absPath)
+	for _, l := range links {
+		fmt.Fprintf(&b, "  %s:%d (%s): %s", l.FilePath, l.Line, l.HeadingPath, linkSource(l))
+		if l.Broken() {
+			fmt.Fprintf(&b, " -> %s", linkTarget(l))
+		}
+		b.WriteString("\n")
+	}
+	return b.String(), nil
+}
+
+// brokenLinksReport lists the broken internal links in a collection, or in
+// all collections if it is empty.
+func brokenLinksReport(ctx context.Context, st *store.Store, collection string) (string, error) {
+	if collection != "" {
+		if _, err := st.CollectionID(ctx, collection); err != nil {
+			return "", err
+		}
+	}
+
+	links, err := st.BrokenLinks(ctx, collection)
+	if err != nil {
+		return "", err
+	}
+	if len(links) == 0 {
+		return "No broken links\n", nil
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d broken links:\n", len(links))
+	for _, l := range links {
+		fmt.Fprintf(&b, "  %s:%d: %s -> %s\n", l.FilePath, l.Line, linkSource(l), linkTarget(l))
+	}
+	return b.String(), nil
+}
+
+// linkSource returns a link as written: wikilinks as they are, and other
+// links in Markdown link syntax.
+func linkSource(l store.LinkInfo) string {
+	if strings.HasPrefix(l.Destination, "[[") || strings.HasPrefix(l.Destination, "![[") {
+		return l.Destination
+	}
+	return fmt.Sprintf("[%s](%s)", l.Text, l.Destination)
+}
+
+// linkTarget describes where a link leads, or why it is broken.
+func linkTarget(l store.LinkInfo) string {
+	switch {
+	case l.External():
+		return "external"
+	case l.TargetTitle == "":
+		return "broken: " + l.TargetPath + " is not indexed"
+	case l.Fragment != "" && l.TargetHeading == "":
+		return fmt.Sprintf("broken: %s has no heading #%s", l.TargetPath, l.Fragment)
+	case l.TargetHeading != "":
+		return l.TargetPath + " (" + l.TargetHeading + ")"
+	}
+	return l.TargetPath
+}
+
+// documentLinks converts the links and anchors found in the document at
+// relPath for storage, resolving link destinations within the source.
+func documentLinks(relPath string, links []chunker.Link, anchors []chunker.Anchor) ([]store.Link, []store.Anchor) {
+	storeLinks := make([]store.Link, len(links))
+	for i, l := range links {
+		storeLinks[i] = store.Link{
+			HeadingPath: l.HeadingPath,
+			Line:        l.Line,
+			Text:        l.Text,
+			Destination: l.Destination,
+		}
+		if l.Wiki {
+			storeLinks[i].TargetPath, storeLinks[i].TargetName, storeLinks[i].Fragment = resolveWikiLink(relPath, l)
+		} else {
+			storeLinks[i].TargetPath, storeLinks[i].Fragment = resolveLink(relPath, l.Destination)
+		}
+	}
+	storeAnchors := make([]store.Anchor, len(anchors))
+	for i, a := range anchors {
+		storeAnchors[i] = store.Anchor{Slug: a.Slug, HeadingPath: a.HeadingPath, Line: a.Line}
+	}
+	return storeLinks, storeAnchors
+}
+
+// resolveLink resolves a link destination in the document at relPath to the
+// path of a markdown file relative to the source root, and a heading anchor.
+// A destination starting with a slash is relative to the source root. URLs
+// and links to other kinds of files resolve to no path.
+func resolveLink(relPath, destination string) (string, string) {
+	u, err := url.Parse(destination)
+	if err != nil || u.Scheme != "" || u.Host != "" {
+		return "", ""
+	}
+
+	fragment := strings.ToLower(u.Fragment)
+	if u.Path == "" {
+		// A link within the document
+		if fragment == "" {
+			return "", ""
+		}
+		return relPath, fragment
+	}
+	if !isMarkdownFile(u.Path) {
+		return "", ""
+	}
+
+	if strings.HasPrefix(u.Path, "/") {
+		return path.Clean(strings.TrimPrefix(u.Path, "/")), fragment
+	}
+	return path.Join(path.Dir(relPath), u.Path), fragment
+}
+
+// resolveWikiLink resolves an Obsidian wikilink in the document at relPath.
+// Links to a heading of the same note resolve to its path; links to other
+// notes resolve to the note's name, which is looked up when links are
+// listed; links to attachments such as images resolve to neither.
+func resolveWikiLink(relPath string, l chunker.Link) (target, name, fragment string) {
+	// Obsidian links to headings by their text, and to blocks with "^id"
+	if heading := l.Heading; heading != "" && !strings.HasPrefix(heading, "^") {
+		// Nested headings are written [[Note#Section#Subsection]]
+		if i := strings.LastIndex(heading, "#"); i >= 0 {
+			heading = heading[i+1:]
+		}
+		fragment = chunker.Slug(heading)
+	}
+
+	page := strings.TrimPrefix(l.Page, "/")
+	switch {
+	case page == "":
+		return relPath, "", fragment
+	case isMarkdownFile(page):
+		return "", strings.TrimSuffix(page, path.Ext(page)), fragment
+	case vaultAttachments[strings.ToLower(path.Ext(page))]:
+		return "", "", ""
+	}
+	return "", page, fragment
+}
+
+// vaultAttachments are the extensions of the files other than notes that
+// Obsidian links to and embeds.
+var vaultAttachments = map[string]bool{
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".bmp": true, ".svg": true, ".webp": true, ".avif": true,
+	".mp3": true, ".wav": true, ".m4a": true, ".ogg": true, ".flac": true, ".webm": true, ".3gp": true,
+	".mp4": true, ".ogv": true, ".mov": true, ".mkv": true,
+	".pdf": true, ".canvas": true, ".base": true,
+}
@@ -0,0 +1,225 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mattdennewitz/mcpmydocs/internal/chunker"
+	"github.com/mattdennewitz/mcpmydocs/internal/embedder"
+	"github.com/mattdennewitz/mcpmydocs/internal/frontmatter"
+	"github.com/mattdennewitz/mcpmydocs/internal/ignore"
+	"github.com/mattdennewitz/mcpmydocs/internal/logger"
+	"github.com/mattdennewitz/mcpmydocs/internal/paths"
+	"github.com/mattdennewitz/mcpmydocs/internal/store"
+)
+
+// indexPlan is what an index run would do, as reported by --dry-run.
+type indexPlan struct {
+	Directory  string               `json:"directory"`
+	Collection string               `json:"collection"`
+	Added      []plannedFile        `json:"added"`
+	Updated    []plannedFile        `json:"updated"`
+	Unchanged  []string             `json:"unchanged"`
+	Pruned     []string             `json:"pruned"`
+	Chunks     int                  `json:"chunks"` // chunks in added and updated files
+	Failures   []indexReportFailure `json:"failures"`
+}
+
+type plannedFile struct {
+	Path   string `json:"path"`
+	Chunks int    `json:"chunks"`
+}
+
+// runIndexPlan prints what indexing absDir would do. It only reads the
+// database, and loads the tokenizer but not the models.
+func runIndexPlan(absDir string, matcher *ignore.Matcher) error {
+	dbPath, err := paths.ResolveDBPath(DBPath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve paths: %w", err)
+	}
+
+	// Without a database every file would be added
+	var st *store.Store
+	if _, err := os.Stat(dbPath); err == nil {
+		st, err = store.NewReadOnly(dbPath)
+		if err != nil {
+			return fmt.Errorf("failed to open database: %w", err)
+		}
+		defer st.Close()
+	}
+
+	// Chunks are split by the model's token counts, or by words without a tokenizer
+	var countTokens func(string) int
+	if modelPath, err := paths.ResolveModelPath(); err == nil {
+		if tok, err := embedder.NewTokenizer(modelPath); err == nil {
+			countTokens = tok.CountTokens
+		} else {
+			logger.Warn("estimating chunks by counting words", "error", err)
+		}
+	}
+
+	plan, err := planIndex(context.Background(), absDir, matcher, st, countTokens)
+	if err != nil {
+		return err
+	}
+
+	if indexJSON {
+		data, err := json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode plan: %w", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	fmt.Print(formatIndexPlan(plan))
+	return nil
+}
+
+// planIndex sorts the files under absDir the way indexDirectory would treat
+// them, counting tokens with countTokens. st may be nil if the database does
+// not exist yet, and countTokens if there is no tokenizer.
+func planIndex(ctx context.Context, absDir string, matcher *ignore.Matcher, st *store.Store, countTokens func(string) int) (*indexPlan, error) {
+	plan := &indexPlan{
+		Directory:  absDir,
+		Collection: indexCollection,
+		Added:      []plannedFile{},
+		Updated:    []plannedFile{},
+		Unchanged:  []string{},
+		Pruned:     []string{},
+		Failures:   []indexReportFailure{},
+	}
+
+	collectionID := -1
+	if st != nil {
+		id, err := st.CollectionID(ctx, indexCollection)
+		switch {
+		case err == nil:
+			collectionID = id
+		case !errors.Is(err, store.ErrCollectionNotFound):
+			return nil, err
+		}
+		// The directories index would refuse to register
+		if err := st.CheckSource(ctx, absDir, collectionID); err != nil {
+			return nil, err
+		}
+	}
+
+	files := collectMarkdownFiles(absDir, matcher)
+	opts := chunkerOptions(nil)
+	if countTokens != nil {
+		opts.CountTokens = countTokens
+	}
+	ch := chunker.NewWithOptions(opts)
+	for _, path := range files {
+		var state *store.IndexedFile
+		if st != nil {
+			var err error
+			if state, err = st.FileState(ctx, path); err != nil {
+				return nil, fmt.Errorf("failed to look up %s: %w", path, err)
+			}
+		}
+		// A file indexed into another collection is moved, i.e. updated
+		indexed := state != nil && state.CollectionID == collectionID && state.Settings == indexSettings()
+
+		if indexed && !indexForceRehash {
+			info, err := os.Stat(path)
+			if err != nil {
+				plan.Failures = append(plan.Failures, indexReportFailure{Path: path, Stage: stageRead, Error: err.Error()})
+				continue
+			}
+			if state.Size == info.Size() && state.ModTime.Equal(info.ModTime()) {
+				plan.Unchanged = append(plan.Unchanged, path)
+				continue
+			}
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			plan.Failures = append(plan.Failures, indexReportFailure{Path: path, Stage: stageRead, Error: err.Error()})
+			continue
+		}
+		if indexed && state.Hash == contentHash(string(content)) {
+			plan.Unchanged = append(plan.Unchanged, path)
+			continue
+		}
+
+		// Invalid front matter is indexed as text, like index does
+		meta, body, _ := frontmatter.Parse(content)
+		relPath, _ := filepath.Rel(absDir, path)
+		chunks, err := ch.ChunkDocument(embedDocument(meta, body, path, filepath.ToSlash(relPath)), body)
+		if err != nil {
+			plan.Failures = append(plan.Failures, indexReportFailure{Path: path, Stage: stageChunk, Error: err.Error()})
+			continue
+		}
+
+		planned := plannedFile{Path: path, Chunks: len(chunks)}
+		plan.Chunks += len(chunks)
+		if state == nil {
+			plan.Added = append(plan.Added, planned)
+		} else {
+			plan.Updated = append(plan.Updated, planned)
+		}
+	}
+
+	if st != nil && !indexNoPrune {
+		missing, err := missingDocuments(ctx, st, absDir, indexCollection, files)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range missing {
+			plan.Pruned = append(plan.Pruned, d.FilePath)
+		}
+	}
+
+	return plan, nil
+}
+
+func formatIndexPlan(plan *indexPlan) string {
+	var b strings.Builder
+
+	display := func(path string) string {
+		if rel, err := filepath.Rel(plan.Directory, path); err == nil {
+			return rel
+		}
+		return path
+	}
+	chunks := func(files []plannedFile) int {
+		n := 0
+		for _, f := range files {
+			n += f.Chunks
+		}
+		return n
+	}
+
+	fmt.Fprintf(&b, "Dry run of indexing %s into collection %q; nothing was written.\n", plan.Directory, plan.Collection)
+	fmt.Fprintf(&b, "  Add:       %d files (%d chunks)\n", len(plan.Added), chunks(plan.Added))
+	fmt.Fprintf(&b, "  Update:    %d files (%d chunks)\n", len(plan.Updated), chunks(plan.Updated))
+	fmt.Fprintf(&b, "  Unchanged: %d files\n", len(plan.Unchanged))
+	if !indexNoPrune {
+		fmt.Fprintf(&b, "  Prune:     %d missing files\n", len(plan.Pruned))
+	}
+	if len(plan.Failures) > 0 {
+		fmt.Fprintf(&b, "  Failed:    %d files\n", len(plan.Failures))
+	}
+
+	for _, f := range plan.Added {
+		fmt.Fprintf(&b, "    + %s (%d chunks)\n", display(f.Path), f.Chunks)
+	}
+	for _, f := range plan.Updated {
+		fmt.Fprintf(&b, "    ~ %s (%d chunks)\n", display(f.Path), f.Chunks)
+	}
+	for _, p := range plan.Pruned {
+		fmt.Fprintf(&b, "    - %s\n", display(p))
+	}
+	for _, f := range plan.Failures {
+		fmt.Fprintf(&b, "    ! %s (%s): %s\n", display(f.Path), f.Stage, f.Error)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mattdennewitz/mcpmydocs/internal/logger"
+	"github.com/mattdennewitz/mcpmydocs/internal/store"
+)
+
+// NewReindexCmd creates the reindex command.
+func NewReindexCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "reindex",
+		Short: "Re-index every indexed directory with the options it was indexed with",
+		Args:  cobra.NoArgs,
+		RunE:  runReindex,
+	}
+
+	cmd.Flags().BoolVar(&indexNoPrune, "no-prune", false, "Keep documents whose files no longer exist")
+	cmd.Flags().BoolVar(&indexForceRehash, "force-rehash", false, "Read and hash every file, even if its size and modification time are unchanged")
+
+	return cmd
+}
+
+func runReindex(cmd *cobra.Command, args []string) error {
+	if _, err := existingDBPath(); err != nil {
+		return err
+	}
+
+	application, cfg, err := initializeApp()
+	if err != nil {
+		return err
+	}
+	defer application.Close()
+
+	logger.Info("starting reindex", "database", cfg.DBPath)
+
+	failed, missing, err := reindexSources(context.Background(), application.Store, application.Embedder)
+	if err != nil {
+		return err
+	}
+
+	if failed > 0 || missing > 0 {
+		cmd.SilenceUsage = true
+		return fmt.Errorf("%d files failed to index, %d directories not found", failed, missing)
+	}
+	return nil
+}
+
+// reindexSources indexes every registered source again, using its collection
+// and include/exclude patterns. Sources whose directory no longer exists are
+// skipped. It returns the number of failed files and missing directories.
+func reindexSources(ctx context.Context, st *store.Store, emb indexEmbedder) (int, int, error) {
+	sources, err := st.ListSources(ctx)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to list sources: %w", err)
+	}
+	if len(sources) == 0 {
+		fmt.Println("No indexed directories. Run 'mcpmydocs index <directory>' first.")
+		return 0, 0, nil
+	}
+
+	failed, missing := 0, 0
+	for _, src := range sources {
+		if info, err := os.Stat(src.Root); err != nil || !info.IsDir() {
+			fmt.Printf("Skipping %s: directory not found. Use 'mcpmydocs relocate' if it has moved, or 'mcpmydocs sources remove' to forget it.\n", src.Root)
+			missing++
+			continue
+		}
+
+		// The index helpers read the options from the flag variables
+		indexCollection, indexInclude, indexExclude = src.Collection, src.Options.Include, src.Options.Exclude
+		indexMaxTokens, indexOverlap = src.Options.MaxChunkTokens, src.Options.ChunkOverlap
+		indexMinTokens, indexTemplate = src.Options.MinChunkTokens, src.Options.EmbedTemplate
+		indexSeparate, indexObsidian = src.Options.SeparateCode, src.Options.Obsidian
+		matcher, err := newIndexMatcher()
+		if err != nil {
+			return failed, missing, fmt.Errorf("invalid options for %s: %w", src.Root, err)
+		}
+
+		fmt.Printf("Reindexing %s (collection %s)\n", src.Root, src.Collection)
+		stats, pruned, err := indexDirectory(ctx, src.Root, matcher, st, emb)
+		if err != nil {
+			return failed, missing, err
+		}
+		printIndexSummary(stats, pruned)
+		failed += len(stats.sortedFailures())
+	}
+
+	return failed, missing, nil
+}
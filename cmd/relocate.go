@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mattdennewitz/mcpmydocs/internal/store"
+)
+
+// NewRelocateCmd creates the relocate command.
+func NewRelocateCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "relocate [old-directory] [new-directory]",
+		Short: "Point an indexed directory at its new location without re-embedding",
+		Long: `Updates the root of an indexed directory after it has been moved, or when
+using a database built on another machine. Documents are stored relative to
+their root, so they resolve to the new location and are not re-embedded.`,
+		Args: cobra.ExactArgs(2),
+		RunE: runRelocate,
+	}
+}
+
+func runRelocate(cmd *cobra.Command, args []string) error {
+	// The old directory usually no longer exists, so it is only made absolute
+	oldDir, err := filepath.Abs(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to resolve directory: %w", err)
+	}
+
+	newDir, err := resolveDirectory(args[1])
+	if err != nil {
+		return err
+	}
+
+	dbPath, err := existingDBPath()
+	if err != nil {
+		return err
+	}
+
+	st, err := store.New(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer st.Close()
+
+	moved, err := st.RelocateSource(context.Background(), oldDir, newDir)
+	if err != nil {
+		return fmt.Errorf("failed to relocate: %w", err)
+	}
+
+	fmt.Printf("Relocated %s to %s (%d documents)\n", oldDir, newDir, moved)
+	return nil
+}
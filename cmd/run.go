@@ -5,12 +5,14 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 	"github.com/spf13/cobra"
 
 	"github.com/mattdennewitz/mcpmydocs/internal/app"
+	"github.com/mattdennewitz/mcpmydocs/internal/frontmatter"
 	"github.com/mattdennewitz/mcpmydocs/internal/logger"
 	"github.com/mattdennewitz/mcpmydocs/internal/search"
 	"github.com/mattdennewitz/mcpmydocs/internal/store"
@@ -20,6 +22,7 @@ import (
 var (
 	mcpStore  *store.Store
 	mcpSearch *search.Service
+	mcpDBPath string
 )
 
 // NewRunCmd creates the run command.
@@ -37,6 +40,20 @@ type SearchInput struct {
 	Limit      int    `json:"limit,omitempty" jsonschema:"Maximum number of results to return (default: 5, max: 20)"`
 	Rerank     *bool  `json:"rerank,omitempty" jsonschema:"Enable cross-encoder reranking for better relevance (default: true when available)"`
 	Candidates int    `json:"candidates,omitempty" jsonschema:"Number of candidates to fetch before reranking (default: 50, max: 100)"`
+	Mode       string `json:"mode,omitempty" jsonschema:"Retrieval mode: vector (semantic similarity; default), keyword (BM25, best for exact identifiers such as error codes, config keys and flags) or hybrid (both, fused)"`
+	Collection string `json:"collection,omitempty" jsonschema:"Only search documents in this collection (default: all collections)"`
+
+	Path           string            `json:"path,omitempty" jsonschema:"Only search files under this path prefix, or matching this glob such as guides/*.md; relative to the indexed directory unless absolute"`
+	Tags           []string          `json:"tags,omitempty" jsonschema:"Only search documents with all of these front matter tags"`
+	Metadata       map[string]string `json:"metadata,omitempty" jsonschema:"Only search documents whose front matter has these key/value pairs; an empty value only requires the key"`
+	MinLevel       int               `json:"min_level,omitempty" jsonschema:"Only search sections with a heading level of at least this (0 is the text before the first heading)"`
+	MaxLevel       int               `json:"max_level,omitempty" jsonschema:"Only search sections with a heading level of at most this, e.g. 2 for # and ## sections"`
+	IndexedAfter   string            `json:"indexed_after,omitempty" jsonschema:"Only search documents indexed on or after this date (YYYY-MM-DD or RFC 3339)"`
+	IndexedBefore  string            `json:"indexed_before,omitempty" jsonschema:"Only search documents indexed before this date (YYYY-MM-DD or RFC 3339)"`
+	ModifiedAfter  string            `json:"modified_after,omitempty" jsonschema:"Only search files modified on or after this date (YYYY-MM-DD or RFC 3339)"`
+	ModifiedBefore string            `json:"modified_before,omitempty" jsonschema:"Only search files modified before this date (YYYY-MM-DD or RFC 3339)"`
+	Kind           string            `json:"kind,omitempty" jsonschema:"Only search chunks of this kind: text (prose) or code (code blocks, when indexed as separate chunks)"`
+	Lang           string            `json:"lang,omitempty" jsonschema:"Only search chunks with a fenced code block in this language, e.g. yaml"`
 }
 
 // SearchOutput defines the output for the search tool.
@@ -44,16 +61,44 @@ type SearchOutput struct {
 	Results string `json:"results"`
 }
 
-// ListDocumentsInput defines the input for list_documents (empty).
-type ListDocumentsInput struct{}
+// ListDocumentsInput defines the input for list_documents.
+type ListDocumentsInput struct {
+	Collection string `json:"collection,omitempty" jsonschema:"Only list documents in this collection (default: all collections)"`
+	Title      string `json:"title,omitempty" jsonschema:"Only list documents whose title or one of whose aliases contains this text, ignoring case"`
+}
 
 // ListDocumentsOutput defines the output for list_documents.
 type ListDocumentsOutput struct {
 	Documents string `json:"documents"`
 }
 
+// IndexStatusInput defines the input for index_status.
+type IndexStatusInput struct {
+	Collection string `json:"collection,omitempty" jsonschema:"Only report on this collection (default: all collections)"`
+}
+
+// IndexStatusOutput defines the output for index_status.
+type IndexStatusOutput struct {
+	Status string `json:"status"`
+}
+
+// LinksInput defines the input for links and backlinks.
+type LinksInput struct {
+	Path string `json:"path" jsonschema:"Absolute path of an indexed document"`
+}
+
+// BrokenLinksInput defines the input for broken_links.
+type BrokenLinksInput struct {
+	Collection string `json:"collection,omitempty" jsonschema:"Only report on this collection (default: all collections)"`
+}
+
+// LinksOutput defines the output for links, backlinks and broken_links.
+type LinksOutput struct {
+	Links string `json:"links"`
+}
+
 func runMCPServer(cmd *cobra.Command, args []string) error {
-	cfg, err := app.DefaultPaths(OnnxLibraryPath)
+	cfg, err := app.DefaultPaths(OnnxLibraryPath, DBPath)
 	if err != nil {
 		return fmt.Errorf("failed to resolve paths: %w", err)
 	}
@@ -86,6 +131,7 @@ func runMCPServer(cmd *cobra.Command, args []string) error {
 
 	// Initialize search service
 	mcpStore = application.Store
+	mcpDBPath = cfg.DBPath
 	mcpSearch = search.New(application.Store, application.Embedder, application.Reranker)
 
 	if mcpSearch.HasReranker() {
@@ -99,7 +145,7 @@ func runMCPServer(cmd *cobra.Command, args []string) error {
 		Version: "0.3.1",
 	}, nil)
 
-	searchDesc := "Search indexed markdown documents using semantic similarity. Returns relevant chunks with file paths and similarity scores."
+	searchDesc := "Search indexed markdown documents by semantic similarity, keywords or both. Returns relevant chunks with file paths and scores. Results can be filtered by path, front matter tags and keys, heading level and dates."
 	if mcpSearch.HasReranker() {
 		searchDesc += " Uses cross-encoder reranking for improved relevance."
 	}
@@ -110,9 +156,29 @@ func runMCPServer(cmd *cobra.Command, args []string) error {
 
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "list_documents",
-		Description: "List all indexed documents with their titles and file paths.",
+		Description: "List all indexed documents with their titles, file paths and collections.",
 	}, handleListDocuments)
 
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "index_status",
+		Description: "Report index health: document and chunk counts, chunk sizes in tokens, truncated chunks, missing embeddings, when the index was last updated and which embedding models were used.",
+	}, handleIndexStatus)
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "links",
+		Description: "List the links in an indexed document, with the documents and sections they lead to.",
+	}, handleLinks)
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "backlinks",
+		Description: "List the links from other indexed documents to a document, with the sections they are in.",
+	}, handleBacklinks)
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "broken_links",
+		Description: "List the links between indexed documents that point to a missing document or heading.",
+	}, handleBrokenLinks)
+
 	if err := server.Run(ctx, &mcp.StdioTransport{}); err != nil {
 		if ctx.Err() != nil {
 			return nil
@@ -124,11 +190,35 @@ func runMCPServer(cmd *cobra.Command, args []string) error {
 }
 
 func handleSearch(ctx context.Context, req *mcp.CallToolRequest, input SearchInput) (*mcp.CallToolResult, SearchOutput, error) {
+	mode, err := search.ParseMode(input.Mode)
+	if err != nil {
+		return nil, SearchOutput{}, err
+	}
+	filter, err := searchFilterOptions{
+		Collection:     input.Collection,
+		Path:           input.Path,
+		Tags:           input.Tags,
+		Metadata:       input.Metadata,
+		MinLevel:       input.MinLevel,
+		MaxLevel:       input.MaxLevel,
+		IndexedAfter:   input.IndexedAfter,
+		IndexedBefore:  input.IndexedBefore,
+		ModifiedAfter:  input.ModifiedAfter,
+		ModifiedBefore: input.ModifiedBefore,
+		Kind:           input.Kind,
+		Lang:           input.Lang,
+	}.filter()
+	if err != nil {
+		return nil, SearchOutput{}, err
+	}
+
 	result, err := mcpSearch.Search(ctx, search.Params{
 		Query:      input.Query,
 		Limit:      input.Limit,
 		Candidates: input.Candidates,
 		Rerank:     input.Rerank,
+		Mode:       mode,
+		Filter:     filter,
 	})
 	if err != nil {
 		return nil, SearchOutput{}, err
@@ -155,12 +245,15 @@ func formatResults(result *search.Result) string {
 	output := fmt.Sprintf("Found %d results for: %q%s\n\n", len(result.Items), result.Query, suffix)
 
 	for i, item := range result.Items {
-		if result.Reranked {
-			output += fmt.Sprintf("## Result %d (relevance: %.2f)\n", i+1, item.Score)
-		} else {
-			output += fmt.Sprintf("## Result %d (%.1f%% similar)\n", i+1, item.Score*100)
-		}
+		output += fmt.Sprintf("## Result %d (%s)\n", i+1, scoreLabel(result, item))
 		output += fmt.Sprintf("**File:** %s:%d\n", item.FilePath, item.StartLine)
+		output += fmt.Sprintf("**Collection:** %s\n", item.Collection)
+		if len(item.Metadata) > 0 {
+			output += fmt.Sprintf("**Metadata:** %s\n", frontmatter.Metadata(item.Metadata))
+		}
+		if label := codeLabel(item); label != "" {
+			output += fmt.Sprintf("**Code:** %s\n", label)
+		}
 		output += fmt.Sprintf("**Section:** %s\n\n", item.HeadingPath)
 		output += fmt.Sprintf("```\n%s\n```\n\n", item.Content)
 	}
@@ -169,13 +262,47 @@ func formatResults(result *search.Result) string {
 }
 
 func handleListDocuments(ctx context.Context, req *mcp.CallToolRequest, input ListDocumentsInput) (*mcp.CallToolResult, ListDocumentsOutput, error) {
+	if input.Collection != "" {
+		if _, err := mcpStore.CollectionID(ctx, input.Collection); err != nil {
+			return nil, ListDocumentsOutput{}, err
+		}
+	}
+
 	docs, err := mcpStore.ListDocuments(ctx)
 	if err != nil {
 		return nil, ListDocumentsOutput{}, fmt.Errorf("failed to list documents: %w", err)
 	}
 
+	if input.Collection != "" {
+		filtered := docs[:0]
+		for _, d := range docs {
+			if d.Collection == input.Collection {
+				filtered = append(filtered, d)
+			}
+		}
+		docs = filtered
+	}
+	if input.Title != "" {
+		filtered := docs[:0]
+		for _, d := range docs {
+			if titleMatches(d, input.Title) {
+				filtered = append(filtered, d)
+			}
+		}
+		if len(filtered) == 0 {
+			msg := fmt.Sprintf("No documents titled %q.", input.Title)
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{&mcp.TextContent{Text: msg}},
+			}, ListDocumentsOutput{Documents: msg}, nil
+		}
+		docs = filtered
+	}
+
 	if len(docs) == 0 {
 		msg := "No documents indexed yet. Run 'mcpmydocs index <directory>' to index documents."
+		if input.Collection != "" {
+			msg = fmt.Sprintf("No documents indexed in collection %q. Run 'mcpmydocs index --collection %s <directory>' to index documents.", input.Collection, input.Collection)
+		}
 		return &mcp.CallToolResult{
 			Content: []mcp.Content{&mcp.TextContent{Text: msg}},
 		}, ListDocumentsOutput{Documents: msg}, nil
@@ -185,10 +312,72 @@ func handleListDocuments(ctx context.Context, req *mcp.CallToolRequest, input Li
 	output += fmt.Sprintf("Indexed %d documents:\n\n", len(docs))
 
 	for _, d := range docs {
-		output += fmt.Sprintf("- **%s**\n  %s\n", d.Title, d.FilePath)
+		output += fmt.Sprintf("- **%s** [%s]\n  %s\n", d.Title, d.Collection, d.FilePath)
+		if len(d.Metadata) > 0 {
+			output += fmt.Sprintf("  %s\n", frontmatter.Metadata(d.Metadata))
+		}
 	}
 
 	return &mcp.CallToolResult{
 		Content: []mcp.Content{&mcp.TextContent{Text: output}},
 	}, ListDocumentsOutput{Documents: output}, nil
 }
+
+// titleMatches reports whether the title or one of the aliases of a document
+// contains text, ignoring case.
+func titleMatches(d store.Document, text string) bool {
+	text = strings.ToLower(text)
+	if strings.Contains(strings.ToLower(d.Title), text) {
+		return true
+	}
+	for _, alias := range frontmatter.Metadata(d.Metadata).Aliases() {
+		if strings.Contains(strings.ToLower(alias), text) {
+			return true
+		}
+	}
+	return false
+}
+
+func handleIndexStatus(ctx context.Context, req *mcp.CallToolRequest, input IndexStatusInput) (*mcp.CallToolResult, IndexStatusOutput, error) {
+	output, err := indexStatus(ctx, mcpStore, mcpDBPath, input.Collection)
+	if err != nil {
+		return nil, IndexStatusOutput{}, err
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{&mcp.TextContent{Text: output}},
+	}, IndexStatusOutput{Status: output}, nil
+}
+
+func handleLinks(ctx context.Context, req *mcp.CallToolRequest, input LinksInput) (*mcp.CallToolResult, LinksOutput, error) {
+	return linksToolResult(ctx, input.Path, false)
+}
+
+func handleBacklinks(ctx context.Context, req *mcp.CallToolRequest, input LinksInput) (*mcp.CallToolResult, LinksOutput, error) {
+	return linksToolResult(ctx, input.Path, true)
+}
+
+func linksToolResult(ctx context.Context, path string, backlinks bool) (*mcp.CallToolResult, LinksOutput, error) {
+	if path == "" {
+		return nil, LinksOutput{}, fmt.Errorf("path is required")
+	}
+	output, err := linksReport(ctx, mcpStore, path, backlinks)
+	if err != nil {
+		return nil, LinksOutput{}, err
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{&mcp.TextContent{Text: output}},
+	}, LinksOutput{Links: output}, nil
+}
+
+func handleBrokenLinks(ctx context.Context, req *mcp.CallToolRequest, input BrokenLinksInput) (*mcp.CallToolResult, LinksOutput, error) {
+	output, err := brokenLinksReport(ctx, mcpStore, input.Collection)
+	if err != nil {
+		return nil, LinksOutput{}, err
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{&mcp.TextContent{Text: output}},
+	}, LinksOutput{Links: output}, nil
+}
@@ -9,8 +9,10 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/mattdennewitz/mcpmydocs/internal/app"
+	"github.com/mattdennewitz/mcpmydocs/internal/frontmatter"
 	"github.com/mattdennewitz/mcpmydocs/internal/logger"
 	"github.com/mattdennewitz/mcpmydocs/internal/search"
+	"github.com/mattdennewitz/mcpmydocs/internal/store"
 )
 
 var (
@@ -18,6 +20,9 @@ var (
 	searchRerank     bool
 	searchNoRerank   bool
 	searchCandidates int
+	searchMode       string
+	searchMeta       []string
+	searchFilters    searchFilterOptions
 )
 
 // NewSearchCmd creates the search command.
@@ -33,6 +38,19 @@ func NewSearchCmd() *cobra.Command {
 	cmd.Flags().BoolVar(&searchRerank, "rerank", false, "Enable cross-encoder reranking (default: auto-detect)")
 	cmd.Flags().BoolVar(&searchNoRerank, "no-rerank", false, "Disable cross-encoder reranking")
 	cmd.Flags().IntVar(&searchCandidates, "candidates", search.DefaultCandidates, "Number of candidates to fetch before reranking")
+	cmd.Flags().StringVar(&searchMode, "mode", string(search.DefaultMode), "Retrieval mode: vector, keyword or hybrid")
+	cmd.Flags().StringVarP(&searchFilters.Collection, "collection", "c", "", "Only search documents in this collection")
+	cmd.Flags().StringVar(&searchFilters.Path, "path", "", "Only search files under this path prefix, or matching this glob (relative to the indexed directory unless absolute)")
+	cmd.Flags().StringSliceVar(&searchFilters.Tags, "tag", nil, "Only search documents with this front matter tag (repeatable)")
+	cmd.Flags().StringArrayVar(&searchMeta, "meta", nil, "Only search documents whose front matter has key=value, or just the key (repeatable)")
+	cmd.Flags().IntVar(&searchFilters.MinLevel, "min-level", 0, "Only search sections with a heading level of at least this (0 is the text before the first heading)")
+	cmd.Flags().IntVar(&searchFilters.MaxLevel, "max-level", 0, "Only search sections with a heading level of at most this, e.g. 2 for # and ## sections")
+	cmd.Flags().StringVar(&searchFilters.IndexedAfter, "indexed-after", "", "Only search documents indexed on or after this date (YYYY-MM-DD or RFC 3339)")
+	cmd.Flags().StringVar(&searchFilters.IndexedBefore, "indexed-before", "", "Only search documents indexed before this date")
+	cmd.Flags().StringVar(&searchFilters.ModifiedAfter, "modified-after", "", "Only search files modified on or after this date")
+	cmd.Flags().StringVar(&searchFilters.ModifiedBefore, "modified-before", "", "Only search files modified before this date")
+	cmd.Flags().StringVar(&searchFilters.Kind, "kind", "", "Only search chunks of this kind: text, or code for code blocks indexed with --separate-code")
+	cmd.Flags().StringVar(&searchFilters.Lang, "lang", "", "Only search chunks with a fenced code block in this language, e.g. yaml")
 
 	return cmd
 }
@@ -40,7 +58,22 @@ func NewSearchCmd() *cobra.Command {
 func runSearch(cmd *cobra.Command, args []string) error {
 	query := strings.Join(args, " ")
 
-	cfg, err := app.DefaultPaths(OnnxLibraryPath)
+	mode, err := search.ParseMode(searchMode)
+	if err != nil {
+		return err
+	}
+	metadata, err := parseMetadataFlags(searchMeta)
+	if err != nil {
+		return err
+	}
+	opts := searchFilters
+	opts.Metadata = metadata
+	filter, err := opts.filter()
+	if err != nil {
+		return err
+	}
+
+	cfg, err := app.DefaultPaths(OnnxLibraryPath, DBPath)
 	if err != nil {
 		return fmt.Errorf("failed to resolve paths: %w", err)
 	}
@@ -80,6 +113,8 @@ func runSearch(cmd *cobra.Command, args []string) error {
 		Limit:      searchLimit,
 		Candidates: searchCandidates,
 		Rerank:     rerank,
+		Mode:       mode,
+		Filter:     filter,
 	})
 	if err != nil {
 		return err
@@ -104,17 +139,50 @@ func displayResults(result *search.Result) {
 
 	for i, item := range result.Items {
 		fmt.Printf("─────────────────────────────────────────────────────────────\n")
-		if result.Reranked {
-			fmt.Printf("[%d] %s (relevance: %.2f)\n", i+1, item.HeadingPath, item.Score)
-		} else {
-			fmt.Printf("[%d] %s (%.1f%% similar)\n", i+1, item.HeadingPath, item.Score*100)
+		fmt.Printf("[%d] %s (%s)\n", i+1, item.HeadingPath, scoreLabel(result, item))
+		fmt.Printf("    File: %s:%d\n", item.FilePath, item.StartLine)
+		fmt.Printf("    Collection: %s\n", item.Collection)
+		if len(item.Metadata) > 0 {
+			fmt.Printf("    Metadata: %s\n", frontmatter.Metadata(item.Metadata))
+		}
+		if label := codeLabel(item); label != "" {
+			fmt.Printf("    Code: %s\n", label)
 		}
-		fmt.Printf("    File: %s:%d\n\n", item.FilePath, item.StartLine)
+		fmt.Println()
 		printTruncatedContent(item.Content)
 		fmt.Println()
 	}
 }
 
+// codeLabel describes the code in an item: a code block and its language, or
+// the languages of the code blocks in a section. It is "" for plain prose.
+func codeLabel(item search.Item) string {
+	langs := strings.Join(strings.Fields(item.Lang), ", ")
+	switch {
+	case item.Kind == store.ChunkKindCode && langs != "":
+		return "code block (" + langs + ")"
+	case item.Kind == store.ChunkKindCode:
+		return "code block"
+	case langs != "":
+		return "contains " + langs
+	}
+	return ""
+}
+
+// scoreLabel describes an item's score according to how it was ranked.
+func scoreLabel(result *search.Result, item search.Item) string {
+	switch {
+	case result.Reranked:
+		return fmt.Sprintf("relevance: %.2f", item.Score)
+	case result.Mode == search.ModeKeyword:
+		return fmt.Sprintf("BM25: %.2f", item.Score)
+	case result.Mode == search.ModeHybrid:
+		return fmt.Sprintf("fused: %.4f", item.Score)
+	default:
+		return fmt.Sprintf("%.1f%% similar", item.Score*100)
+	}
+}
+
 func printTruncatedContent(content string) {
 	content = strings.TrimSpace(content)
 	lines := strings.Split(content, "\n")
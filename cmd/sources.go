@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mattdennewitz/mcpmydocs/internal/store"
+)
+
+// NewSourcesCmd creates the sources command and its subcommands.
+func NewSourcesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "sources",
+		Short: "Manage the directories indexed into the database",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List indexed directories with their options and document counts",
+		Args:  cobra.NoArgs,
+		RunE:  runSourcesList,
+	}, &cobra.Command{
+		Use:   "remove [directory]",
+		Short: "Forget an indexed directory and remove all of its documents",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runSourcesRemove,
+	})
+
+	return cmd
+}
+
+func runSourcesList(cmd *cobra.Command, args []string) error {
+	dbPath, err := existingDBPath()
+	if err != nil {
+		return err
+	}
+
+	st, err := store.NewReadOnly(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer st.Close()
+
+	sources, err := st.ListSources(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to list sources: %w", err)
+	}
+
+	fmt.Print(formatSources(sources))
+	return nil
+}
+
+func formatSources(sources []store.Source) string {
+	var b strings.Builder
+	for _, src := range sources {
+		fmt.Fprintf(&b, "%s (collection %s, %d documents)\n", src.Root, src.Collection, src.DocumentCount)
+		if len(src.Options.Include) > 0 {
+			fmt.Fprintf(&b, "  include: %s\n", strings.Join(src.Options.Include, ", "))
+		}
+		if len(src.Options.Exclude) > 0 {
+			fmt.Fprintf(&b, "  exclude: %s\n", strings.Join(src.Options.Exclude, ", "))
+		}
+		if src.Options.MaxChunkTokens > 0 {
+			fmt.Fprintf(&b, "  max chunk tokens: %d (overlap %d)\n", src.Options.MaxChunkTokens, src.Options.ChunkOverlap)
+		}
+		if src.Options.MinChunkTokens > 0 {
+			fmt.Fprintf(&b, "  min chunk tokens: %d\n", src.Options.MinChunkTokens)
+		}
+		if src.Options.SeparateCode {
+			b.WriteString("  code blocks: separate chunks\n")
+		}
+		if src.Options.Obsidian {
+			b.WriteString("  obsidian vault\n")
+		}
+		if src.Options.EmbedTemplate != "" {
+			fmt.Fprintf(&b, "  embed template: %q\n", src.Options.EmbedTemplate)
+		}
+	}
+	return b.String()
+}
+
+func runSourcesRemove(cmd *cobra.Command, args []string) error {
+	// The directory may already be gone, so it is only made absolute
+	dir, err := filepath.Abs(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to resolve directory: %w", err)
+	}
+
+	dbPath, err := existingDBPath()
+	if err != nil {
+		return err
+	}
+
+	st, err := store.New(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer st.Close()
+
+	removed, err := st.RemoveSource(context.Background(), dir)
+	if err != nil {
+		return fmt.Errorf("failed to remove source: %w", err)
+	}
+
+	fmt.Printf("Removed source %s (%d documents removed)\n", dir, removed)
+	return nil
+}
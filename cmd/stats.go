@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mattdennewitz/mcpmydocs/internal/embedder"
+	"github.com/mattdennewitz/mcpmydocs/internal/store"
+)
+
+var statsCollection string
+
+// NewStatsCmd creates the stats command.
+func NewStatsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Show what is in the index and how healthy it is",
+		Args:  cobra.NoArgs,
+		RunE:  runStats,
+	}
+
+	cmd.Flags().StringVarP(&statsCollection, "collection", "c", "", "Only report on this collection (default: all collections)")
+
+	return cmd
+}
+
+func runStats(cmd *cobra.Command, args []string) error {
+	dbPath, err := existingDBPath()
+	if err != nil {
+		return err
+	}
+
+	st, err := store.NewReadOnly(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer st.Close()
+
+	output, err := indexStatus(context.Background(), st, dbPath, statsCollection)
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(output)
+	return nil
+}
+
+// indexStatus builds the report shared by the stats command and the index_status tool.
+func indexStatus(ctx context.Context, st *store.Store, dbPath, collection string) (string, error) {
+	if collection != "" {
+		if _, err := st.CollectionID(ctx, collection); err != nil {
+			return "", err
+		}
+	}
+
+	stats, err := st.Stats(ctx, collection, embedder.MaxSeqLen)
+	if err != nil {
+		return "", fmt.Errorf("failed to compute stats: %w", err)
+	}
+
+	return formatIndexStatus(stats, dbPath, databaseSize(dbPath), collection), nil
+}
+
+func formatIndexStatus(stats *store.Stats, dbPath string, dbSize int64, collection string) string {
+	var b strings.Builder
+
+	if collection == "" {
+		collection = "all"
+	}
+
+	fmt.Fprintf(&b, "Database:        %s (%s)\n", dbPath, formatBytes(dbSize))
+	fmt.Fprintf(&b, "Collection:      %s\n", collection)
+	fmt.Fprintf(&b, "Documents:       %d\n", stats.Documents)
+	fmt.Fprintf(&b, "Chunks:          %d\n", stats.Chunks)
+	if stats.Documents == 0 {
+		return b.String()
+	}
+
+	fmt.Fprintf(&b, "Chunks/document: min %d, median %d, p90 %d, max %d, mean %.1f\n",
+		stats.MinChunks, stats.MedianChunks, stats.P90Chunks, stats.MaxChunks, stats.MeanChunks)
+	fmt.Fprintf(&b, "Tokens:          %d total, %d in the largest chunk\n", stats.TotalTokens, stats.MaxTokens)
+	fmt.Fprintf(&b, "Truncated:       %d chunks exceed the %d-token embedding window\n", stats.TruncatedChunks, embedder.MaxSeqLen)
+	if stats.UnknownTokenCount > 0 {
+		fmt.Fprintf(&b, "                 %d chunks have no token count (indexed by an older version)\n", stats.UnknownTokenCount)
+	}
+	fmt.Fprintf(&b, "NULL embeddings: %d\n", stats.NullEmbeddings)
+	if !stats.LastIndexedAt.IsZero() {
+		fmt.Fprintf(&b, "Last indexed:    %s\n", stats.LastIndexedAt.Format("2006-01-02 15:04:05"))
+	}
+
+	models := make([]string, len(stats.Models))
+	for i, m := range stats.Models {
+		if m == "" {
+			m = "unknown (indexed by an older version)"
+		}
+		models[i] = m
+	}
+	fmt.Fprintf(&b, "Models:          %s\n", strings.Join(models, ", "))
+
+	return b.String()
+}
+
+// databaseSize returns the size of the database file including its write-ahead log.
+func databaseSize(dbPath string) int64 {
+	var size int64
+	for _, p := range []string{dbPath, dbPath + ".wal"} {
+		if info, err := os.Stat(p); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
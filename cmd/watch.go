@@ -0,0 +1,329 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/cobra"
+
+	"github.com/mattdennewitz/mcpmydocs/internal/app"
+	"github.com/mattdennewitz/mcpmydocs/internal/chunker"
+	"github.com/mattdennewitz/mcpmydocs/internal/embedder"
+	"github.com/mattdennewitz/mcpmydocs/internal/ignore"
+	"github.com/mattdennewitz/mcpmydocs/internal/logger"
+	"github.com/mattdennewitz/mcpmydocs/internal/store"
+)
+
+// watchRetryInterval is how long to wait before retrying when the database
+// cannot be opened for writing, e.g. while another process holds it.
+const watchRetryInterval = 2 * time.Second
+
+// errDatabaseUnavailable is returned by withStore when the database cannot be opened.
+var errDatabaseUnavailable = errors.New("failed to open database")
+
+var watchDebounce time.Duration
+
+// NewWatchCmd creates the watch command.
+func NewWatchCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "watch [directory]",
+		Short: "Index a directory and keep the index updated as files change",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runWatch,
+	}
+
+	addIndexFlags(cmd)
+	cmd.Flags().DurationVar(&watchDebounce, "debounce", 500*time.Millisecond, "Wait this long after the last change before re-indexing")
+
+	return cmd
+}
+
+func runWatch(cmd *cobra.Command, args []string) error {
+	absDir, err := resolveDirectory(args[0])
+	if err != nil {
+		return err
+	}
+
+	matcher, err := newIndexMatcher()
+	if err != nil {
+		return err
+	}
+	if err := chunkerOptions(nil).Validate(); err != nil {
+		return err
+	}
+
+	cfg, err := app.DefaultPaths(OnnxLibraryPath, DBPath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve paths: %w", err)
+	}
+
+	// The embedder stays loaded, but the database is only opened while
+	// applying changes so that other processes can read it in between.
+	emb, err := embedder.New(cfg.ModelPath, cfg.OnnxLibraryPath)
+	if err != nil {
+		return fmt.Errorf("failed to create embedder: %w", err)
+	}
+	defer emb.Close()
+
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to start file watcher: %w", err)
+	}
+	defer fsw.Close()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	w := &dirWatcher{
+		absDir:  absDir,
+		dbPath:  cfg.DBPath,
+		matcher: matcher,
+		watcher: fsw,
+		emb:     emb,
+		ch:      chunker.NewWithOptions(chunkerOptions(emb)),
+		pending: make(map[string]struct{}),
+	}
+
+	// Start watching before the initial index so edits made meanwhile are not lost
+	walkMarkdownFiles(absDir, absDir, matcher, w.addWatch)
+
+	logger.Info("starting indexing", "directory", absDir, "database", cfg.DBPath, "collection", indexCollection)
+	if err := w.withStoreRetry(ctx, func(ctx context.Context, st *store.Store) error {
+		stats, pruned, err := indexDirectory(ctx, absDir, matcher, st, emb)
+		if err != nil {
+			return err
+		}
+		printIndexSummary(stats, pruned)
+		return nil
+	}); err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		fmt.Println("Stopped watching.")
+		return nil
+	}
+
+	fmt.Printf("Watching %s for changes (Ctrl+C to stop)\n", absDir)
+	return w.run(ctx)
+}
+
+// dirWatcher turns file system events under a directory into index updates.
+type dirWatcher struct {
+	absDir  string
+	dbPath  string
+	matcher *ignore.Matcher
+	watcher *fsnotify.Watcher
+	emb     indexEmbedder
+	ch      *chunker.Chunker
+
+	pending map[string]struct{} // changed paths awaiting the debounce timer
+	resync  bool                // an ignore file changed; re-walk the whole tree
+}
+
+func (w *dirWatcher) run(ctx context.Context) error {
+	timer := time.NewTimer(watchDebounce)
+	timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Println("Stopped watching.")
+			return nil
+
+		case ev, ok := <-w.watcher.Events:
+			if !ok {
+				return nil
+			}
+			if w.queue(ev) {
+				timer.Reset(watchDebounce)
+			}
+
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return nil
+			}
+			logger.Warn("file watcher error", "error", err)
+
+		case <-timer.C:
+			if err := w.withStore(ctx, w.apply); err != nil {
+				fmt.Printf("%s database unavailable, retrying in %s: %v\n", timestamp(), watchRetryInterval, err)
+				timer.Reset(watchRetryInterval)
+			}
+		}
+	}
+}
+
+// queue records a file system event and reports whether it needs processing.
+func (w *dirWatcher) queue(ev fsnotify.Event) bool {
+	if ev.Has(fsnotify.Chmod) && !ev.Has(fsnotify.Create|fsnotify.Write|fsnotify.Remove|fsnotify.Rename) {
+		return false
+	}
+
+	for _, name := range ignore.DefaultFiles {
+		if filepath.Base(ev.Name) == name {
+			w.resync = true
+			return true
+		}
+	}
+
+	// Removed or renamed paths may have been directories, so they are always
+	// checked; otherwise only markdown files and new directories matter.
+	if !ev.Has(fsnotify.Remove) && !ev.Has(fsnotify.Rename) && !isMarkdownFile(ev.Name) {
+		info, err := os.Stat(ev.Name)
+		if err != nil || !info.IsDir() {
+			return false
+		}
+	}
+
+	w.pending[ev.Name] = struct{}{}
+	return true
+}
+
+// apply re-indexes or removes every pending path.
+func (w *dirWatcher) apply(ctx context.Context, st *store.Store) error {
+	collectionID, err := st.EnsureCollection(ctx, indexCollection)
+	if err != nil {
+		return err
+	}
+
+	sourceID, err := st.EnsureSource(ctx, w.absDir, collectionID)
+	if err != nil {
+		return err
+	}
+
+	if w.resync {
+		// A matcher never re-reads the ignore files of a directory, so the
+		// edited rules need a new one
+		matcher, err := newIndexMatcher()
+		if err != nil {
+			return err
+		}
+		w.matcher = matcher
+
+		stats, pruned, err := indexDirectory(ctx, w.absDir, w.matcher, st, w.emb)
+		if err != nil {
+			return err
+		}
+		// Directories that are no longer ignored are watched from now on
+		walkMarkdownFiles(w.absDir, w.absDir, w.matcher, w.addWatch)
+		fmt.Printf("\r\033[K%s ignore rules changed: %d indexed, %d pruned, %d failed\n", timestamp(), stats.indexed.Load(), pruned, len(stats.sortedFailures()))
+		w.resync = false
+		clear(w.pending)
+		return nil
+	}
+
+	paths := make([]string, 0, len(w.pending))
+	for p := range w.pending {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		switch {
+		case os.IsNotExist(err):
+			removed, err := pruneDocuments(ctx, st, path, indexCollection, nil)
+			if err != nil {
+				return err
+			}
+			if removed > 0 {
+				fmt.Printf("%s removed %s\n", timestamp(), w.displayPath(path))
+			}
+		case err != nil:
+			logger.Warn("failed to stat changed path", "path", path, "error", err)
+		case info.IsDir():
+			for _, file := range walkMarkdownFiles(w.absDir, path, w.matcher, w.addWatch) {
+				w.indexFile(ctx, st, sourceID, collectionID, file)
+			}
+		default:
+			relPath, err := filepath.Rel(w.absDir, path)
+			if err != nil {
+				continue
+			}
+			if skip, reason := w.matcher.Match(filepath.ToSlash(relPath), false); skip {
+				logger.Debug("skipping ignored file", "path", path, "reason", reason)
+				continue
+			}
+			w.indexFile(ctx, st, sourceID, collectionID, path)
+		}
+		delete(w.pending, path)
+	}
+
+	return nil
+}
+
+// indexFile runs a single file through the regular indexing path and prints the outcome.
+func (w *dirWatcher) indexFile(ctx context.Context, st *store.Store, sourceID, collectionID int, path string) {
+	stats := &indexStats{}
+	var printMu sync.Mutex
+
+	if err := processFile(ctx, path, w.absDir, sourceID, collectionID, 1, st, w.emb, w.ch, stats, &printMu); err != nil {
+		var failure *indexFailure
+		if errors.As(err, &failure) {
+			fmt.Printf("\r\033[K%s failed %s (%s): %v\n", timestamp(), w.displayPath(path), failure.Stage, failure.Err)
+		} else {
+			fmt.Printf("\r\033[K%s failed %s: %v\n", timestamp(), w.displayPath(path), err)
+		}
+		return
+	}
+	if stats.indexed.Load() > 0 {
+		fmt.Printf("\r\033[K%s indexed %s\n", timestamp(), w.displayPath(path))
+	} else {
+		logger.Debug("file unchanged", "path", path)
+	}
+}
+
+// withStore opens the database for the duration of fn.
+func (w *dirWatcher) withStore(ctx context.Context, fn func(context.Context, *store.Store) error) error {
+	st, err := store.New(w.dbPath)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errDatabaseUnavailable, err)
+	}
+	defer st.Close()
+
+	return fn(ctx, st)
+}
+
+// withStoreRetry is withStore, but waits and tries again for as long as the
+// database cannot be opened. It gives up without running fn once ctx is done.
+func (w *dirWatcher) withStoreRetry(ctx context.Context, fn func(context.Context, *store.Store) error) error {
+	for {
+		err := w.withStore(ctx, fn)
+		if !errors.Is(err, errDatabaseUnavailable) {
+			return err
+		}
+		fmt.Printf("%s database unavailable, retrying in %s: %v\n", timestamp(), watchRetryInterval, err)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(watchRetryInterval):
+		}
+	}
+}
+
+func (w *dirWatcher) addWatch(dir string) {
+	if err := w.watcher.Add(dir); err != nil {
+		logger.Warn("failed to watch directory", "path", dir, "error", err)
+	}
+}
+
+func (w *dirWatcher) displayPath(path string) string {
+	if rel, err := filepath.Rel(w.absDir, path); err == nil {
+		return rel
+	}
+	return path
+}
+
+func timestamp() string {
+	return time.Now().Format("15:04:05")
+}
@@ -3,12 +3,15 @@ module github.com/mattdennewitz/mcpmydocs
 go 1.24
 
 require (
+	github.com/BurntSushi/toml v1.6.0
+	github.com/fsnotify/fsnotify v1.10.1
 	github.com/marcboeker/go-duckdb v1.8.5
 	github.com/modelcontextprotocol/go-sdk v1.2.0
 	github.com/spf13/cobra v1.8.1
 	github.com/yalue/onnxruntime_go v1.9.0
 	github.com/yuin/goldmark v1.7.13
 	golang.org/x/sync v0.15.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
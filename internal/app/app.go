@@ -2,8 +2,6 @@ package app
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
 
 	"github.com/mattdennewitz/mcpmydocs/internal/embedder"
 	"github.com/mattdennewitz/mcpmydocs/internal/logger"
@@ -88,14 +86,13 @@ func (a *App) Close() error {
 }
 
 // DefaultPaths returns the default paths for the application.
-func DefaultPaths(onnxLibOverride string) (Config, error) {
-	cwd, err := os.Getwd()
+// An empty dbOverride falls back to MCPMYDOCS_DB, then the working directory.
+func DefaultPaths(onnxLibOverride, dbOverride string) (Config, error) {
+	dbPath, err := paths.ResolveDBPath(dbOverride)
 	if err != nil {
-		return Config{}, fmt.Errorf("failed to get current working directory: %w", err)
+		return Config{}, err
 	}
 
-	dbPath := filepath.Join(cwd, "mcpmydocs.db")
-
 	modelPath, err := paths.ResolveModelPath()
 	if err != nil {
 		return Config{}, err
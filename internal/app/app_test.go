@@ -69,7 +69,7 @@ func TestDefaultPaths_SetsDBPath(t *testing.T) {
 	os.Setenv("MCPMYDOCS_MODEL_PATH", modelPath)
 	os.Setenv("ONNX_LIBRARY_PATH", onnxPath)
 
-	cfg, err := DefaultPaths("")
+	cfg, err := DefaultPaths("", "")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -115,7 +115,7 @@ func TestDefaultPaths_OnnxOverride(t *testing.T) {
 	os.Setenv("ONNX_LIBRARY_PATH", onnxEnvPath)
 
 	// Override should take precedence over env var
-	cfg, err := DefaultPaths(onnxOverridePath)
+	cfg, err := DefaultPaths(onnxOverridePath, "")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -125,6 +125,50 @@ func TestDefaultPaths_OnnxOverride(t *testing.T) {
 	}
 }
 
+func TestDefaultPaths_DBOverride(t *testing.T) {
+	// Save and restore env vars
+	oldModelPath := os.Getenv("MCPMYDOCS_MODEL_PATH")
+	oldOnnxPath := os.Getenv("ONNX_LIBRARY_PATH")
+	oldDBPath := os.Getenv("MCPMYDOCS_DB")
+	defer func() {
+		os.Setenv("MCPMYDOCS_MODEL_PATH", oldModelPath)
+		os.Setenv("ONNX_LIBRARY_PATH", oldOnnxPath)
+		os.Setenv("MCPMYDOCS_DB", oldDBPath)
+	}()
+
+	tmpDir := t.TempDir()
+	modelPath := filepath.Join(tmpDir, "embed.onnx")
+	onnxPath := filepath.Join(tmpDir, "libonnxruntime.dylib")
+	for _, p := range []string{modelPath, onnxPath} {
+		if err := os.WriteFile(p, []byte("fake"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	os.Setenv("MCPMYDOCS_MODEL_PATH", modelPath)
+	os.Setenv("ONNX_LIBRARY_PATH", onnxPath)
+	os.Setenv("MCPMYDOCS_DB", filepath.Join(tmpDir, "env.db"))
+
+	// Flag should take precedence over env var
+	overridePath := filepath.Join(tmpDir, "override.db")
+	cfg, err := DefaultPaths("", overridePath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.DBPath != overridePath {
+		t.Errorf("expected override path %s, got %s", overridePath, cfg.DBPath)
+	}
+
+	// Env var used when no flag is given
+	cfg, err = DefaultPaths("", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := filepath.Join(tmpDir, "env.db"); cfg.DBPath != expected {
+		t.Errorf("expected env path %s, got %s", expected, cfg.DBPath)
+	}
+}
+
 func TestDefaultPaths_ModelNotFound(t *testing.T) {
 	// Save and restore env vars
 	oldModelPath := os.Getenv("MCPMYDOCS_MODEL_PATH")
@@ -150,7 +194,7 @@ func TestDefaultPaths_ModelNotFound(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	_, err = DefaultPaths("")
+	_, err = DefaultPaths("", "")
 	if err == nil {
 		t.Error("expected error when model not found")
 	}
@@ -181,7 +225,7 @@ func TestConfig_Fields(t *testing.T) {
 // TestNew_ReadOnly tests that ReadOnly config uses read-only store.
 // This test is skipped if the required model/library files are not present.
 func TestNew_ReadOnly(t *testing.T) {
-	cfg, err := DefaultPaths("")
+	cfg, err := DefaultPaths("", "")
 	if err != nil {
 		t.Skipf("skipping test: %v", err)
 	}
@@ -213,7 +257,7 @@ func TestNew_ReadOnly(t *testing.T) {
 
 // TestNew_ReadOnly_NonexistentDB tests that ReadOnly fails for non-existent DB.
 func TestNew_ReadOnly_NonexistentDB(t *testing.T) {
-	cfg, err := DefaultPaths("")
+	cfg, err := DefaultPaths("", "")
 	if err != nil {
 		t.Skipf("skipping test: %v", err)
 	}
@@ -244,7 +288,7 @@ func TestNewAndClose_Integration(t *testing.T) {
 	}()
 
 	// Check if we're in a directory where we can find the model
-	cfg, err := DefaultPaths("")
+	cfg, err := DefaultPaths("", "")
 	if err != nil {
 		t.Skipf("skipping integration test: %v", err)
 	}
@@ -2,31 +2,135 @@ package chunker
 
 import (
 	"bytes"
+	"fmt"
 	"strings"
+	"text/template"
 
 	"github.com/yuin/goldmark"
 	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
 	"github.com/yuin/goldmark/text"
 )
 
+// Version is raised whenever the same markdown and options produce different
+// chunks, embedded text or links, so that documents indexed before are
+// re-indexed.
+const Version = 3
+
 // Chunk represents a section of a markdown document.
 type Chunk struct {
 	HeadingPath  string
 	HeadingLevel int
 	Content      string
 	StartLine    int
+	Kind         string // KindText or KindCode
+	Lang         string // languages of the chunk's fenced code blocks, space-separated
 }
 
 // Chunker parses markdown and splits by heading sections.
 type Chunker struct {
-	md goldmark.Markdown
+	md      goldmark.Markdown
+	opts    Options
+	tmpl    *template.Template
+	tmplErr error
+}
+
+// Options configures how sections are split into chunks.
+type Options struct {
+	// MaxTokens is the token budget of a chunk. Longer sections are split on
+	// paragraph, list item and code block boundaries, keeping their heading
+	// path. 0 disables splitting.
+	MaxTokens int
+
+	// OverlapTokens is how many tokens of blocks at the end of one piece of a
+	// split section are repeated at the start of the next.
+	OverlapTokens int
+
+	// MinTokens is the smallest section kept on its own. Shorter sections are
+	// folded into their parent section, or else into their next sibling. 0
+	// keeps every section.
+	MinTokens int
+
+	// SeparateCode moves fenced code blocks out of their sections into
+	// chunks of their own.
+	SeparateCode bool
+
+	// Obsidian parses the syntax of Obsidian vaults: [[wikilinks]],
+	// ![[embeds]] and inline #tags.
+	Obsidian bool
+
+	// Template assembles the text embedded for each chunk; see ParseTemplate.
+	// "" embeds the chunk's content alone.
+	Template string
+
+	// CountTokens counts the tokens in text. Defaults to counting words.
+	CountTokens func(text string) int
+}
+
+// Validate reports options that cannot be applied.
+func (o Options) Validate() error {
+	if o.MaxTokens < 0 || o.OverlapTokens < 0 || o.MinTokens < 0 {
+		return fmt.Errorf("token counts must not be negative")
+	}
+	if o.MaxTokens > 0 && o.MinTokens >= o.MaxTokens {
+		return fmt.Errorf("minimum (%d tokens) must be smaller than the chunk budget (%d tokens)", o.MinTokens, o.MaxTokens)
+	}
+	if o.OverlapTokens > 0 && o.OverlapTokens >= o.MaxTokens {
+		return fmt.Errorf("overlap (%d tokens) must be smaller than the chunk budget (%d tokens)", o.OverlapTokens, o.MaxTokens)
+	}
+	if o.Template != "" {
+		if _, err := ParseTemplate(o.Template); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// String describes the options that affect the chunks produced and the text
+// embedded for them, or returns "" for the defaults.
+func (o Options) String() string {
+	var parts []string
+	if o.MaxTokens > 0 {
+		parts = append(parts, fmt.Sprintf("max-tokens=%d overlap=%d", o.MaxTokens, o.OverlapTokens))
+	}
+	if o.MinTokens > 0 {
+		parts = append(parts, fmt.Sprintf("min-tokens=%d", o.MinTokens))
+	}
+	if o.SeparateCode {
+		parts = append(parts, "separate-code")
+	}
+	if o.Obsidian {
+		parts = append(parts, "obsidian")
+	}
+	if o.Template != "" {
+		parts = append(parts, "template="+templateID(o.Template))
+	}
+	return strings.Join(parts, " ")
 }
 
 // New creates a new Chunker.
 func New() *Chunker {
-	return &Chunker{
-		md: goldmark.New(),
+	return NewWithOptions(Options{})
+}
+
+// NewWithOptions creates a Chunker that splits sections as configured.
+func NewWithOptions(opts Options) *Chunker {
+	if opts.CountTokens == nil {
+		opts.CountTokens = func(text string) int { return len(strings.Fields(text)) }
+	}
+	extensions := []goldmark.Extender{extension.GFM, extension.Footnote}
+	if opts.Obsidian {
+		extensions = append(extensions, obsidian{})
+	}
+	c := &Chunker{
+		md:   goldmark.New(goldmark.WithExtensions(extensions...)),
+		opts: opts,
+	}
+	if opts.Template != "" {
+		// Reported by EmbedText; callers are expected to Validate first
+		c.tmpl, c.tmplErr = ParseTemplate(opts.Template)
 	}
+	return c
 }
 
 type stackItem struct {
@@ -43,16 +147,46 @@ type headingInfo struct {
 
 // ChunkFile parses markdown and splits by heading sections.
 func (c *Chunker) ChunkFile(source []byte) ([]Chunk, error) {
+	return c.ChunkDocument(Document{}, source)
+}
+
+// ChunkDocument is ChunkFile for the markdown of doc. The text an embedding
+// template adds for doc counts against the token budget of each chunk.
+func (c *Chunker) ChunkDocument(doc Document, source []byte) ([]Chunk, error) {
 	reader := text.NewReader(source)
-	doc := c.md.Parser().Parse(reader)
+	tree := c.md.Parser().Parse(reader)
 
-	headings := collectHeadings(doc, source)
+	headings := collectHeadings(tree, source)
 
+	var sections []section
 	if len(headings) == 0 {
-		return createSingleChunk(source), nil
+		sections = createSingleChunk(source)
+	} else {
+		sections = buildChunks(headings, source)
+	}
+
+	if c.opts.MinTokens > 0 {
+		sections = c.merge(sections, source)
+	}
+	if c.opts.MaxTokens > 0 {
+		sections = c.split(doc, sections, collectBlockStarts(tree, source), source)
 	}
+	sections = c.code(sections, collectCodeBlocks(tree, source), source)
+
+	if len(sections) == 0 {
+		return nil, nil
+	}
+	chunks := make([]Chunk, len(sections))
+	for i, sec := range sections {
+		chunks[i] = sec.Chunk
+	}
+	return chunks, nil
+}
 
-	return buildChunks(headings, source), nil
+// section is a chunk along with the bytes of the source it covers.
+type section struct {
+	Chunk
+	start, end int
 }
 
 func collectHeadings(doc ast.Node, source []byte) []headingInfo {
@@ -107,21 +241,24 @@ func updateLastEnd(n ast.Node, lastEnd int) int {
 	return lastEnd
 }
 
-func createSingleChunk(source []byte) []Chunk {
+func createSingleChunk(source []byte) []section {
 	content := strings.TrimSpace(string(source))
 	if content == "" {
 		return nil
 	}
-	return []Chunk{{
-		HeadingPath:  "(root)",
-		HeadingLevel: 0,
-		Content:      content,
-		StartLine:    1,
+	return []section{{
+		Chunk: Chunk{
+			HeadingPath:  "(root)",
+			HeadingLevel: 0,
+			Content:      content,
+			StartLine:    1,
+		},
+		end: len(source),
 	}}
 }
 
-func buildChunks(headings []headingInfo, source []byte) []Chunk {
-	var chunks []Chunk
+func buildChunks(headings []headingInfo, source []byte) []section {
+	var chunks []section
 
 	if preamble := createPreamble(headings, source); preamble != nil {
 		chunks = append(chunks, *preamble)
@@ -137,7 +274,7 @@ func buildChunks(headings []headingInfo, source []byte) []Chunk {
 	return chunks
 }
 
-func createPreamble(headings []headingInfo, source []byte) *Chunk {
+func createPreamble(headings []headingInfo, source []byte) *section {
 	if headings[0].startByte <= 0 {
 		return nil
 	}
@@ -145,11 +282,14 @@ func createPreamble(headings []headingInfo, source []byte) *Chunk {
 	if content == "" {
 		return nil
 	}
-	return &Chunk{
-		HeadingPath:  "(root)",
-		HeadingLevel: 0,
-		Content:      content,
-		StartLine:    1,
+	return &section{
+		Chunk: Chunk{
+			HeadingPath:  "(root)",
+			HeadingLevel: 0,
+			Content:      content,
+			StartLine:    1,
+		},
+		end: headings[0].startByte,
 	}
 }
 
@@ -160,16 +300,20 @@ func updateHeadingStack(stack []stackItem, h headingInfo) []stackItem {
 	return append(stack, stackItem{h.level, h.text})
 }
 
-func createChunkFromHeading(headings []headingInfo, idx int, source []byte, stack []stackItem) Chunk {
+func createChunkFromHeading(headings []headingInfo, idx int, source []byte, stack []stackItem) section {
 	h := headings[idx]
 	startByte, endByte := getChunkBounds(headings, idx, len(source))
 	content := strings.TrimSpace(string(source[startByte:endByte]))
 
-	return Chunk{
-		HeadingPath:  buildHeadingPath(stack),
-		HeadingLevel: h.level,
-		Content:      content,
-		StartLine:    h.startLine,
+	return section{
+		Chunk: Chunk{
+			HeadingPath:  buildHeadingPath(stack),
+			HeadingLevel: h.level,
+			Content:      content,
+			StartLine:    h.startLine,
+		},
+		start: startByte,
+		end:   endByte,
 	}
 }
 
@@ -217,7 +361,7 @@ func buildHeadingPath(stack []stackItem) string {
 		prefix := strings.Repeat("#", h.level)
 		parts = append(parts, prefix+" "+h.text)
 	}
-	return strings.Join(parts, " > ")
+	return strings.Join(parts, headingSeparator)
 }
 
 func countLines(data []byte) int {
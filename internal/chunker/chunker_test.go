@@ -687,3 +687,637 @@ func BenchmarkChunkFile_Large(b *testing.B) {
 		_, _ = c.ChunkFile(input)
 	}
 }
+
+func TestOptions_Validate(t *testing.T) {
+	valid := []Options{{}, {MaxTokens: 200}, {MaxTokens: 200, OverlapTokens: 50}}
+	for _, opts := range valid {
+		if err := opts.Validate(); err != nil {
+			t.Errorf("%+v should be valid: %v", opts, err)
+		}
+	}
+
+	invalid := []Options{{MaxTokens: -1}, {MaxTokens: 100, OverlapTokens: 100}, {OverlapTokens: 10}, {MinTokens: -1}, {MaxTokens: 100, MinTokens: 100}, {Template: "{{.Title"}}
+	for _, opts := range invalid {
+		if err := opts.Validate(); err == nil {
+			t.Errorf("%+v should be invalid", opts)
+		}
+	}
+}
+
+func TestOptions_String(t *testing.T) {
+	if got := (Options{}).String(); got != "" {
+		t.Errorf("default options should describe as empty, got %q", got)
+	}
+	if got := (Options{MaxTokens: 200, OverlapTokens: 20}).String(); got != "max-tokens=200 overlap=20" {
+		t.Errorf("unexpected description: %q", got)
+	}
+	if got := (Options{MaxTokens: 200, MinTokens: 10}).String(); got != "max-tokens=200 overlap=0 min-tokens=10" {
+		t.Errorf("unexpected description: %q", got)
+	}
+	if got := (Options{SeparateCode: true}).String(); got != "separate-code" {
+		t.Errorf("unexpected description: %q", got)
+	}
+	a, b := Options{Template: "{{.Title}} {{.Content}}"}.String(), Options{Template: "{{.Content}}"}.String()
+	if !strings.HasPrefix(a, "template=") || a == b {
+		t.Errorf("expected templates to be told apart, got %q and %q", a, b)
+	}
+}
+
+func TestChunkFile_SplitsLongSections(t *testing.T) {
+	input := `# Guide
+
+## Setup
+
+First paragraph with six words here.
+
+- item one is here
+- item two is here
+
+` + "```go\nfunc main() {}\n```" + `
+
+Last paragraph with six words here.
+
+## Short
+
+Fits.
+`
+	c := NewWithOptions(Options{MaxTokens: 10})
+	chunks, err := c.ChunkFile([]byte(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var setup []Chunk
+	for _, ch := range chunks {
+		if ch.HeadingPath == "# Guide > ## Setup" {
+			setup = append(setup, ch)
+		}
+	}
+	if len(setup) < 3 {
+		t.Fatalf("expected the Setup section to be split, got %d pieces: %+v", len(setup), chunks)
+	}
+
+	wantStarts := map[string]int{
+		"## Setup":                            3,
+		"- item two is here":                  8,
+		"```go":                               10,
+		"Last paragraph with six words here.": 14,
+	}
+	for _, piece := range setup {
+		if len(strings.Fields(piece.Content)) > 10 {
+			t.Errorf("piece exceeds the budget: %q", piece.Content)
+		}
+		firstLine := strings.SplitN(piece.Content, "\n", 2)[0]
+		if want, ok := wantStarts[firstLine]; ok && piece.StartLine != want {
+			t.Errorf("piece starting %q should start on line %d, got %d", firstLine, want, piece.StartLine)
+		}
+		if piece.HeadingLevel != 2 {
+			t.Errorf("pieces should keep the heading level, got %d", piece.HeadingLevel)
+		}
+	}
+
+	// Code blocks are kept whole
+	for _, piece := range setup {
+		if strings.Contains(piece.Content, "func main") && !strings.Contains(piece.Content, "```go\nfunc main() {}\n```") {
+			t.Errorf("code block was split: %q", piece.Content)
+		}
+	}
+
+	last := chunks[len(chunks)-1]
+	if last.HeadingPath != "# Guide > ## Short" || last.Content != "## Short\n\nFits." || last.StartLine != 16 {
+		t.Errorf("short sections should be unchanged, got %+v", last)
+	}
+}
+
+func TestChunkFile_SplitOverlap(t *testing.T) {
+	input := "# Notes\n\nalpha one\n\nbravo two\n\ncharlie three\n\ndelta four\n"
+
+	c := NewWithOptions(Options{MaxTokens: 6, OverlapTokens: 2})
+	chunks, err := c.ChunkFile([]byte(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []struct {
+		content   string
+		startLine int
+	}{
+		{"# Notes\n\nalpha one\n\nbravo two", 1},
+		{"bravo two\n\ncharlie three\n\ndelta four", 5},
+	}
+	if len(chunks) != len(want) {
+		t.Fatalf("expected %d chunks, got %d: %+v", len(want), len(chunks), chunks)
+	}
+	for i, w := range want {
+		if chunks[i].Content != w.content || chunks[i].StartLine != w.startLine {
+			t.Errorf("chunk %d = %q at line %d, want %q at line %d", i, chunks[i].Content, chunks[i].StartLine, w.content, w.startLine)
+		}
+		if chunks[i].HeadingPath != "# Notes" {
+			t.Errorf("chunk %d should keep the heading path, got %q", i, chunks[i].HeadingPath)
+		}
+	}
+}
+
+func TestChunkFile_SplitsOversizedBlockByLine(t *testing.T) {
+	input := "# Log\n\n" + "```\none two\nthree four\nfive six\n```\n"
+
+	c := NewWithOptions(Options{MaxTokens: 4})
+	chunks, err := c.ChunkFile([]byte(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(chunks) < 2 {
+		t.Fatalf("expected the code block to be split by line, got %+v", chunks)
+	}
+	for _, ch := range chunks {
+		if len(strings.Fields(ch.Content)) > 4 {
+			t.Errorf("chunk exceeds the budget: %q", ch.Content)
+		}
+	}
+	if last := chunks[len(chunks)-1]; last.StartLine != 6 {
+		t.Errorf("expected the last piece on line 6, got %d (%q)", last.StartLine, last.Content)
+	}
+}
+
+func TestChunkFile_SplitUsesTokenCounter(t *testing.T) {
+	input := "# A\n\nxxxxxxxxxx\n\nyyyyyyyyyy\n"
+
+	// Count characters instead of words
+	c := NewWithOptions(Options{MaxTokens: 15, CountTokens: func(s string) int { return len(s) }})
+	chunks, err := c.ChunkFile([]byte(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(chunks) != 2 {
+		t.Fatalf("expected 2 chunks with a character budget, got %+v", chunks)
+	}
+}
+
+func TestChunkDocument_BudgetIncludesTemplate(t *testing.T) {
+	input := "# Setup\n\n" + strings.Repeat("One paragraph of exactly six words.\n\n", 4)
+	doc := Document{Title: "Payments Service Operations Handbook"}
+	// Like the model, count two special tokens in every text
+	count := func(s string) int { return len(strings.Fields(s)) + 2 }
+
+	c := NewWithOptions(Options{MaxTokens: 20, Template: ContextTemplate, CountTokens: count})
+	chunks, err := c.ChunkDocument(doc, []byte(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(chunks) < 2 {
+		t.Fatalf("expected the section to be split, got %+v", chunks)
+	}
+	for _, ch := range chunks {
+		text, err := c.EmbedText(doc, ch)
+		if err != nil {
+			t.Fatalf("EmbedText failed: %v", err)
+		}
+		if n := count(text); n > 20 {
+			t.Errorf("embedded text of %d tokens is over the budget: %q", n, text)
+		}
+	}
+
+	// Without a template the content has the whole budget
+	plain := NewWithOptions(Options{MaxTokens: 20, CountTokens: count})
+	if fewer, _ := plain.ChunkDocument(doc, []byte(input)); len(fewer) >= len(chunks) {
+		t.Errorf("expected fewer chunks without a template, got %d and %d", len(fewer), len(chunks))
+	}
+}
+
+func TestChunkFile_MergesSmallSections(t *testing.T) {
+	input := `# Service
+
+## Overview
+
+See below.
+
+## Setup
+
+Install the service with the package manager and start it.
+
+### Notes
+
+Optional.
+
+## FAQ
+
+Short.
+
+## Support
+
+Open a ticket in the tracker and include the request ID.
+`
+	c := NewWithOptions(Options{MinTokens: 5})
+	chunks, err := c.ChunkFile([]byte(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []struct {
+		headingPath string
+		level       int
+		startLine   int
+		contains    []string
+	}{
+		// The title alone is too small, so its first subsection folds into it
+		{"# Service", 1, 1, []string{"# Service", "## Overview", "See below."}},
+		// Setup is large enough and absorbs its small subsection
+		{"# Service > ## Setup", 2, 7, []string{"Install the service", "### Notes", "Optional."}},
+		// FAQ has no parent right before it, so it joins its next sibling
+		{"# Service > ## FAQ + ## Support", 2, 15, []string{"Short.", "## Support", "Open a ticket"}},
+	}
+	if len(chunks) != len(want) {
+		t.Fatalf("expected %d chunks, got %d: %+v", len(want), len(chunks), chunks)
+	}
+	for i, w := range want {
+		ch := chunks[i]
+		if ch.HeadingPath != w.headingPath || ch.HeadingLevel != w.level || ch.StartLine != w.startLine {
+			t.Errorf("chunk %d = %q (level %d, line %d), want %q (level %d, line %d)",
+				i, ch.HeadingPath, ch.HeadingLevel, ch.StartLine, w.headingPath, w.level, w.startLine)
+		}
+		for _, s := range w.contains {
+			if !strings.Contains(ch.Content, s) {
+				t.Errorf("chunk %d should contain %q, got %q", i, s, ch.Content)
+			}
+		}
+	}
+}
+
+func TestChunkFile_MergeKeepsUnfoldableSections(t *testing.T) {
+	// A small last section with no parent before it stays on its own
+	input := "# A\n\nLong enough body text for the minimum here.\n\n# B\n\nTiny.\n"
+
+	c := NewWithOptions(Options{MinTokens: 5})
+	chunks, err := c.ChunkFile([]byte(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(chunks) != 2 || chunks[1].HeadingPath != "# B" {
+		t.Errorf("expected the small section to be kept, got %+v", chunks)
+	}
+}
+
+func TestChunkFile_MergeThenSplit(t *testing.T) {
+	input := "# A\n\n## B\n\none two three\n\n## C\n\nfour five six\n"
+
+	c := NewWithOptions(Options{MinTokens: 6, MaxTokens: 20})
+	chunks, err := c.ChunkFile([]byte(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(chunks) != 1 || chunks[0].HeadingPath != "# A" {
+		t.Errorf("expected all sections folded into the title, got %+v", chunks)
+	}
+}
+
+func TestCombineHeadingPaths(t *testing.T) {
+	tests := []struct {
+		first, second, want string
+	}{
+		{"# A > ## B", "# A > ## C", "# A > ## B + ## C"},
+		{"# A > ## B + ## C", "# A > ## D", "# A > ## B + ## C + ## D"},
+		{"# A", "# B", "# A + # B"},
+	}
+	for _, tt := range tests {
+		if got := combineHeadingPaths(tt.first, tt.second); got != tt.want {
+			t.Errorf("combineHeadingPaths(%q, %q) = %q, want %q", tt.first, tt.second, got, tt.want)
+		}
+	}
+}
+
+func TestParseTemplate(t *testing.T) {
+	if _, err := ParseTemplate(ContextTemplate); err != nil {
+		t.Errorf("default template should parse: %v", err)
+	}
+	for _, text := range []string{"{{.Title", "{{.Author}}: {{.Content}}"} {
+		if _, err := ParseTemplate(text); err == nil {
+			t.Errorf("expected an error for %q", text)
+		}
+	}
+}
+
+func TestEmbedText(t *testing.T) {
+	chunk := Chunk{HeadingPath: "# Payments Service > ## Configuration", Content: "## Configuration\n\nSet the API key."}
+
+	tests := []struct {
+		name     string
+		template string
+		chunk    Chunk
+		want     string
+	}{
+		{"no template", "", chunk, chunk.Content},
+		{"context", ContextTemplate, chunk, "Payments\n# Payments Service > ## Configuration\n\n## Configuration\n\nSet the API key."},
+		{"context without heading", ContextTemplate, Chunk{Content: "Preamble."}, "Payments\n\nPreamble."},
+		{"custom", "{{.Path}}: {{.Content}}", chunk, "payments.md: " + chunk.Content},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewWithOptions(Options{Template: tt.template})
+			got, err := c.EmbedText(Document{Title: "Payments", Path: "payments.md"}, tt.chunk)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// An invalid template is reported rather than ignored
+	c := NewWithOptions(Options{Template: "{{.Title"})
+	if _, err := c.EmbedText(Document{Title: "Payments", Path: "payments.md"}, chunk); err == nil {
+		t.Error("expected an error for an invalid template")
+	}
+}
+
+func TestChunkFile_CodeLanguages(t *testing.T) {
+	input := "# Deploy\n\nApply the manifest:\n\n```YAML\nreplicas: 3\n```\n\nThen check:\n\n~~~json\n{\"ok\": true}\n~~~\n\n```\nplain\n```\n\n## Notes\n\nNo code here.\n"
+
+	chunks, err := New().ChunkFile([]byte(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(chunks) != 2 {
+		t.Fatalf("expected 2 chunks, got %d", len(chunks))
+	}
+	if chunks[0].Kind != KindText || chunks[0].Lang != "yaml json" {
+		t.Errorf("expected a text chunk with yaml and json code, got kind %q lang %q", chunks[0].Kind, chunks[0].Lang)
+	}
+	if !strings.Contains(chunks[0].Content, "replicas: 3") {
+		t.Error("code blocks should stay in the section by default")
+	}
+	if chunks[1].Kind != KindText || chunks[1].Lang != "" {
+		t.Errorf("expected a plain text chunk, got kind %q lang %q", chunks[1].Kind, chunks[1].Lang)
+	}
+}
+
+func TestChunkFile_SeparateCode(t *testing.T) {
+	input := `# Deploy
+
+Apply the manifest:
+
+` + "```yaml" + `
+replicas: 3
+image: app
+` + "```" + `
+
+Then check the rollout.
+
+## Verify
+
+- Run this:
+
+  ` + "```sh" + `
+  kubectl get pods
+  ` + "```" + `
+`
+	c := NewWithOptions(Options{SeparateCode: true})
+	chunks, err := c.ChunkFile([]byte(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []Chunk{
+		{HeadingPath: "# Deploy", HeadingLevel: 1, Content: "# Deploy\n\nApply the manifest:\n\nThen check the rollout.", StartLine: 1, Kind: KindText},
+		{HeadingPath: "# Deploy", HeadingLevel: 1, Content: "```yaml\nreplicas: 3\nimage: app\n```", StartLine: 5, Kind: KindCode, Lang: "yaml"},
+		{HeadingPath: "# Deploy > ## Verify", HeadingLevel: 2, Content: "## Verify\n\n- Run this:", StartLine: 12, Kind: KindText},
+		{HeadingPath: "# Deploy > ## Verify", HeadingLevel: 2, Content: "```sh\n  kubectl get pods\n  ```", StartLine: 16, Kind: KindCode, Lang: "sh"},
+	}
+	if len(chunks) != len(want) {
+		t.Fatalf("expected %d chunks, got %d: %+v", len(want), len(chunks), chunks)
+	}
+	for i := range want {
+		if chunks[i] != want[i] {
+			t.Errorf("chunk %d = %+v, want %+v", i, chunks[i], want[i])
+		}
+	}
+}
+
+func TestChunkFile_SeparateCodeOnceWithOverlap(t *testing.T) {
+	input := "# A\n\none two three four\n\n```go\nfmt.Println()\n```\n\nfive six seven eight\n"
+
+	// The code block is repeated in both pieces by the overlap
+	c := NewWithOptions(Options{MaxTokens: 9, OverlapTokens: 4, SeparateCode: true})
+	chunks, err := c.ChunkFile([]byte(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	code := 0
+	for _, ch := range chunks {
+		if ch.Kind == KindCode {
+			code++
+		} else if strings.Contains(ch.Content, "fmt.Println") {
+			t.Errorf("code should be moved out of the prose, got %q", ch.Content)
+		}
+	}
+	if len(chunks) != 3 || code != 1 {
+		t.Errorf("expected two pieces of prose and the code block once, got %+v", chunks)
+	}
+}
+
+func TestChunkFile_GFMTable(t *testing.T) {
+	// Without the table extension, the delimiter row would make the header a
+	// setext heading
+	input := `# API
+
+Name | Type
+--- | ---
+limit | integer
+
+- [x] Task list item
+
+Text with a footnote[^1] and ~~strikethrough~~.
+
+[^1]: The footnote.
+`
+	chunks, err := New().ChunkFile([]byte(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(chunks) != 1 || chunks[0].HeadingPath != "# API" {
+		t.Fatalf("expected a single section, got %+v", chunks)
+	}
+	if !strings.Contains(chunks[0].Content, "limit | integer") || !strings.Contains(chunks[0].Content, "[^1]: The footnote.") {
+		t.Errorf("section should keep its table and footnote, got %q", chunks[0].Content)
+	}
+}
+
+func TestEmbedText_Tables(t *testing.T) {
+	content := `## Parameters
+
+| Name | Type | Description |
+|------|------|-------------|
+| ` + "`limit`" + ` | integer | Maximum **number** of results |
+| mode | | See [modes](#modes) |
+|  | string | Unnamed |
+
+Both are optional.`
+
+	got, err := New().EmbedText(Document{Title: "API", Path: "api.md"}, Chunk{Content: content})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `## Parameters
+
+Name: limit; Type: integer; Description: Maximum number of results
+Name: mode; Description: See modes
+Type: string; Description: Unnamed
+
+Both are optional.`
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Content without tables is embedded as is
+	plain := "## Notes\n\nA | B is not a table."
+	if got, _ := New().EmbedText(Document{Title: "API", Path: "api.md"}, Chunk{Content: plain}); got != plain {
+		t.Errorf("expected content without tables to be unchanged, got %q", got)
+	}
+}
+
+func TestRenderTable_HeaderOnly(t *testing.T) {
+	got := New().renderTables("| Name | Type |\n|---|---|\n")
+	if got != "Name; Type\n" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestLinks(t *testing.T) {
+	content := `Intro with a [local link](#setup).
+
+# Guide
+
+See [the setup](../setup.md#install "Setup") and <https://example.com>.
+
+## Setup
+
+- Read the [reference][ref].
+- ![diagram](diagram.png)
+
+## Setup
+
+[ref]: reference.md
+`
+	links, anchors := New().Links([]byte(content))
+
+	wantLinks := []Link{
+		{Destination: "#setup", Text: "local link", HeadingPath: "(root)", Line: 1},
+		{Destination: "../setup.md#install", Text: "the setup", HeadingPath: "# Guide", Line: 5},
+		{Destination: "https://example.com", Text: "https://example.com", HeadingPath: "# Guide", Line: 5},
+		{Destination: "reference.md", Text: "reference", HeadingPath: "# Guide > ## Setup", Line: 9},
+	}
+	if len(links) != len(wantLinks) {
+		t.Fatalf("expected %d links, got %d: %+v", len(wantLinks), len(links), links)
+	}
+	for i, want := range wantLinks {
+		if links[i] != want {
+			t.Errorf("link %d: got %+v, want %+v", i, links[i], want)
+		}
+	}
+
+	wantAnchors := []Anchor{
+		{Slug: "guide", HeadingPath: "# Guide", Line: 3},
+		{Slug: "setup", HeadingPath: "# Guide > ## Setup", Line: 7},
+		{Slug: "setup-1", HeadingPath: "# Guide > ## Setup", Line: 12},
+	}
+	if len(anchors) != len(wantAnchors) {
+		t.Fatalf("expected %d anchors, got %d: %+v", len(wantAnchors), len(anchors), anchors)
+	}
+	for i, want := range wantAnchors {
+		if anchors[i] != want {
+			t.Errorf("anchor %d: got %+v, want %+v", i, anchors[i], want)
+		}
+	}
+}
+
+func TestSlug(t *testing.T) {
+	tests := map[string]string{
+		"Install the CLI":        "install-the-cli",
+		"  What's new?  ":        "whats-new",
+		"API: search_docs (v2)":  "api-search_docs-v2",
+		"Résumé & CV":            "résumé--cv",
+		"Step 1 - Configure it.": "step-1---configure-it",
+	}
+	for heading, want := range tests {
+		if got := Slug(heading); got != want {
+			t.Errorf("Slug(%q) = %q, want %q", heading, got, want)
+		}
+	}
+}
+
+func TestLinks_Obsidian(t *testing.T) {
+	content := `# Notes
+
+See [[Setup]], [[Setup#Install the CLI|installing]] and [[#Notes]].
+
+![[Architecture]] and ![[diagram.png]]
+
+| Note | Link |
+|------|------|
+| a | [[Guides/Deploy\|deploying]] |
+
+` + "`[[not a link]]`" + `
+`
+	c := NewWithOptions(Options{Obsidian: true})
+	links, _ := c.Links([]byte(content))
+
+	want := []Link{
+		{Destination: "[[Setup]]", Text: "Setup", Wiki: true, Page: "Setup"},
+		{Destination: "[[Setup#Install the CLI|installing]]", Text: "installing", Wiki: true, Page: "Setup", Heading: "Install the CLI"},
+		{Destination: "[[#Notes]]", Text: "#Notes", Wiki: true, Heading: "Notes"},
+		{Destination: "![[Architecture]]", Text: "Architecture", Wiki: true, Page: "Architecture", Embed: true},
+		{Destination: "![[diagram.png]]", Text: "diagram.png", Wiki: true, Page: "diagram.png", Embed: true},
+		{Destination: `[[Guides/Deploy\|deploying]]`, Text: "deploying", Wiki: true, Page: "Guides/Deploy"},
+	}
+	if len(links) != len(want) {
+		t.Fatalf("expected %d links, got %d: %+v", len(want), len(links), links)
+	}
+	for i, w := range want {
+		w.HeadingPath = "# Notes"
+		w.Line = []int{3, 3, 3, 5, 5, 9}[i]
+		if links[i] != w {
+			t.Errorf("link %d: got %+v, want %+v", i, links[i], w)
+		}
+	}
+
+	// Without Obsidian syntax wikilinks are text
+	if links, _ := New().Links([]byte(content)); len(links) != 0 {
+		t.Errorf("expected no links without Obsidian syntax, got %+v", links)
+	}
+}
+
+func TestTags(t *testing.T) {
+	content := `# Meeting #weekly
+
+Discussed #project/alpha and #design-review (#project/alpha again).
+
+Not tags: #1, issue PR#12, [a link](#notes) and https://example.com/#top.
+
+` + "```" + `
+#comment in code
+` + "```" + `
+`
+	got := NewWithOptions(Options{Obsidian: true}).Tags([]byte(content))
+	if want := "weekly project/alpha design-review"; strings.Join(got, " ") != want {
+		t.Errorf("got %v, want %s", got, want)
+	}
+
+	if got := New().Tags([]byte(content)); got != nil {
+		t.Errorf("expected no tags without Obsidian syntax, got %v", got)
+	}
+}
+
+func TestEmbedText_Obsidian(t *testing.T) {
+	c := NewWithOptions(Options{Obsidian: true, Template: ContextTemplate})
+	doc := Document{Title: "Deploy", Path: "deploy.md", Aliases: []string{"Shipping", "Release process"}}
+	chunk := Chunk{HeadingPath: "# Deploy", Content: "# Deploy\n\nRead [[Setup#Install|the install steps]] first, then ![[Checklist]]. Tagged #ops."}
+
+	got, err := c.EmbedText(doc, chunk)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "Deploy (Shipping, Release process)\n# Deploy\n\n# Deploy\n\nRead the install steps first, then Checklist. Tagged #ops."
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
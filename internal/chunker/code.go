@@ -0,0 +1,144 @@
+package chunker
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+// Kinds of chunk.
+const (
+	KindText = "text"
+	KindCode = "code"
+)
+
+// codeBlock is a fenced code block, from its opening fence to the end of its
+// closing fence.
+type codeBlock struct {
+	start, end int
+	lang       string // lowercased language of the info string; "" if none
+}
+
+// collectCodeBlocks returns the fenced code blocks of the document in order,
+// including those nested in lists and block quotes.
+func collectCodeBlocks(doc ast.Node, source []byte) []codeBlock {
+	var blocks []codeBlock
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		fence, ok := n.(*ast.FencedCodeBlock)
+		if !ok || !entering {
+			return ast.WalkContinue, nil
+		}
+		if start, ok := blockStart(fence, source); ok {
+			blocks = append(blocks, codeBlock{
+				start: start,
+				end:   fenceEnd(fence, source, start),
+				lang:  strings.ToLower(string(fence.Language(source))),
+			})
+		}
+		return ast.WalkSkipChildren, nil
+	})
+	return blocks
+}
+
+// fenceEnd returns the offset just past the closing fence of a block that
+// starts at start, or past its last line if it is not closed.
+func fenceEnd(fence *ast.FencedCodeBlock, source []byte, start int) int {
+	end := lineEnd(source, start)
+	if lines := fence.Lines(); lines.Len() > 0 {
+		end = lineEnd(source, lines.At(lines.Len()-1).Start)
+	}
+	if end < len(source) {
+		closing := bytes.TrimSpace(source[end:lineEnd(source, end)])
+		if bytes.HasPrefix(closing, []byte("```")) || bytes.HasPrefix(closing, []byte("~~~")) {
+			end = lineEnd(source, end)
+		}
+	}
+	return end
+}
+
+// lineEnd returns the offset just past the line containing pos.
+func lineEnd(source []byte, pos int) int {
+	if i := bytes.IndexByte(source[pos:], '\n'); i >= 0 {
+		return pos + i + 1
+	}
+	return len(source)
+}
+
+// code records the languages of the code blocks in each section. With
+// SeparateCode, code blocks inside a section are moved out of it into chunks
+// of their own, which keep the section's heading path and follow it.
+func (c *Chunker) code(sections []section, blocks []codeBlock, source []byte) []section {
+	var out []section
+	emitted := make(map[int]bool) // blocks repeated by overlap become one chunk
+	for _, sec := range sections {
+		sec.Kind = KindText
+
+		var prose []string
+		var codeChunks []section
+		var langs []string
+		pos := sec.start
+		for i, b := range blocks {
+			if b.end <= sec.start || b.start >= sec.end {
+				continue
+			}
+			// Blocks cut up by splitting stay where they are
+			if !c.opts.SeparateCode || b.start < sec.start || b.end > sec.end {
+				langs = appendLang(langs, b.lang)
+				continue
+			}
+			prose = append(prose, string(source[pos:b.start]))
+			pos = b.end
+			if emitted[i] {
+				continue
+			}
+			emitted[i] = true
+			codeChunks = append(codeChunks, section{
+				Chunk: Chunk{
+					HeadingPath:  sec.HeadingPath,
+					HeadingLevel: sec.HeadingLevel,
+					Content:      strings.TrimSpace(string(source[b.start:b.end])),
+					StartLine:    contentLine(source, b.start),
+					Kind:         KindCode,
+					Lang:         b.lang,
+				},
+				start: b.start,
+				end:   b.end,
+			})
+		}
+		sec.Lang = strings.Join(langs, " ")
+
+		if pos > sec.start {
+			prose = append(prose, string(source[pos:sec.end]))
+			sec.Content = joinProse(prose)
+		}
+		if sec.Content != "" {
+			out = append(out, sec)
+		}
+		out = append(out, codeChunks...)
+	}
+	return out
+}
+
+// joinProse joins the text left between code blocks as paragraphs.
+func joinProse(parts []string) string {
+	var kept []string
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			kept = append(kept, part)
+		}
+	}
+	return strings.Join(kept, "\n\n")
+}
+
+func appendLang(langs []string, lang string) []string {
+	if lang == "" {
+		return langs
+	}
+	for _, l := range langs {
+		if l == lang {
+			return langs
+		}
+	}
+	return append(langs, lang)
+}
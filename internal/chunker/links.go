@@ -0,0 +1,155 @@
+package chunker
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// Link is a link in a markdown document: an inline or reference link, an
+// autolink, or with Options.Obsidian a wikilink or embed.
+type Link struct {
+	Destination string // as written, e.g. "../setup.md#install" or "[[Setup#Install]]"
+	Text        string
+	HeadingPath string // section the link is in
+	Line        int
+
+	// Wikilinks name a note rather than a path, e.g. "Setup" and "Install"
+	// for [[Setup#Install|installing]].
+	Wiki    bool
+	Page    string // "" for a heading of the same note
+	Heading string
+	Embed   bool // ![[embed]]
+}
+
+// Anchor is a heading that can be linked to with a fragment, such as
+// "#install-the-cli" for "## Install the CLI".
+type Anchor struct {
+	Slug        string
+	HeadingPath string
+	Line        int
+}
+
+// Links returns the links in a markdown document and the anchors of its
+// headings, in order.
+func (c *Chunker) Links(source []byte) ([]Link, []Anchor) {
+	doc := c.md.Parser().Parse(text.NewReader(source))
+	headings := collectHeadings(doc, source)
+
+	var sections []section
+	if len(headings) == 0 {
+		sections = []section{{Chunk: Chunk{HeadingPath: "(root)"}, end: len(source)}}
+	} else {
+		sections = buildChunks(headings, source)
+	}
+	sectionAt := func(pos int) string {
+		path := "(root)"
+		for _, sec := range sections {
+			if sec.start <= pos {
+				path = sec.HeadingPath
+			}
+		}
+		return path
+	}
+
+	var links []Link
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		var link Link
+		switch n := n.(type) {
+		case *ast.Link:
+			var label bytes.Buffer
+			extractText(n, source, &label)
+			link = Link{Destination: string(n.Destination), Text: strings.TrimSpace(label.String())}
+		case *ast.AutoLink:
+			link = Link{Destination: string(n.URL(source)), Text: string(n.Label(source))}
+		case *wikiLink:
+			link = Link{
+				Destination: string(source[n.start:n.end]),
+				Text:        string(n.label(source)),
+				Wiki:        true,
+				Page:        n.page,
+				Heading:     n.heading,
+				Embed:       n.embed,
+			}
+		default:
+			return ast.WalkContinue, nil
+		}
+		if link.Destination == "" {
+			return ast.WalkSkipChildren, nil
+		}
+		pos := inlinePos(n)
+		link.HeadingPath = sectionAt(pos)
+		link.Line = countLines(source[:pos]) + 1
+		links = append(links, link)
+		return ast.WalkSkipChildren, nil
+	})
+
+	return links, collectAnchors(headings)
+}
+
+// collectAnchors returns the anchors of the headings. Repeated slugs get a
+// numbered suffix, as on GitHub: "setup", "setup-1", "setup-2".
+func collectAnchors(headings []headingInfo) []Anchor {
+	anchors := make([]Anchor, 0, len(headings))
+	seen := make(map[string]int)
+	var stack []stackItem
+	for _, h := range headings {
+		stack = updateHeadingStack(stack, h)
+		slug := Slug(h.text)
+		if n := seen[slug]; n > 0 {
+			seen[slug]++
+			slug = fmt.Sprintf("%s-%d", slug, n)
+		} else {
+			seen[slug] = 1
+		}
+		anchors = append(anchors, Anchor{Slug: slug, HeadingPath: buildHeadingPath(stack), Line: h.startLine})
+	}
+	return anchors
+}
+
+// Slug returns the anchor of a heading: lowercased, with punctuation removed
+// and spaces replaced by hyphens.
+func Slug(heading string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(heading)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_':
+			b.WriteRune(r)
+		case r == ' ':
+			b.WriteByte('-')
+		}
+	}
+	return b.String()
+}
+
+// inlinePos returns the offset of an inline node: that of its first text, or
+// else the start of the block it is in.
+func inlinePos(n ast.Node) int {
+	pos := -1
+	ast.Walk(n, func(child ast.Node, entering bool) (ast.WalkStatus, error) {
+		if t, ok := child.(*ast.Text); ok && entering && pos < 0 {
+			pos = t.Segment.Start
+			return ast.WalkStop, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	if pos >= 0 {
+		return pos
+	}
+	for p := n.Parent(); p != nil; p = p.Parent() {
+		if p.Type() != ast.TypeBlock {
+			continue
+		}
+		if lines := p.Lines(); lines != nil && lines.Len() > 0 {
+			return lines.At(0).Start
+		}
+	}
+	return 0
+}
@@ -0,0 +1,91 @@
+package chunker
+
+import "strings"
+
+// headingSeparator joins the headings of a heading path.
+const headingSeparator = " > "
+
+// merge folds sections under MinTokens into the parent section right before
+// them or, failing that, into their next sibling. A section folded into its
+// parent becomes part of the parent's body; siblings folded together get a
+// combined heading path such as "# Guide > ## Overview + ## Setup".
+func (c *Chunker) merge(sections []section, source []byte) []section {
+	var out []section
+	var carry *section // undersized section waiting for its next sibling
+
+	for i := range sections {
+		sec := sections[i]
+		if carry != nil {
+			sec = joinSections(*carry, sec, combineHeadingPaths(carry.HeadingPath, sec.HeadingPath), source)
+			carry = nil
+		}
+
+		if c.opts.CountTokens(sec.Content) >= c.opts.MinTokens {
+			out = append(out, sec)
+			continue
+		}
+		if len(out) > 0 && isParent(out[len(out)-1], sec) {
+			last := out[len(out)-1]
+			out[len(out)-1] = joinSections(last, sec, last.HeadingPath, source)
+			continue
+		}
+		if i+1 < len(sections) && isSibling(sec, sections[i+1]) {
+			carry = &sec
+			continue
+		}
+		out = append(out, sec)
+	}
+
+	return out
+}
+
+// joinSections combines two adjacent sections into one spanning both.
+func joinSections(first, second section, headingPath string, source []byte) section {
+	return section{
+		Chunk: Chunk{
+			HeadingPath:  headingPath,
+			HeadingLevel: first.HeadingLevel,
+			Content:      strings.TrimSpace(string(source[first.start:second.end])),
+			StartLine:    first.StartLine,
+		},
+		start: first.start,
+		end:   second.end,
+	}
+}
+
+// isParent reports whether child is a subsection of parent.
+func isParent(parent, child section) bool {
+	return parent.HeadingLevel > 0 && parent.HeadingLevel < child.HeadingLevel &&
+		strings.HasPrefix(child.HeadingPath, parent.HeadingPath+headingSeparator)
+}
+
+// isSibling reports whether two sections have the same level and parent.
+func isSibling(a, b section) bool {
+	return a.HeadingLevel > 0 && a.HeadingLevel == b.HeadingLevel &&
+		parentPath(a.HeadingPath) == parentPath(b.HeadingPath)
+}
+
+// parentPath returns the heading path without its last heading.
+func parentPath(path string) string {
+	if i := strings.LastIndex(path, headingSeparator); i >= 0 {
+		return path[:i]
+	}
+	return ""
+}
+
+// combineHeadingPaths names two sibling sections, e.g. "# A > ## B" and
+// "# A > ## C" become "# A > ## B + ## C".
+func combineHeadingPaths(first, second string) string {
+	parent := parentPath(second)
+	leaf := func(path string) string {
+		if parent == "" {
+			return path
+		}
+		return strings.TrimPrefix(path, parent+headingSeparator)
+	}
+	combined := leaf(first) + " + " + leaf(second)
+	if parent == "" {
+		return combined
+	}
+	return parent + headingSeparator + combined
+}
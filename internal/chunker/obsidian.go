@@ -0,0 +1,214 @@
+package chunker
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Obsidian syntax, parsed with Options.Obsidian:
+//
+//	[[Page]]  [[Page#Heading|alias]]  [[#Heading]]  ![[Embedded note]]  #tag
+var (
+	kindWikiLink = ast.NewNodeKind("WikiLink")
+	kindTag      = ast.NewNodeKind("Tag")
+)
+
+// wikiLink is a [[wikilink]] or an ![[embed]]. Its child is the text it
+// displays: the alias if there is one, or else the target.
+type wikiLink struct {
+	ast.BaseInline
+	page       string // note or file linked to; "" for a heading of the same note
+	heading    string // "" if none
+	embed      bool
+	start, end int // offsets of the link as written, "!" included
+}
+
+func (n *wikiLink) Kind() ast.NodeKind { return kindWikiLink }
+
+func (n *wikiLink) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{
+		"Page":    n.page,
+		"Heading": n.heading,
+		"Embed":   fmt.Sprint(n.embed),
+	}, nil)
+}
+
+// label returns the text the link displays.
+func (n *wikiLink) label(source []byte) []byte {
+	return n.FirstChild().(*ast.Text).Segment.Value(source)
+}
+
+// tag is an inline #tag. Its child is the text of the tag, "#" included.
+type tag struct {
+	ast.BaseInline
+	name string // without the "#", e.g. "project/alpha"
+}
+
+func (n *tag) Kind() ast.NodeKind { return kindTag }
+
+func (n *tag) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Name": n.name}, nil)
+}
+
+// obsidian is the goldmark extension for vault syntax.
+type obsidian struct{}
+
+func (obsidian) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithInlineParsers(
+		// Ahead of the link parser, which also starts at "[" and "!"
+		util.Prioritized(wikiLinkParser{}, 199),
+		util.Prioritized(tagParser{}, 999),
+	))
+}
+
+type wikiLinkParser struct{}
+
+func (wikiLinkParser) Trigger() []byte { return []byte{'[', '!'} }
+
+func (wikiLinkParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, seg := block.PeekLine()
+	open := 2
+	embed := bytes.HasPrefix(line, []byte("!"))
+	if embed {
+		open = 3
+	}
+	if !bytes.HasPrefix(line[open-2:], []byte("[[")) {
+		return nil
+	}
+	end := bytes.Index(line[open:], []byte("]]"))
+	if end <= 0 {
+		return nil
+	}
+	inner := line[open : open+end]
+	if bytes.ContainsAny(inner, "[]\n") {
+		return nil
+	}
+
+	// The target, then the alias after a "|", which is escaped in tables
+	target, label := inner, inner
+	labelStart := open
+	if i := bytes.IndexByte(inner, '|'); i >= 0 {
+		target = bytes.TrimSuffix(inner[:i], []byte(`\`))
+		if alias := bytes.TrimSpace(inner[i+1:]); len(alias) > 0 {
+			label = inner[i+1:]
+			labelStart = open + i + 1
+		} else {
+			label = target
+		}
+	}
+	page, heading, _ := strings.Cut(string(target), "#")
+	node := &wikiLink{
+		page:    strings.TrimSpace(page),
+		heading: strings.TrimSpace(heading),
+		embed:   embed,
+		start:   seg.Start,
+		end:     seg.Start + open + end + 2,
+	}
+	if node.page == "" && node.heading == "" {
+		return nil
+	}
+
+	labelSeg := text.NewSegment(seg.Start+labelStart, seg.Start+labelStart+len(label))
+	labelSeg = labelSeg.TrimLeftSpace(block.Source())
+	node.AppendChild(node, ast.NewTextSegment(labelSeg.TrimRightSpace(block.Source())))
+	block.Advance(open + end + 2)
+	return node
+}
+
+type tagParser struct{}
+
+func (tagParser) Trigger() []byte { return []byte{'#'} }
+
+func (tagParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	// A tag starts a word, unlike the "#" of a URL fragment or an issue
+	// reference such as "PR#12"
+	if prev := block.PrecendingCharacter(); !unicode.IsSpace(prev) && prev != '(' {
+		return nil
+	}
+	line, seg := block.PeekLine()
+	n := 1
+	digits := true
+	for n < len(line) {
+		r, size := utf8.DecodeRune(line[n:])
+		if !isTagRune(r) {
+			break
+		}
+		if !unicode.IsDigit(r) {
+			digits = false
+		}
+		n += size
+	}
+	// "#1" is not a tag
+	if n == 1 || digits {
+		return nil
+	}
+
+	node := &tag{name: string(line[1:n])}
+	node.AppendChild(node, ast.NewTextSegment(text.NewSegment(seg.Start, seg.Start+n)))
+	block.Advance(n)
+	return node
+}
+
+func isTagRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-' || r == '/'
+}
+
+// Tags returns the inline #tags of a markdown document without their "#",
+// once each in order of appearance. Only Obsidian syntax has inline tags.
+func (c *Chunker) Tags(source []byte) []string {
+	if !c.opts.Obsidian {
+		return nil
+	}
+	doc := c.md.Parser().Parse(text.NewReader(source))
+
+	var tags []string
+	seen := make(map[string]bool)
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if t, ok := n.(*tag); ok && entering && !seen[t.name] {
+			seen[t.name] = true
+			tags = append(tags, t.name)
+		}
+		return ast.WalkContinue, nil
+	})
+	return tags
+}
+
+// renderWikiLinks rewrites wikilinks and embeds in markdown as the text they
+// display, so that "[[Setup#Install|installing]]" is embedded as "installing".
+func (c *Chunker) renderWikiLinks(markdown string) string {
+	if !c.opts.Obsidian || !strings.Contains(markdown, "[[") {
+		return markdown
+	}
+	source := []byte(markdown)
+	doc := c.md.Parser().Parse(text.NewReader(source))
+
+	var b strings.Builder
+	pos := 0
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		link, ok := n.(*wikiLink)
+		if !entering || !ok {
+			return ast.WalkContinue, nil
+		}
+		if link.start < pos {
+			return ast.WalkSkipChildren, nil
+		}
+		b.Write(source[pos:link.start])
+		b.Write(link.label(source))
+		pos = link.end
+		return ast.WalkSkipChildren, nil
+	})
+	if pos == 0 {
+		return markdown
+	}
+	b.Write(source[pos:])
+	return b.String()
+}
@@ -0,0 +1,214 @@
+package chunker
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+// unit is a run of source bytes that a section can be split around: a block,
+// a list item or, for blocks over the budget, a line.
+type unit struct {
+	start, end int
+	tokens     int
+}
+
+// collectBlockStarts returns the offsets of the lines where top-level blocks
+// and the items of top-level lists start, in order.
+func collectBlockStarts(doc ast.Node, source []byte) []int {
+	var starts []int
+	for n := doc.FirstChild(); n != nil; n = n.NextSibling() {
+		if start, ok := blockStart(n, source); ok {
+			starts = append(starts, start)
+		}
+		if _, ok := n.(*ast.List); ok {
+			for item := n.FirstChild(); item != nil; item = item.NextSibling() {
+				if start, ok := blockStart(item, source); ok {
+					starts = append(starts, start)
+				}
+			}
+		}
+	}
+	sort.Ints(starts)
+	return starts
+}
+
+// blockStart returns the offset of the first line of a block. Blocks without
+// lines of their own, such as thematic breaks, are not reported.
+func blockStart(n ast.Node, source []byte) (int, bool) {
+	if fence, ok := n.(*ast.FencedCodeBlock); ok {
+		// The opening fence precedes the content lines
+		if fence.Info != nil {
+			return lineStart(source, fence.Info.Segment.Start), true
+		}
+		if fence.Lines().Len() > 0 {
+			contentStart := lineStart(source, fence.Lines().At(0).Start)
+			if contentStart > 0 {
+				return lineStart(source, contentStart-1), true
+			}
+		}
+		return 0, false
+	}
+
+	start := -1
+	ast.Walk(n, func(child ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering || child.Type() != ast.TypeBlock {
+			return ast.WalkContinue, nil
+		}
+		if lines := child.Lines(); lines != nil && lines.Len() > 0 {
+			if s := lines.At(0).Start; start < 0 || s < start {
+				start = s
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	if start < 0 {
+		return 0, false
+	}
+	return lineStart(source, start), true
+}
+
+// lineStart returns the offset of the line containing pos.
+func lineStart(source []byte, pos int) int {
+	return bytes.LastIndexByte(source[:pos], '\n') + 1
+}
+
+// split breaks sections over the token budget into pieces that keep the
+// section's heading path, each starting on a block boundary.
+func (c *Chunker) split(doc Document, sections []section, blockStarts []int, source []byte) []section {
+	var out []section
+	for _, sec := range sections {
+		budget := c.budget(doc, sec.Chunk)
+		if c.opts.CountTokens(sec.Content) <= budget {
+			out = append(out, sec)
+			continue
+		}
+		out = append(out, c.splitSection(sec, budget, blockStarts, source)...)
+	}
+	return out
+}
+
+// budget returns the tokens left for the content of a chunk once the text
+// the embedding template adds around it is counted, and at least one.
+func (c *Chunker) budget(doc Document, chunk Chunk) int {
+	if c.opts.Template == "" || c.tmplErr != nil {
+		return c.opts.MaxTokens
+	}
+	chunk.Content = ""
+	prefix, err := c.EmbedText(doc, chunk)
+	if err != nil {
+		return c.opts.MaxTokens
+	}
+	// Token counts may include a fixed overhead, such as special tokens
+	added := c.opts.CountTokens(prefix) - c.opts.CountTokens("")
+	return max(c.opts.MaxTokens-added, 1)
+}
+
+func (c *Chunker) splitSection(sec section, budget int, blockStarts []int, source []byte) []section {
+	units := c.units(sec, budget, blockStarts, source)
+	if len(units) < 2 {
+		return []section{sec}
+	}
+
+	var pieces [][]unit
+	var current []unit
+	tokens := 0
+	for _, u := range units {
+		if len(current) > 0 && tokens+u.tokens > budget {
+			pieces = append(pieces, current)
+			current = c.overlap(current, budget-u.tokens)
+			tokens = sumTokens(current)
+		}
+		current = append(current, u)
+		tokens += u.tokens
+	}
+	pieces = append(pieces, current)
+
+	out := make([]section, len(pieces))
+	for i, piece := range pieces {
+		start, end := piece[0].start, piece[len(piece)-1].end
+		out[i] = section{
+			Chunk: Chunk{
+				HeadingPath:  sec.HeadingPath,
+				HeadingLevel: sec.HeadingLevel,
+				Content:      strings.TrimSpace(string(source[start:end])),
+				StartLine:    contentLine(source, start),
+			},
+			start: start,
+			end:   end,
+		}
+	}
+	// The first piece starts where the section does
+	out[0].StartLine = sec.StartLine
+	return out
+}
+
+// units divides a section on the block starts inside it. Blocks over the
+// budget are divided further into lines.
+func (c *Chunker) units(sec section, budget int, blockStarts []int, source []byte) []unit {
+	bounds := []int{sec.start}
+	for _, start := range blockStarts {
+		if start > sec.start && start < sec.end {
+			bounds = append(bounds, start)
+		}
+	}
+	bounds = append(bounds, sec.end)
+
+	var units []unit
+	add := func(start, end int) {
+		if text := strings.TrimSpace(string(source[start:end])); text != "" {
+			units = append(units, unit{start: start, end: end, tokens: c.opts.CountTokens(text)})
+		}
+	}
+
+	for i := 0; i+1 < len(bounds); i++ {
+		start, end := bounds[i], bounds[i+1]
+		if c.opts.CountTokens(strings.TrimSpace(string(source[start:end]))) <= budget {
+			add(start, end)
+			continue
+		}
+		for start < end {
+			next := bytes.IndexByte(source[start:end], '\n')
+			if next < 0 {
+				next = end
+			} else {
+				next += start + 1
+			}
+			add(start, next)
+			start = next
+		}
+	}
+	return units
+}
+
+// overlap returns the trailing units of a piece to repeat at the start of the
+// next one: as many as fit in OverlapTokens and the given room, never the
+// whole piece.
+func (c *Chunker) overlap(piece []unit, room int) []unit {
+	budget := min(c.opts.OverlapTokens, room)
+	tokens := 0
+	first := len(piece)
+	for first > 1 && tokens+piece[first-1].tokens <= budget {
+		first--
+		tokens += piece[first].tokens
+	}
+	return append([]unit(nil), piece[first:]...)
+}
+
+func sumTokens(units []unit) int {
+	total := 0
+	for _, u := range units {
+		total += u.tokens
+	}
+	return total
+}
+
+// contentLine returns the 1-based line of the first non-space byte at or after pos.
+func contentLine(source []byte, pos int) int {
+	for pos < len(source) && (source[pos] == ' ' || source[pos] == '\t' || source[pos] == '\n' || source[pos] == '\r') {
+		pos++
+	}
+	return countLines(source[:pos]) + 1
+}
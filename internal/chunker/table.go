@@ -0,0 +1,134 @@
+package chunker
+
+import (
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	east "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// renderTables rewrites the GFM tables in markdown as one line per row of
+// "header: value" pairs, which embed better than rows of pipes:
+//
+//	| Name  | Type    |        Name: limit; Type: integer
+//	|-------|---------|   =>   Name: mode; Type: string
+//	| limit | integer |
+//	| mode  | string  |
+func (c *Chunker) renderTables(markdown string) string {
+	source := []byte(markdown)
+	doc := c.md.Parser().Parse(text.NewReader(source))
+
+	var b strings.Builder
+	pos := 0
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		table, ok := n.(*east.Table)
+		if !entering || !ok {
+			return ast.WalkContinue, nil
+		}
+		start, end, ok := tableSpan(table, source)
+		if !ok || start < pos {
+			return ast.WalkSkipChildren, nil
+		}
+		b.Write(source[pos:start])
+		b.WriteString(renderTable(table, source))
+		b.WriteByte('\n')
+		pos = end
+		return ast.WalkSkipChildren, nil
+	})
+	if pos == 0 {
+		return markdown
+	}
+	b.Write(source[pos:])
+	return b.String()
+}
+
+// tableSpan returns the offsets of the lines a table occupies.
+func tableSpan(table *east.Table, source []byte) (int, int, bool) {
+	start, end := -1, -1
+	ast.Walk(table, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering || n.Type() != ast.TypeBlock {
+			return ast.WalkContinue, nil
+		}
+		if lines := n.Lines(); lines != nil && lines.Len() > 0 {
+			if s := lines.At(0).Start; start < 0 || s < start {
+				start = s
+			}
+			if e := lines.At(lines.Len() - 1).Stop; e > end {
+				end = e
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	if start < 0 {
+		return 0, 0, false
+	}
+	end = lineEnd(source, end-1)
+
+	// The delimiter row under the header has no cells of its own
+	if delimiter := lineEnd(source, start); delimiter < len(source) {
+		end = max(end, lineEnd(source, delimiter))
+	}
+	return lineStart(source, start), end, true
+}
+
+// renderTable writes each body row as "header: value" pairs. Empty cells are
+// left out, and a cell under an empty header is written on its own.
+func renderTable(table *east.Table, source []byte) string {
+	var headers []string
+	var rows []string
+	for row := table.FirstChild(); row != nil; row = row.NextSibling() {
+		cells := cellTexts(row, source)
+		if _, ok := row.(*east.TableHeader); ok {
+			headers = cells
+			continue
+		}
+
+		var pairs []string
+		for i, cell := range cells {
+			switch {
+			case cell == "":
+			case i < len(headers) && headers[i] != "":
+				pairs = append(pairs, headers[i]+": "+cell)
+			default:
+				pairs = append(pairs, cell)
+			}
+		}
+		if len(pairs) > 0 {
+			rows = append(rows, strings.Join(pairs, "; "))
+		}
+	}
+
+	// A table without rows still names its columns
+	if len(rows) == 0 {
+		return strings.Join(headers, "; ")
+	}
+	return strings.Join(rows, "\n")
+}
+
+// cellTexts returns the plain text of the cells in a table row.
+func cellTexts(row ast.Node, source []byte) []string {
+	var cells []string
+	for cell := row.FirstChild(); cell != nil; cell = cell.NextSibling() {
+		var b strings.Builder
+		ast.Walk(cell, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+			if !entering {
+				return ast.WalkContinue, nil
+			}
+			switch n := n.(type) {
+			case *ast.Text:
+				b.Write(n.Segment.Value(source))
+				if n.SoftLineBreak() {
+					b.WriteByte(' ')
+				}
+			case *ast.String:
+				b.Write(n.Value)
+			case *ast.AutoLink:
+				b.Write(n.Label(source))
+			}
+			return ast.WalkContinue, nil
+		})
+		cells = append(cells, strings.TrimSpace(b.String()))
+	}
+	return cells
+}
@@ -0,0 +1,80 @@
+package chunker
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// ContextTemplate puts the document title and the section's heading path
+// ahead of the chunk, so that a section such as "## Configuration" is
+// embedded along with the document it configures. The same section in two
+// documents is then embedded twice, as the texts differ.
+const ContextTemplate = "{{.Title}}{{with .Aliases}} ({{.}}){{end}}\n{{with .HeadingPath}}{{.}}\n{{end}}\n{{.Content}}"
+
+// Document describes the document a chunk belongs to.
+type Document struct {
+	Title   string
+	Path    string   // file path relative to the indexed directory
+	Aliases []string // other names of the document, from Obsidian front matter
+}
+
+// TemplateData is what an embedding template can refer to.
+type TemplateData struct {
+	Title       string // document title
+	Aliases     string // other names of the document, comma-separated
+	Path        string // file path relative to the indexed directory
+	HeadingPath string
+	Content     string
+	Kind        string // KindText or KindCode
+	Lang        string // languages of the chunk's fenced code blocks, space-separated
+}
+
+// ParseTemplate parses an embedding template, a text/template over
+// TemplateData. Unknown fields are reported here rather than while indexing.
+func ParseTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("embed").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid embedding template: %w", err)
+	}
+	if err := tmpl.Execute(&strings.Builder{}, TemplateData{}); err != nil {
+		return nil, fmt.Errorf("invalid embedding template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// EmbedText returns the text to embed for a chunk of a document. Tables in
+// the content are written out row by row and wikilinks as the text they
+// display; without a template the content is all there is.
+func (c *Chunker) EmbedText(doc Document, chunk Chunk) (string, error) {
+	content := c.renderTables(c.renderWikiLinks(chunk.Content))
+	if c.opts.Template == "" {
+		return content, nil
+	}
+	if c.tmplErr != nil {
+		return "", c.tmplErr
+	}
+
+	var b strings.Builder
+	data := TemplateData{
+		Title:       doc.Title,
+		Aliases:     strings.Join(doc.Aliases, ", "),
+		Path:        doc.Path,
+		HeadingPath: chunk.HeadingPath,
+		Content:     content,
+		Kind:        chunk.Kind,
+		Lang:        chunk.Lang,
+	}
+	if err := c.tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("failed to apply embedding template: %w", err)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// templateID identifies a template in Options.String without spelling it out.
+func templateID(text string) string {
+	hash := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(hash[:])[:12]
+}
@@ -1,8 +1,11 @@
 package embedder
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"math"
 	"os"
 	"path/filepath"
@@ -28,33 +31,102 @@ type Embedder struct {
 	modelPath string
 	vocab     map[string]int64
 	session   *ort.DynamicAdvancedSession
+
+	modelIDOnce sync.Once
+	modelID     string
 }
 
-// New creates a new Embedder.
-func New(modelPath, onnxLibPath string) (*Embedder, error) {
+// Model input and output names.
+var (
+	inputNames  = []string{"input_ids", "attention_mask", "token_type_ids"}
+	outputNames = []string{"last_hidden_state"}
+)
+
+// LoadRuntime loads the ONNX Runtime shared library and initializes its
+// environment. Only the first call has an effect.
+func LoadRuntime(onnxLibPath string) error {
 	ortOnce.Do(func() {
 		ort.SetSharedLibraryPath(onnxLibPath)
 		ortInitErr = ort.InitializeEnvironment()
 	})
 
 	if ortInitErr != nil {
-		return nil, fmt.Errorf("failed to init onnx environment: %w", ortInitErr)
+		return fmt.Errorf("failed to init onnx environment: %w", ortInitErr)
+	}
+	return nil
+}
+
+// TokenizerPath returns the location of the tokenizer for a model.
+func TokenizerPath(modelPath string) string {
+	return filepath.Join(filepath.Dir(modelPath), "tokenizer.json")
+}
+
+// CheckTokenizer verifies that the model's tokenizer.json parses and returns its vocabulary size.
+func CheckTokenizer(modelPath string) (int, error) {
+	vocab, err := loadVocab(TokenizerPath(modelPath))
+	if err != nil {
+		return 0, err
+	}
+	return len(vocab), nil
+}
+
+// CheckModel verifies that the model has the inputs and outputs the embedder
+// uses, and that its output has EmbeddingDim dimensions. LoadRuntime must have
+// succeeded first.
+func CheckModel(modelPath string) error {
+	inputs, outputs, err := ort.GetInputOutputInfo(modelPath)
+	if err != nil {
+		return err
+	}
+
+	if err := checkNames("input", inputs, inputNames); err != nil {
+		return err
+	}
+	if err := checkNames("output", outputs, outputNames); err != nil {
+		return err
+	}
+
+	for _, o := range outputs {
+		if o.Name != outputNames[0] {
+			continue
+		}
+		dims := o.Dimensions
+		if len(dims) != 3 || dims[2] != EmbeddingDim {
+			return fmt.Errorf("output %q has shape %v, expected [batch, sequence, %d]", o.Name, dims, EmbeddingDim)
+		}
+	}
+	return nil
+}
+
+func checkNames(kind string, infos []ort.InputOutputInfo, want []string) error {
+	have := make(map[string]bool, len(infos))
+	names := make([]string, len(infos))
+	for i, info := range infos {
+		have[info.Name] = true
+		names[i] = info.Name
+	}
+	for _, name := range want {
+		if !have[name] {
+			return fmt.Errorf("model has no %s %q (found: %s)", kind, name, strings.Join(names, ", "))
+		}
+	}
+	return nil
+}
+
+// New creates a new Embedder.
+func New(modelPath, onnxLibPath string) (*Embedder, error) {
+	if err := LoadRuntime(onnxLibPath); err != nil {
+		return nil, err
 	}
 
 	// Load tokenizer vocabulary
-	tokenizerPath := filepath.Join(filepath.Dir(modelPath), "tokenizer.json")
-	vocab, err := loadVocab(tokenizerPath)
+	vocab, err := loadVocab(TokenizerPath(modelPath))
 	if err != nil {
 		return nil, fmt.Errorf("failed to load tokenizer: %w", err)
 	}
 
 	// Create persistent dynamic session
-	session, err := ort.NewDynamicAdvancedSession(
-		modelPath,
-		[]string{"input_ids", "attention_mask", "token_type_ids"},
-		[]string{"last_hidden_state"},
-		nil,
-	)
+	session, err := ort.NewDynamicAdvancedSession(modelPath, inputNames, outputNames, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create session: %w", err)
 	}
@@ -74,6 +146,61 @@ func (e *Embedder) Close() error {
 	return nil
 }
 
+// ModelID identifies the embedding model by file name and a prefix of its
+// SHA-256 hash, e.g. "embed.onnx@3f2a9c01b7d4". The hash is computed on first use.
+func (e *Embedder) ModelID() string {
+	e.modelIDOnce.Do(func() {
+		e.modelID = filepath.Base(e.modelPath)
+
+		f, err := os.Open(e.modelPath)
+		if err != nil {
+			return
+		}
+		defer f.Close()
+
+		h := sha256.New()
+		if _, err := io.Copy(h, f); err != nil {
+			return
+		}
+		e.modelID += "@" + hex.EncodeToString(h.Sum(nil))[:12]
+	})
+	return e.modelID
+}
+
+// CountTokens returns the number of tokens text occupies in the model input,
+// including the [CLS] and [SEP] tokens, before truncation to MaxSeqLen.
+func (e *Embedder) CountTokens(text string) int {
+	return countTokens(e.vocab, text)
+}
+
+// Tokenizer counts tokens like an Embedder without loading the model, for
+// estimates that should match what indexing produces.
+type Tokenizer struct {
+	vocab map[string]int64
+}
+
+// NewTokenizer loads the tokenizer of the model at modelPath.
+func NewTokenizer(modelPath string) (*Tokenizer, error) {
+	vocab, err := loadVocab(TokenizerPath(modelPath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tokenizer: %w", err)
+	}
+	return &Tokenizer{vocab: vocab}, nil
+}
+
+// CountTokens is Embedder.CountTokens.
+func (t *Tokenizer) CountTokens(text string) int {
+	return countTokens(t.vocab, text)
+}
+
+func countTokens(vocab map[string]int64, text string) int {
+	count := 2
+	for _, word := range tokenizeText(strings.ToLower(text)) {
+		count += len(wordPieceTokenize(vocab, word))
+	}
+	return count
+}
+
 // loadVocab loads the vocabulary from tokenizer.json
 func loadVocab(path string) (map[string]int64, error) {
 	data, err := os.ReadFile(path)
@@ -215,7 +342,7 @@ func (e *Embedder) tokenize(texts []string) ([]int64, []int64) {
 			}
 
 			// WordPiece tokenization for this word
-			subTokens := e.wordPieceTokenize(word)
+			subTokens := wordPieceTokenize(e.vocab, word)
 			for _, tokenID := range subTokens {
 				if pos >= MaxSeqLen-1 {
 					break
@@ -282,14 +409,14 @@ func isCJK(r rune) bool {
 }
 
 // wordPieceTokenize applies WordPiece algorithm to a single word.
-func (e *Embedder) wordPieceTokenize(word string) []int64 {
+func wordPieceTokenize(vocab map[string]int64, word string) []int64 {
 	const (
 		unkToken   = 100
 		maxWordLen = 100 // Limit word length to prevent DoS (O(N^2) complexity)
 	)
 
 	// Check if whole word is in vocab
-	if id, ok := e.vocab[word]; ok {
+	if id, ok := vocab[word]; ok {
 		return []int64{id}
 	}
 
@@ -312,7 +439,7 @@ func (e *Embedder) wordPieceTokenize(word string) []int64 {
 				substr = "##" + substr
 			}
 
-			if id, ok := e.vocab[substr]; ok {
+			if id, ok := vocab[substr]; ok {
 				tokens = append(tokens, id)
 				found = true
 				start = end
@@ -4,6 +4,7 @@ import (
 	"math"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -278,6 +279,78 @@ func TestTokenize_CaseInsensitivity(t *testing.T) {
 	}
 }
 
+func TestCountTokens(t *testing.T) {
+	e := &Embedder{vocab: map[string]int64{"hello": 1, "world": 2, "##s": 3}}
+
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 2},
+		{"hello", 3},
+		{"Hello worlds", 5},
+		{"hello, world!", 6},
+	}
+
+	for _, tt := range tests {
+		if got := e.CountTokens(tt.text); got != tt.want {
+			t.Errorf("CountTokens(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+
+	// Counts are not capped at the model window
+	long := strings.Repeat("hello ", MaxSeqLen*2)
+	if got := e.CountTokens(long); got != MaxSeqLen*2+2 {
+		t.Errorf("CountTokens(long) = %d, want %d", got, MaxSeqLen*2+2)
+	}
+}
+
+func TestNewTokenizer(t *testing.T) {
+	dir := t.TempDir()
+	modelPath := filepath.Join(dir, "embed.onnx")
+	if _, err := NewTokenizer(modelPath); err == nil {
+		t.Error("expected error without tokenizer.json")
+	}
+
+	vocab := `{"model": {"vocab": {"hello": 1, "world": 2, "##s": 3}}}`
+	if err := os.WriteFile(TokenizerPath(modelPath), []byte(vocab), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tok, err := NewTokenizer(modelPath)
+	if err != nil {
+		t.Fatalf("NewTokenizer failed: %v", err)
+	}
+
+	// Counts match the embedder's
+	e := &Embedder{vocab: tok.vocab}
+	for _, text := range []string{"", "Hello worlds", "hello, unknown world!"} {
+		if got, want := tok.CountTokens(text), e.CountTokens(text); got != want {
+			t.Errorf("CountTokens(%q) = %d, want %d", text, got, want)
+		}
+	}
+}
+
+func TestModelID(t *testing.T) {
+	modelPath := filepath.Join(t.TempDir(), "embed.onnx")
+	if err := os.WriteFile(modelPath, []byte("model bytes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	e := &Embedder{modelPath: modelPath}
+	id := e.ModelID()
+	if !strings.HasPrefix(id, "embed.onnx@") || len(id) != len("embed.onnx@")+12 {
+		t.Errorf("unexpected model ID %q", id)
+	}
+	if e.ModelID() != id {
+		t.Error("ModelID should be stable")
+	}
+
+	missing := &Embedder{modelPath: filepath.Join(t.TempDir(), "missing.onnx")}
+	if got := missing.ModelID(); got != "missing.onnx" {
+		t.Errorf("ModelID for unreadable model = %q, want file name", got)
+	}
+}
+
 func TestConstants(t *testing.T) {
 	if EmbeddingDim != 384 {
 		t.Errorf("EmbeddingDim should be 384, got %d", EmbeddingDim)
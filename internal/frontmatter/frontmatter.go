@@ -0,0 +1,185 @@
+package frontmatter
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Metadata holds the keys of a document's front matter.
+type Metadata map[string]any
+
+// Title returns the title key if it is a non-empty string.
+func (m Metadata) Title() string {
+	title, _ := m["title"].(string)
+	return strings.TrimSpace(title)
+}
+
+// Aliases returns the other names of a document in Obsidian, from the
+// aliases key or the older alias key, either a list or a single string.
+func (m Metadata) Aliases() []string {
+	value, ok := m["aliases"]
+	if !ok {
+		value = m["alias"]
+	}
+	var aliases []string
+	switch v := value.(type) {
+	case string:
+		aliases = append(aliases, v)
+	case []any:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				aliases = append(aliases, s)
+			}
+		}
+	}
+
+	kept := aliases[:0]
+	for _, alias := range aliases {
+		if alias = strings.TrimSpace(alias); alias != "" {
+			kept = append(kept, alias)
+		}
+	}
+	return kept
+}
+
+// String formats the metadata as "key: value" pairs sorted by key, with
+// lists joined by commas, e.g. "owner: alice; tags: go, duckdb".
+func (m Metadata) String() string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + ": " + formatValue(m[k])
+	}
+	return strings.Join(parts, "; ")
+}
+
+func formatValue(v any) string {
+	switch v := v.(type) {
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = formatValue(item)
+		}
+		return strings.Join(items, ", ")
+	case map[string]any:
+		return "{" + Metadata(v).String() + "}"
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Parse splits source into its front matter and body. YAML front matter is
+// delimited by "---" lines and TOML front matter by "+++" lines, starting on
+// the first line. In the returned body the front matter is replaced by blank
+// lines, so line numbers match source. Metadata is nil if there is no front
+// matter. If the front matter does not parse, the error is returned together
+// with source as the body, since a document may also open with a "---"
+// thematic break.
+func Parse(source []byte) (Metadata, []byte, error) {
+	firstLine, rest, _ := bytes.Cut(source, []byte("\n"))
+	delim := string(bytes.TrimSuffix(bytes.TrimPrefix(firstLine, []byte("\uFEFF")), []byte("\r")))
+	if delim != "---" && delim != "+++" {
+		return nil, source, nil
+	}
+
+	// Find the closing delimiter; without one the document has no front matter
+	offset := len(firstLine) + 1
+	for len(rest) > 0 {
+		line, next, _ := bytes.Cut(rest, []byte("\n"))
+		trimmed := string(bytes.TrimRight(line, " \t\r"))
+		if trimmed == delim || (delim == "---" && trimmed == "...") {
+			raw := source[len(firstLine)+1 : offset]
+			meta, err := decode(delim, raw)
+			if err != nil {
+				return nil, source, err
+			}
+
+			end := offset + len(line)
+			lines := bytes.Count(source[:end], []byte("\n"))
+			body := append(bytes.Repeat([]byte("\n"), lines), source[end:]...)
+			return meta, body, nil
+		}
+		offset += len(line) + 1
+		rest = next
+	}
+
+	return nil, source, nil
+}
+
+func decode(delim string, raw []byte) (Metadata, error) {
+	var meta Metadata
+	if delim == "+++" {
+		if err := toml.Unmarshal(raw, &meta); err != nil {
+			return nil, fmt.Errorf("invalid TOML front matter: %w", err)
+		}
+	} else {
+		var node any
+		if err := yaml.Unmarshal(raw, &node); err != nil {
+			return nil, fmt.Errorf("invalid YAML front matter: %w", err)
+		}
+		if node == nil {
+			return nil, nil
+		}
+		m, ok := node.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("invalid YAML front matter: expected key/value pairs")
+		}
+		meta = m
+	}
+
+	if len(meta) == 0 {
+		return nil, nil
+	}
+	for k, v := range meta {
+		meta[k] = normalize(v)
+	}
+	return meta, nil
+}
+
+// normalize converts dates to strings, so that metadata reads the same after
+// a round trip through JSON.
+func normalize(v any) any {
+	switch v := v.(type) {
+	case time.Time:
+		if v.Hour() == 0 && v.Minute() == 0 && v.Second() == 0 && v.Nanosecond() == 0 {
+			return v.Format("2006-01-02")
+		}
+		return v.Format(time.RFC3339)
+	case []any:
+		for i := range v {
+			v[i] = normalize(v[i])
+		}
+	case map[string]any:
+		for k := range v {
+			v[k] = normalize(v[k])
+		}
+	case []map[string]any:
+		// TOML arrays of tables
+		items := make([]any, len(v))
+		for i, item := range v {
+			items[i] = normalize(item)
+		}
+		return items
+	case map[any]any:
+		// YAML mappings with non-string keys
+		m := make(map[string]any, len(v))
+		for k, item := range v {
+			m[fmt.Sprint(k)] = normalize(item)
+		}
+		return m
+	}
+	return v
+}
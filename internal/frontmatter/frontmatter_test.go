@@ -0,0 +1,179 @@
+package frontmatter
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParse_YAML(t *testing.T) {
+	source := "---\ntitle: Deploy Guide\ntags: [ops, k8s]\nowner: alice\nupdated: 2024-03-01\n---\n# Deploy\n\nSteps.\n"
+
+	meta, body, err := Parse([]byte(source))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if meta.Title() != "Deploy Guide" {
+		t.Errorf("unexpected title: %q", meta.Title())
+	}
+	if meta["owner"] != "alice" || meta["updated"] != "2024-03-01" {
+		t.Errorf("unexpected metadata: %v", meta)
+	}
+	if tags, ok := meta["tags"].([]any); !ok || len(tags) != 2 || tags[0] != "ops" {
+		t.Errorf("unexpected tags: %v", meta["tags"])
+	}
+
+	// The front matter is blanked, keeping line numbers
+	if want := "\n\n\n\n\n\n# Deploy\n\nSteps.\n"; string(body) != want {
+		t.Errorf("unexpected body: %q", body)
+	}
+}
+
+func TestParse_TOML(t *testing.T) {
+	source := "+++\ntitle = \"Runbook\" # comment\ndraft = false\nweight = 1_000\ntags = ['a', \"b\"]\ndate = 2024-03-01\n\n[params]\nteam = \"sre\"\n+++\nBody\n"
+
+	meta, body, err := Parse([]byte(source))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if meta.Title() != "Runbook" || meta["draft"] != false || meta["weight"] != int64(1000) || meta["date"] != "2024-03-01" {
+		t.Errorf("unexpected metadata: %v", meta)
+	}
+	if tags, ok := meta["tags"].([]any); !ok || len(tags) != 2 || tags[1] != "b" {
+		t.Errorf("unexpected tags: %v", meta["tags"])
+	}
+	if params, ok := meta["params"].(map[string]any); !ok || params["team"] != "sre" {
+		t.Errorf("unexpected table: %v", meta["params"])
+	}
+	if !strings.HasSuffix(string(body), "\nBody\n") || strings.Count(string(body), "\n") != strings.Count(source, "\n") {
+		t.Errorf("unexpected body: %q", body)
+	}
+}
+
+func TestParse_TOMLSyntax(t *testing.T) {
+	source := "+++\n" +
+		"summary = \"\"\"\nFirst line, with a comma]\nSecond # not a comment\"\"\"\n" +
+		"author = { name = \"alice\", team = \"sre\" }\n" +
+		"links = [\n  \"https://example.com/#intro\", # a comment\n  \"b\",\n]\n" +
+		"[[menu]]\nname = \"docs\"\n" +
+		"+++\nBody\n"
+
+	meta, _, err := Parse([]byte(source))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if got := meta["summary"]; got != "First line, with a comma]\nSecond # not a comment" {
+		t.Errorf("unexpected multi-line string: %q", got)
+	}
+	if author, ok := meta["author"].(map[string]any); !ok || author["team"] != "sre" {
+		t.Errorf("unexpected inline table: %v", meta["author"])
+	}
+	if links, ok := meta["links"].([]any); !ok || len(links) != 2 || links[0] != "https://example.com/#intro" {
+		t.Errorf("unexpected array: %v", meta["links"])
+	}
+	if menu, ok := meta["menu"].([]any); !ok || len(menu) != 1 || menu[0].(map[string]any)["name"] != "docs" {
+		t.Errorf("unexpected array of tables: %#v", meta["menu"])
+	}
+}
+
+func TestParse_NoFrontMatter(t *testing.T) {
+	tests := []string{
+		"# Title\n\nText.\n",
+		"",
+		"Intro\n---\nSetext heading above\n",
+		"---\ntitle: never closed\n",
+		" ---\ntitle: indented\n---\n",
+	}
+
+	for _, source := range tests {
+		meta, body, err := Parse([]byte(source))
+		if err != nil {
+			t.Errorf("Parse(%q) returned error: %v", source, err)
+		}
+		if meta != nil {
+			t.Errorf("Parse(%q) should find no metadata, got %v", source, meta)
+		}
+		if string(body) != source {
+			t.Errorf("Parse(%q) should return the source unchanged, got %q", source, body)
+		}
+	}
+}
+
+func TestParse_EmptyFrontMatter(t *testing.T) {
+	meta, body, err := Parse([]byte("---\n---\n# Title\n"))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if meta != nil {
+		t.Errorf("expected no metadata, got %v", meta)
+	}
+	if string(body) != "\n\n# Title\n" {
+		t.Errorf("unexpected body: %q", body)
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := []string{
+		"---\ntitle: [unclosed\n---\n",
+		"---\n- a list\n- not a mapping\n---\n",
+		"+++\ntitle \"missing equals\"\n+++\n",
+		"+++\ntitle = \"a\"\ntitle = \"b\"\n+++\n",
+		"+++\ntags = [\"a\", \"b\"\n+++\n",
+	}
+
+	for _, source := range tests {
+		meta, body, err := Parse([]byte(source))
+		if err == nil {
+			t.Errorf("Parse(%q) should fail", source)
+		}
+		if meta != nil || string(body) != source {
+			t.Errorf("Parse(%q) should return the source as body, got %v, %q", source, meta, body)
+		}
+	}
+}
+
+func TestMetadata_String(t *testing.T) {
+	meta := Metadata{"tags": []any{"go", "duckdb"}, "owner": "alice", "weight": int64(3)}
+	if got, want := meta.String(), "owner: alice; tags: go, duckdb; weight: 3"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestMetadata_Aliases(t *testing.T) {
+	tests := []struct {
+		meta Metadata
+		want string
+	}{
+		{Metadata{"aliases": []any{"Shipping", " ", "Release process", 3}}, "Shipping|Release process"},
+		{Metadata{"aliases": "Shipping"}, "Shipping"},
+		{Metadata{"alias": []any{"Old name"}}, "Old name"},
+		{Metadata{"title": "Deploy"}, ""},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(tt.meta.Aliases(), "|"); got != tt.want {
+			t.Errorf("Aliases() of %v = %q, want %q", tt.meta, got, tt.want)
+		}
+	}
+}
+
+func TestMetadata_JSONRoundTrip(t *testing.T) {
+	meta, _, err := Parse([]byte("---\nupdated: 2024-03-01T10:30:00Z\nnested:\n  1: one\n---\n"))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	data, err := json.Marshal(meta)
+	if err != nil {
+		t.Fatalf("metadata should be JSON-encodable: %v", err)
+	}
+	var decoded Metadata
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded["updated"] != "2024-03-01T10:30:00Z" {
+		t.Errorf("unexpected date after round trip: %v", decoded["updated"])
+	}
+}
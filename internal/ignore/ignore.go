@@ -0,0 +1,301 @@
+package ignore
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// DefaultFiles are the per-directory ignore files read while walking, lowest
+// precedence first.
+var DefaultFiles = []string{".gitignore", ".mcpmydocsignore"}
+
+// Pattern is a single compiled gitignore-style pattern.
+type Pattern struct {
+	Text    string // pattern as written
+	Source  string // where the pattern came from, e.g. "docs/.gitignore:3"
+	Negate  bool   // pattern starts with "!" and re-includes matches
+	base    string // slash-separated directory the pattern is relative to ("" for root)
+	dirOnly bool
+	re      *regexp.Regexp
+}
+
+// String describes the pattern and its origin for log output.
+func (p *Pattern) String() string {
+	return fmt.Sprintf("%s: %s", p.Source, p.Text)
+}
+
+// ParsePattern compiles one line of an ignore file relative to the base
+// directory. It returns nil for blank lines and comments.
+func ParsePattern(line, base, source string) (*Pattern, error) {
+	line = strings.TrimSuffix(line, "\r")
+	text := line
+
+	// Trailing spaces are ignored unless escaped
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil, nil
+	}
+
+	p := &Pattern{Text: strings.TrimSpace(text), Source: source, base: base}
+
+	if strings.HasPrefix(line, "!") {
+		p.Negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+
+	// A slash anywhere but the end anchors the pattern to its base directory
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	if line == "" {
+		return nil, nil
+	}
+
+	expr := globToRegexp(line)
+	if anchored {
+		expr = "^" + expr + "$"
+	} else {
+		expr = "^(?:.*/)?" + expr + "$"
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q (%s): %w", p.Text, source, err)
+	}
+	p.re = re
+	return p, nil
+}
+
+// Match reports whether the pattern matches relPath, a slash-separated path
+// relative to the walk root.
+func (p *Pattern) Match(relPath string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	if p.base != "" {
+		if !strings.HasPrefix(relPath, p.base+"/") {
+			return false
+		}
+		relPath = relPath[len(p.base)+1:]
+	}
+	return p.re.MatchString(relPath)
+}
+
+// globToRegexp converts gitignore glob syntax to a regular expression body.
+func globToRegexp(glob string) string {
+	var buf strings.Builder
+
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case c == '*' && strings.HasPrefix(glob[i:], "**") && (i == 0 || glob[i-1] == '/'):
+			rest := glob[i+2:]
+			switch {
+			case rest == "":
+				// Trailing "/**" matches everything inside
+				buf.WriteString(".*")
+				i++
+			case rest[0] == '/':
+				// Leading "**/" or inner "/**/" matches zero or more directories
+				buf.WriteString("(?:.*/)?")
+				i += 2
+			default:
+				buf.WriteString("[^/]*")
+				i++
+			}
+		case c == '*':
+			buf.WriteString("[^/]*")
+		case c == '?':
+			buf.WriteString("[^/]")
+		case c == '[':
+			class, n := bracketClass(glob[i:])
+			if n == 0 {
+				buf.WriteString(regexp.QuoteMeta("["))
+				continue
+			}
+			buf.WriteString(class)
+			i += n - 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			buf.WriteString(regexp.QuoteMeta(string(glob[i])))
+		default:
+			buf.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	return buf.String()
+}
+
+// bracketClass converts a "[...]" expression at the start of s, returning the
+// regexp class and the number of bytes consumed (0 if the bracket is unclosed).
+func bracketClass(s string) (string, int) {
+	i := 1
+	var buf strings.Builder
+	buf.WriteByte('[')
+
+	if i < len(s) && (s[i] == '!' || s[i] == '^') {
+		buf.WriteByte('^')
+		i++
+	}
+	// A leading "]" is a literal member of the class
+	if i < len(s) && s[i] == ']' {
+		buf.WriteString(`\]`)
+		i++
+	}
+
+	for ; i < len(s); i++ {
+		switch c := s[i]; c {
+		case ']':
+			buf.WriteByte(']')
+			return buf.String(), i + 1
+		case '-':
+			buf.WriteByte('-')
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				buf.WriteString(regexp.QuoteMeta(string(s[i])))
+			}
+		default:
+			buf.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	return "", 0
+}
+
+// Options configures a Matcher.
+type Options struct {
+	IgnoreFiles []string // per-directory ignore file names, lowest precedence first
+	Include     []string // if set, only files matching one of these are kept
+	Exclude     []string // ignore patterns applied after all ignore files
+}
+
+// Matcher decides which paths under a root directory are skipped, combining
+// ignore files discovered during a walk with include and exclude patterns.
+type Matcher struct {
+	ignoreFiles []string
+	patterns    []*Pattern // from ignore files, in precedence order (later wins)
+	exclude     []*Pattern
+	include     []*Pattern
+	loaded      map[string]bool
+}
+
+// New creates a Matcher, compiling the include and exclude patterns.
+func New(opts Options) (*Matcher, error) {
+	m := &Matcher{
+		ignoreFiles: opts.IgnoreFiles,
+		loaded:      make(map[string]bool),
+	}
+
+	for _, e := range opts.Exclude {
+		p, err := ParsePattern(e, "", "exclude")
+		if err != nil {
+			return nil, err
+		}
+		if p != nil {
+			m.exclude = append(m.exclude, p)
+		}
+	}
+
+	for _, inc := range opts.Include {
+		p, err := ParsePattern(inc, "", "include")
+		if err != nil {
+			return nil, err
+		}
+		if p != nil {
+			m.include = append(m.include, p)
+		}
+	}
+
+	return m, nil
+}
+
+// LoadDir reads the ignore files in absDir, whose slash-separated path
+// relative to the walk root is relDir ("" or "." for the root). Directories
+// are only loaded once; missing ignore files are not an error.
+func (m *Matcher) LoadDir(absDir, relDir string) error {
+	if relDir == "." {
+		relDir = ""
+	}
+	if m.loaded[relDir] {
+		return nil
+	}
+	m.loaded[relDir] = true
+
+	for _, name := range m.ignoreFiles {
+		patterns, err := readIgnoreFile(filepath.Join(absDir, name), relDir, path.Join(relDir, name))
+		if err != nil {
+			return err
+		}
+		m.patterns = append(m.patterns, patterns...)
+	}
+	return nil
+}
+
+func readIgnoreFile(filePath, base, source string) ([]*Pattern, error) {
+	f, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var patterns []*Pattern
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		p, err := ParsePattern(scanner.Text(), base, fmt.Sprintf("%s:%d", source, lineNo))
+		if err != nil {
+			return nil, err
+		}
+		if p != nil {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns, scanner.Err()
+}
+
+// Match reports whether relPath, a slash-separated path relative to the walk
+// root, should be skipped, along with the reason for log output.
+func (m *Matcher) Match(relPath string, isDir bool) (bool, string) {
+	if isDir && path.Base(relPath) == ".git" {
+		return true, "git metadata directory"
+	}
+
+	var decided *Pattern
+	for _, p := range m.patterns {
+		if p.Match(relPath, isDir) {
+			decided = p
+		}
+	}
+	for _, p := range m.exclude {
+		if p.Match(relPath, isDir) {
+			decided = p
+		}
+	}
+	if decided != nil && !decided.Negate {
+		return true, decided.String()
+	}
+
+	if !isDir && len(m.include) > 0 {
+		for _, p := range m.include {
+			if p.Match(relPath, false) {
+				return false, ""
+			}
+		}
+		return true, "not matched by any include pattern"
+	}
+
+	return false, ""
+}
@@ -0,0 +1,189 @@
+package ignore
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParsePattern_Skipped(t *testing.T) {
+	for _, line := range []string{"", "   ", "# comment", "/", "!"} {
+		p, err := ParsePattern(line, "", "test")
+		if err != nil {
+			t.Errorf("ParsePattern(%q) returned error: %v", line, err)
+		}
+		if p != nil {
+			t.Errorf("ParsePattern(%q) should return nil", line)
+		}
+	}
+}
+
+func TestPattern_Match(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		base    string
+		path    string
+		isDir   bool
+		want    bool
+	}{
+		{"basename at root", "CHANGELOG.md", "", "CHANGELOG.md", false, true},
+		{"basename at depth", "CHANGELOG.md", "", "pkg/a/CHANGELOG.md", false, true},
+		{"basename no partial", "CHANGELOG.md", "", "OLD-CHANGELOG.md", false, false},
+		{"star", "*.gen.md", "", "api/types.gen.md", false, true},
+		{"star does not cross slash", "docs*.md", "", "docs/a.md", false, false},
+		{"question mark", "v?.md", "", "v1.md", false, true},
+		{"bracket class", "v[0-9].md", "", "v7.md", false, true},
+		{"negated bracket class", "v[!0-9].md", "", "v7.md", false, false},
+		{"dir only matches dir", "build/", "", "build", true, true},
+		{"dir only skips file", "build/", "", "build", false, false},
+		{"dir only at depth", "node_modules/", "", "web/node_modules", true, true},
+		{"leading slash anchors", "/vendor", "", "vendor", true, true},
+		{"leading slash anchored miss", "/vendor", "", "src/vendor", true, false},
+		{"middle slash anchors", "docs/internal", "", "docs/internal", true, true},
+		{"middle slash anchored miss", "docs/internal", "", "x/docs/internal", true, false},
+		{"leading double star", "**/generated", "", "a/b/generated", true, true},
+		{"leading double star at root", "**/generated", "", "generated", true, true},
+		{"trailing double star", "drafts/**", "", "drafts/a/b.md", false, true},
+		{"inner double star", "a/**/b.md", "", "a/x/y/b.md", false, true},
+		{"inner double star zero dirs", "a/**/b.md", "", "a/b.md", false, true},
+		{"base directory", "*.md", "sub", "sub/a.md", false, true},
+		{"base directory miss", "*.md", "sub", "other/a.md", false, false},
+		{"base anchored", "/a.md", "sub", "sub/a.md", false, true},
+		{"base anchored nested miss", "/a.md", "sub", "sub/x/a.md", false, false},
+		{"escaped hash", `\#notes.md`, "", "#notes.md", false, true},
+		{"escaped bang", `\!important.md`, "", "!important.md", false, true},
+		{"dot is literal", "a.md", "", "abmd", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParsePattern(tt.pattern, tt.base, "test")
+			if err != nil {
+				t.Fatalf("ParsePattern failed: %v", err)
+			}
+			if p == nil {
+				t.Fatal("ParsePattern returned nil")
+			}
+			if got := p.Match(tt.path, tt.isDir); got != tt.want {
+				t.Errorf("%q.Match(%q, %v) = %v, want %v", tt.pattern, tt.path, tt.isDir, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePattern_Negate(t *testing.T) {
+	p, err := ParsePattern("!keep.md", "", "test")
+	if err != nil {
+		t.Fatalf("ParsePattern failed: %v", err)
+	}
+	if !p.Negate {
+		t.Error("expected Negate to be set")
+	}
+	if !p.Match("keep.md", false) {
+		t.Error("negated pattern should still match its path")
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMatcher(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, ".gitignore"), "node_modules/\n*.gen.md\n")
+	writeFile(t, filepath.Join(root, ".mcpmydocsignore"), "CHANGELOG.md\n")
+	writeFile(t, filepath.Join(root, "api", ".gitignore"), "!keep.gen.md\n")
+
+	m, err := New(Options{IgnoreFiles: DefaultFiles, Exclude: []string{"drafts/"}})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if err := m.LoadDir(root, "."); err != nil {
+		t.Fatalf("LoadDir failed: %v", err)
+	}
+	if err := m.LoadDir(filepath.Join(root, "api"), "api"); err != nil {
+		t.Fatalf("LoadDir failed: %v", err)
+	}
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{".git", true, true},
+		{"node_modules", true, true},
+		{"web/node_modules", true, true},
+		{"types.gen.md", false, true},
+		{"api/types.gen.md", false, true},
+		{"api/keep.gen.md", false, false},
+		{"keep.gen.md", false, true},
+		{"CHANGELOG.md", false, true},
+		{"drafts", true, true},
+		{"guide.md", false, false},
+	}
+
+	for _, tt := range tests {
+		skip, reason := m.Match(tt.path, tt.isDir)
+		if skip != tt.want {
+			t.Errorf("Match(%q) = %v (%s), want %v", tt.path, skip, reason, tt.want)
+		}
+		if skip && reason == "" {
+			t.Errorf("Match(%q) should give a reason", tt.path)
+		}
+	}
+
+	_, reason := m.Match("api/types.gen.md", false)
+	if !strings.Contains(reason, ".gitignore:2") {
+		t.Errorf("reason should name the ignore file and line, got %q", reason)
+	}
+}
+
+func TestMatcher_Include(t *testing.T) {
+	m, err := New(Options{Include: []string{"guides/**", "README.md"}})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"guides/setup.md", false, false},
+		{"pkg/README.md", false, false},
+		{"notes.md", false, true},
+		// Directories are never skipped by include patterns
+		{"other", true, false},
+	}
+
+	for _, tt := range tests {
+		if skip, _ := m.Match(tt.path, tt.isDir); skip != tt.want {
+			t.Errorf("Match(%q) = %v, want %v", tt.path, skip, tt.want)
+		}
+	}
+}
+
+func TestMatcher_ExcludeOverridesIgnoreFiles(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, ".gitignore"), "!important.md\n")
+
+	m, err := New(Options{IgnoreFiles: DefaultFiles, Exclude: []string{"important.md"}})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if err := m.LoadDir(root, ""); err != nil {
+		t.Fatalf("LoadDir failed: %v", err)
+	}
+
+	if skip, _ := m.Match("important.md", false); !skip {
+		t.Error("exclude pattern should take precedence over ignore files")
+	}
+}
@@ -5,170 +5,216 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 )
 
-// ResolveONNXLibraryPath attempts to find the ONNX Runtime shared library.
-func ResolveONNXLibraryPath(userProvidedPath string) (string, error) {
+// DefaultDBName is the database file name used when no location is configured.
+const DefaultDBName = "mcpmydocs.db"
+
+// ResolveDBPath determines the database file location.
+// The database does not need to exist yet; index creates it on first run.
+func ResolveDBPath(userProvidedPath string) (string, error) {
 	// 1. CLI flag
-	if userProvidedPath != "" {
-		if _, err := os.Stat(userProvidedPath); err == nil {
-			return userProvidedPath, nil
+	path := userProvidedPath
+
+	// 2. Environment variable
+	if path == "" {
+		path = os.Getenv("MCPMYDOCS_DB")
+	}
+
+	// 3. CWD (default)
+	if path == "" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return "", fmt.Errorf("failed to get current working directory: %w", err)
 		}
-		return "", fmt.Errorf("specified ONNX library path not found: %s", userProvidedPath)
+		return filepath.Join(cwd, DefaultDBName), nil
 	}
 
-	// 2. Environment variable
-	if envPath := os.Getenv("ONNX_LIBRARY_PATH"); envPath != "" {
-		if _, err := os.Stat(envPath); err == nil {
-			return envPath, nil
+	path, err := expandHome(path)
+	if err != nil {
+		return "", err
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve database path %s: %w", path, err)
+	}
+	return absPath, nil
+}
+
+// expandHome replaces a leading "~" with the user's home directory.
+// Shells do not expand "~" in --flag=value form or in environment variables
+// set by MCP client configuration, so it is handled here.
+func expandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~"+string(filepath.Separator)) {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to expand %s: %w", path, err)
+	}
+	return filepath.Join(home, path[1:]), nil
+}
+
+// Candidate is one location checked while resolving a file.
+type Candidate struct {
+	Source string // where the candidate comes from, e.g. "ONNX_LIBRARY_PATH"
+	Path   string // empty if the source is not set
+}
+
+// Check returns nil if the candidate exists, or the reason it is rejected.
+func (c Candidate) Check() error {
+	if c.Path == "" {
+		return fmt.Errorf("not set")
+	}
+	_, err := os.Stat(c.Path)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("not found")
+	}
+	return err
+}
+
+// firstExisting returns the path of the first candidate that exists.
+func firstExisting(candidates []Candidate) (string, bool) {
+	for _, c := range candidates {
+		if c.Check() == nil {
+			return c.Path, true
 		}
 	}
+	return "", false
+}
 
-	// Determine library name based on OS
-	var libName string
+// onnxLibraryName returns the platform's ONNX Runtime shared library file name.
+func onnxLibraryName() (string, error) {
 	switch runtime.GOOS {
 	case "darwin":
-		libName = "libonnxruntime.dylib"
+		return "libonnxruntime.dylib", nil
 	case "linux":
-		libName = "libonnxruntime.so"
+		return "libonnxruntime.so", nil
 	case "windows":
-		libName = "onnxruntime.dll"
+		return "onnxruntime.dll", nil
 	default:
 		return "", fmt.Errorf("unsupported OS: %s", runtime.GOOS)
 	}
+}
 
-	// 3. Sidecar "lib" directory (relative to executable)
-	exePath, err := os.Executable()
-	if err == nil {
-		exeDir := filepath.Dir(exePath)
-		sidecarPath := filepath.Join(exeDir, "lib", libName)
-		if _, err := os.Stat(sidecarPath); err == nil {
-			return sidecarPath, nil
-		}
+// ONNXLibraryCandidates lists the locations ResolveONNXLibraryPath checks, in order.
+func ONNXLibraryCandidates(userProvidedPath string) ([]Candidate, error) {
+	// 1. CLI flag
+	candidates := []Candidate{{Source: "--onnx-lib flag", Path: userProvidedPath}}
+	if userProvidedPath != "" {
+		return candidates, nil
+	}
 
-		// Also check root of executable
-		rootPath := filepath.Join(exeDir, libName)
-		if _, err := os.Stat(rootPath); err == nil {
-			return rootPath, nil
-		}
+	// 2. Environment variable
+	candidates = append(candidates, Candidate{Source: "ONNX_LIBRARY_PATH", Path: os.Getenv("ONNX_LIBRARY_PATH")})
+
+	libName, err := onnxLibraryName()
+	if err != nil {
+		return candidates, err
+	}
+
+	// 3. Sidecar "lib" directory (relative to executable), then next to it
+	if exePath, err := os.Executable(); err == nil {
+		exeDir := filepath.Dir(exePath)
+		candidates = append(candidates,
+			Candidate{Source: "lib directory next to executable", Path: filepath.Join(exeDir, "lib", libName)},
+			Candidate{Source: "next to executable", Path: filepath.Join(exeDir, libName)},
+		)
 	}
 
 	// 4. System paths (Fallback)
-	systemPaths := []string{}
+	var systemDirs []string
 	switch runtime.GOOS {
 	case "darwin":
-		systemPaths = []string{
-			"/opt/homebrew/lib/" + libName,
-			"/usr/local/lib/" + libName,
-		}
+		systemDirs = []string{"/opt/homebrew/lib/", "/usr/local/lib/"}
 	case "linux":
-		systemPaths = []string{
-			"/usr/lib/" + libName,
-			"/usr/local/lib/" + libName,
-		}
+		systemDirs = []string{"/usr/lib/", "/usr/local/lib/"}
 	}
+	for _, dir := range systemDirs {
+		candidates = append(candidates, Candidate{Source: "system library directory", Path: dir + libName})
+	}
+
+	return candidates, nil
+}
 
-	for _, p := range systemPaths {
-		if _, err := os.Stat(p); err == nil {
-			return p, nil
+// ResolveONNXLibraryPath attempts to find the ONNX Runtime shared library.
+func ResolveONNXLibraryPath(userProvidedPath string) (string, error) {
+	// An explicit path must exist; there is no fallback
+	if userProvidedPath != "" {
+		if _, err := os.Stat(userProvidedPath); err == nil {
+			return userProvidedPath, nil
 		}
+		return "", fmt.Errorf("specified ONNX library path not found: %s", userProvidedPath)
+	}
+
+	candidates, err := ONNXLibraryCandidates("")
+	if err != nil {
+		return "", err
+	}
+	if path, ok := firstExisting(candidates); ok {
+		return path, nil
 	}
 
+	libName, _ := onnxLibraryName()
 	return "", fmt.Errorf("ONNX runtime library (%s) not found. Set ONNX_LIBRARY_PATH or place it in a 'lib' folder next to the executable", libName)
 }
 
-// ResolveModelPath attempts to find the embedding model file.
-func ResolveModelPath() (string, error) {
+// modelCandidates lists the locations checked for a model file, in order.
+func modelCandidates(envVar, fileName string) []Candidate {
 	// 1. Environment variable
-	if envPath := os.Getenv("MCPMYDOCS_MODEL_PATH"); envPath != "" {
-		if _, err := os.Stat(envPath); err == nil {
-			return envPath, nil
-		}
-	}
+	candidates := []Candidate{{Source: envVar, Path: os.Getenv(envVar)}}
 
 	// 2. User data directory (install script location)
 	if home, err := os.UserHomeDir(); err == nil {
-		path := filepath.Join(home, ".local", "share", "mcpmydocs", "models", "embed.onnx")
-		if _, err := os.Stat(path); err == nil {
-			return path, nil
-		}
+		candidates = append(candidates, Candidate{
+			Source: "user data directory",
+			Path:   filepath.Join(home, ".local", "share", "mcpmydocs", "models", fileName),
+		})
 	}
 
-	// 3. Executable relative (Deployment)
-	exe, err := os.Executable()
-	if err == nil {
+	// 3. Executable relative (Deployment), also for binaries in bin/
+	if exe, err := os.Executable(); err == nil {
 		exeDir := filepath.Dir(exe)
-
-		// Check "assets/models/embed.onnx" next to binary
-		path := filepath.Join(exeDir, "assets", "models", "embed.onnx")
-		if _, err := os.Stat(path); err == nil {
-			return path, nil
-		}
-
-		// Check "../assets/models/embed.onnx" (if binary is in bin/)
-		path = filepath.Join(exeDir, "..", "assets", "models", "embed.onnx")
-		if _, err := os.Stat(path); err == nil {
-			return path, nil
-		}
+		candidates = append(candidates,
+			Candidate{Source: "next to executable", Path: filepath.Join(exeDir, "assets", "models", fileName)},
+			Candidate{Source: "above executable", Path: filepath.Join(exeDir, "..", "assets", "models", fileName)},
+		)
 	}
 
 	// 4. CWD (Development fallback)
-	cwd, err := os.Getwd()
-	if err == nil {
-		path := filepath.Join(cwd, "assets", "models", "embed.onnx")
-		if _, err := os.Stat(path); err == nil {
-			return path, nil
-		}
+	if cwd, err := os.Getwd(); err == nil {
+		candidates = append(candidates, Candidate{
+			Source: "current directory",
+			Path:   filepath.Join(cwd, "assets", "models", fileName),
+		})
 	}
 
-	return "", fmt.Errorf("model file 'embed.onnx' not found. Set MCPMYDOCS_MODEL_PATH or run the install script")
+	return candidates
 }
 
-// ResolveRerankerModelPath attempts to find the reranker model file.
-// Returns empty string if not found (reranker is optional).
-func ResolveRerankerModelPath() string {
-	// 1. Environment variable
-	if envPath := os.Getenv("MCPMYDOCS_RERANKER_PATH"); envPath != "" {
-		if _, err := os.Stat(envPath); err == nil {
-			return envPath
-		}
-	}
-
-	// 2. User data directory (install script location)
-	if home, err := os.UserHomeDir(); err == nil {
-		path := filepath.Join(home, ".local", "share", "mcpmydocs", "models", "rerank.onnx")
-		if _, err := os.Stat(path); err == nil {
-			return path
-		}
-	}
-
-	// 3. Executable relative (Deployment)
-	exe, err := os.Executable()
-	if err == nil {
-		exeDir := filepath.Dir(exe)
-
-		// Check "assets/models/rerank.onnx" next to binary
-		path := filepath.Join(exeDir, "assets", "models", "rerank.onnx")
-		if _, err := os.Stat(path); err == nil {
-			return path
-		}
+// ModelCandidates lists the locations ResolveModelPath checks, in order.
+func ModelCandidates() []Candidate {
+	return modelCandidates("MCPMYDOCS_MODEL_PATH", "embed.onnx")
+}
 
-		// Check "../assets/models/rerank.onnx" (if binary is in bin/)
-		path = filepath.Join(exeDir, "..", "assets", "models", "rerank.onnx")
-		if _, err := os.Stat(path); err == nil {
-			return path
-		}
-	}
+// RerankerModelCandidates lists the locations ResolveRerankerModelPath checks, in order.
+func RerankerModelCandidates() []Candidate {
+	return modelCandidates("MCPMYDOCS_RERANKER_PATH", "rerank.onnx")
+}
 
-	// 4. CWD (Development fallback)
-	cwd, err := os.Getwd()
-	if err == nil {
-		path := filepath.Join(cwd, "assets", "models", "rerank.onnx")
-		if _, err := os.Stat(path); err == nil {
-			return path
-		}
+// ResolveModelPath attempts to find the embedding model file.
+func ResolveModelPath() (string, error) {
+	if path, ok := firstExisting(ModelCandidates()); ok {
+		return path, nil
 	}
+	return "", fmt.Errorf("model file 'embed.onnx' not found. Set MCPMYDOCS_MODEL_PATH or run the install script")
+}
 
-	// Reranker is optional - return empty string if not found
-	return ""
+// ResolveRerankerModelPath attempts to find the reranker model file.
+// Returns empty string if not found (reranker is optional).
+func ResolveRerankerModelPath() string {
+	path, _ := firstExisting(RerankerModelCandidates())
+	return path
 }
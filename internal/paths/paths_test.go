@@ -320,3 +320,159 @@ func TestResolveRerankerModelPath_NotFound(t *testing.T) {
 		t.Errorf("expected empty string when reranker not found, got %s", result)
 	}
 }
+
+func TestCandidate_Check(t *testing.T) {
+	tmpDir := t.TempDir()
+	file := filepath.Join(tmpDir, "embed.onnx")
+	if err := os.WriteFile(file, []byte("fake"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"existing file", file, ""},
+		{"unset", "", "not set"},
+		{"missing", filepath.Join(tmpDir, "missing.onnx"), "not found"},
+		// Any existing path is accepted, as by the lookups
+		{"directory", tmpDir, ""},
+	}
+
+	for _, tt := range tests {
+		err := Candidate{Source: "test", Path: tt.path}.Check()
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != tt.want {
+			t.Errorf("%s: Check() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestONNXLibraryCandidates(t *testing.T) {
+	t.Run("flag is the only candidate", func(t *testing.T) {
+		candidates, err := ONNXLibraryCandidates("/custom/lib.so")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(candidates) != 1 || candidates[0].Path != "/custom/lib.so" {
+			t.Errorf("unexpected candidates: %+v", candidates)
+		}
+	})
+
+	t.Run("env var precedes fallbacks", func(t *testing.T) {
+		if runtime.GOOS != "darwin" && runtime.GOOS != "linux" {
+			t.Skip("no system fallbacks on this platform")
+		}
+		t.Setenv("ONNX_LIBRARY_PATH", "/env/lib.so")
+
+		candidates, err := ONNXLibraryCandidates("")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(candidates) < 3 {
+			t.Fatalf("expected flag, env var and fallbacks, got %+v", candidates)
+		}
+		if candidates[0].Path != "" || candidates[1].Path != "/env/lib.so" {
+			t.Errorf("unexpected order: %+v", candidates[:2])
+		}
+	})
+}
+
+func TestModelCandidates_MatchResolution(t *testing.T) {
+	origDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(origDir)
+
+	tmpDir := t.TempDir()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("MCPMYDOCS_RERANKER_PATH", "")
+
+	candidates := RerankerModelCandidates()
+	if candidates[0].Source != "MCPMYDOCS_RERANKER_PATH" {
+		t.Errorf("first candidate should be the env var, got %s", candidates[0].Source)
+	}
+	last := candidates[len(candidates)-1]
+	if filepath.Base(last.Path) != "rerank.onnx" || last.Source != "current directory" {
+		t.Errorf("last candidate should be the working directory fallback, got %+v", last)
+	}
+}
+
+func TestResolveDBPath(t *testing.T) {
+	// Save and restore env var
+	oldEnv := os.Getenv("MCPMYDOCS_DB")
+	defer os.Setenv("MCPMYDOCS_DB", oldEnv)
+
+	tmpDir := t.TempDir()
+
+	t.Run("defaults to current directory", func(t *testing.T) {
+		os.Unsetenv("MCPMYDOCS_DB")
+
+		result, err := ResolveDBPath("")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		cwd, _ := os.Getwd()
+		if expected := filepath.Join(cwd, DefaultDBName); result != expected {
+			t.Errorf("expected %s, got %s", expected, result)
+		}
+	})
+
+	t.Run("env var", func(t *testing.T) {
+		envPath := filepath.Join(tmpDir, "env.db")
+		os.Setenv("MCPMYDOCS_DB", envPath)
+
+		result, err := ResolveDBPath("")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result != envPath {
+			t.Errorf("expected %s, got %s", envPath, result)
+		}
+	})
+
+	t.Run("user provided takes precedence", func(t *testing.T) {
+		userPath := filepath.Join(tmpDir, "user.db")
+		os.Setenv("MCPMYDOCS_DB", filepath.Join(tmpDir, "env.db"))
+
+		result, err := ResolveDBPath(userPath)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result != userPath {
+			t.Errorf("expected %s, got %s", userPath, result)
+		}
+	})
+
+	t.Run("relative path made absolute", func(t *testing.T) {
+		result, err := ResolveDBPath("data/docs.db")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !filepath.IsAbs(result) {
+			t.Errorf("expected absolute path, got %s", result)
+		}
+	})
+
+	t.Run("home directory expanded", func(t *testing.T) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			t.Skip("no home directory")
+		}
+
+		result, err := ResolveDBPath("~/data/docs.db")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if expected := filepath.Join(home, "data", "docs.db"); result != expected {
+			t.Errorf("expected %s, got %s", expected, result)
+		}
+	})
+}
@@ -36,6 +36,26 @@ var (
 	ortOnce sync.Once
 )
 
+// CheckModel verifies that the model has the inputs and the "logits" output
+// the reranker uses. The ONNX environment must already be initialized.
+func CheckModel(modelPath string) error {
+	inputs, outputs, err := ort.GetInputOutputInfo(modelPath)
+	if err != nil {
+		return err
+	}
+
+	names := make(map[string]bool)
+	for _, info := range append(inputs, outputs...) {
+		names[info.Name] = true
+	}
+	for _, name := range []string{"input_ids", "attention_mask", "token_type_ids", "logits"} {
+		if !names[name] {
+			return fmt.Errorf("model has no input or output %q", name)
+		}
+	}
+	return nil
+}
+
 // New creates a new Reranker.
 func New(modelPath, onnxLibPath string) (*Reranker, error) {
 	// Initialize ONNX environment if not already done (embedder may have initialized it)
@@ -3,6 +3,7 @@ package search
 import (
 	"context"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/mattdennewitz/mcpmydocs/internal/embedder"
@@ -21,7 +22,7 @@ const (
 	MinCandidates     = 1
 )
 
-// Service handles semantic search with optional reranking.
+// Service handles vector, keyword and hybrid search with optional reranking.
 type Service struct {
 	store    *store.Store
 	embedder *embedder.Embedder
@@ -42,17 +43,45 @@ func (s *Service) HasReranker() bool {
 	return s.reranker != nil
 }
 
+// Mode selects how candidates are retrieved.
+type Mode string
+
+// Retrieval modes.
+const (
+	ModeVector  Mode = "vector"  // embedding similarity
+	ModeKeyword Mode = "keyword" // BM25 over chunk terms
+	ModeHybrid  Mode = "hybrid"  // both, fused with reciprocal rank fusion
+	DefaultMode      = ModeVector
+)
+
+// rrfK dampens the weight of top ranks in reciprocal rank fusion.
+const rrfK = 60
+
+// ParseMode validates a mode name; an empty name selects DefaultMode.
+func ParseMode(name string) (Mode, error) {
+	switch mode := Mode(name); mode {
+	case "":
+		return DefaultMode, nil
+	case ModeVector, ModeKeyword, ModeHybrid:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid search mode %q: expected vector, keyword or hybrid", name)
+}
+
 // Params configures a search request.
 type Params struct {
 	Query      string
-	Limit      int   // Final results to return (default: 5, max: 20)
-	Candidates int   // Candidates for reranking (default: 50, max: 100)
-	Rerank     *bool // nil=auto, true=force, false=skip
+	Limit      int          // Final results to return (default: 5, max: 20)
+	Candidates int          // Candidates for reranking (default: 50, max: 100)
+	Rerank     *bool        // nil=auto, true=force, false=skip
+	Mode       Mode         // Retrieval mode (default: vector)
+	Filter     store.Filter // Collection, path, front matter, heading level and date restrictions
 }
 
 // Result holds search results.
 type Result struct {
 	Query    string
+	Mode     Mode
 	Items    []Item
 	Reranked bool
 }
@@ -61,18 +90,26 @@ type Result struct {
 type Item struct {
 	FilePath    string
 	Title       string
+	Collection  string
 	HeadingPath string
 	Content     string
 	StartLine   int
-	Score       float32 // Similarity (0-1) or rerank score
+	Kind        string         // store.ChunkKindText or store.ChunkKindCode
+	Lang        string         // languages of the chunk's fenced code blocks, space-separated
+	Metadata    map[string]any // front matter of the document; nil if none
+	Score       float32        // Similarity (0-1), BM25 score, fusion score or rerank score
 }
 
-// Search executes a semantic search with optional reranking.
+// Search executes a vector, keyword or hybrid search with optional reranking.
 func (s *Service) Search(ctx context.Context, p Params) (*Result, error) {
 	if p.Query == "" {
 		return nil, fmt.Errorf("query is required")
 	}
-	if s.embedder == nil {
+	mode, err := ParseMode(string(p.Mode))
+	if err != nil {
+		return nil, err
+	}
+	if s.embedder == nil && mode != ModeKeyword {
 		return nil, fmt.Errorf("embedder not initialized")
 	}
 
@@ -86,15 +123,81 @@ func (s *Service) Search(ctx context.Context, p Params) (*Result, error) {
 		useRerank = *p.Rerank && s.reranker != nil
 	}
 
-	// Fetch more if reranking
+	filter := p.Filter
+	if filter.Collection != "" {
+		if _, err := s.store.CollectionID(ctx, filter.Collection); err != nil {
+			return nil, err
+		}
+	}
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+
+	// Fetch more if reranking, and from each list when fusing, since the
+	// lists rank different chunks
 	fetchCount := limit
+	if useRerank || mode == ModeHybrid {
+		fetchCount = max(candidates, limit)
+	}
+
+	var vectorResults, keywordResults []store.SearchResult
+	if mode != ModeKeyword {
+		if vectorResults, err = s.vectorSearch(ctx, p.Query, fetchCount, filter); err != nil {
+			return nil, err
+		}
+	}
+	if mode != ModeVector {
+		searchStart := time.Now()
+		keywordResults, err = s.store.KeywordSearch(ctx, p.Query, fetchCount, filter)
+		if err != nil {
+			return nil, fmt.Errorf("keyword search failed: %w", err)
+		}
+		logger.Debug("keyword search", "results", len(keywordResults), "duration", time.Since(searchStart))
+	}
+
+	var results []store.SearchResult
+	var scores []float32
+	switch mode {
+	case ModeVector:
+		results = vectorResults
+		for _, r := range results {
+			scores = append(scores, float32(1.0-r.Distance)) // Convert distance to similarity
+		}
+	case ModeKeyword:
+		results = keywordResults
+		for _, r := range results {
+			scores = append(scores, float32(r.Score))
+		}
+	case ModeHybrid:
+		results, scores = fuse(vectorResults, keywordResults)
+	}
+
+	if len(results) == 0 {
+		return &Result{Query: p.Query, Mode: mode}, nil
+	}
+
+	// Rerank or convert directly
 	if useRerank {
-		fetchCount = candidates
+		if len(results) > candidates {
+			results, scores = results[:candidates], scores[:candidates]
+		}
+		rerankStart := time.Now()
+		reranked, err := s.reranker.Rerank(p.Query, results)
+		if err != nil {
+			logger.Warn("reranking failed, using retrieved results", "error", err)
+			return scoredResult(p.Query, mode, results, scores, limit), nil
+		}
+		logger.Debug("reranked", "results", len(reranked), "duration", time.Since(rerankStart))
+		return s.rerankedResult(p.Query, mode, reranked, limit), nil
 	}
 
-	// Embed query
+	return scoredResult(p.Query, mode, results, scores, limit), nil
+}
+
+// vectorSearch embeds the query and finds the most similar chunks.
+func (s *Service) vectorSearch(ctx context.Context, query string, limit int, filter store.Filter) ([]store.SearchResult, error) {
 	embedStart := time.Now()
-	embeddings, err := s.embedder.Embed([]string{p.Query})
+	embeddings, err := s.embedder.Embed([]string{query})
 	if err != nil {
 		return nil, fmt.Errorf("failed to embed query: %w", err)
 	}
@@ -103,34 +206,46 @@ func (s *Service) Search(ctx context.Context, p Params) (*Result, error) {
 	}
 	logger.Debug("query embedded", "duration", time.Since(embedStart))
 
-	// Vector search
 	searchStart := time.Now()
-	vectorResults, err := s.store.Search(ctx, embeddings[0], fetchCount)
+	results, err := s.store.SearchWithFilter(ctx, embeddings[0], limit, filter)
 	if err != nil {
 		return nil, fmt.Errorf("search failed: %w", err)
 	}
-	logger.Debug("vector search", "results", len(vectorResults), "duration", time.Since(searchStart))
-
-	if len(vectorResults) == 0 {
-		return &Result{Query: p.Query}, nil
-	}
+	logger.Debug("vector search", "results", len(results), "duration", time.Since(searchStart))
+	return results, nil
+}
 
-	// Rerank or convert directly
-	if useRerank {
-		rerankStart := time.Now()
-		reranked, err := s.reranker.Rerank(p.Query, vectorResults)
-		if err != nil {
-			logger.Warn("reranking failed, using vector results", "error", err)
-			return s.vectorResult(p.Query, vectorResults, limit, false), nil
+// fuse merges ranked result lists with reciprocal rank fusion: a chunk scores
+// the sum of 1/(rrfK + rank) over the lists it appears in.
+func fuse(lists ...[]store.SearchResult) ([]store.SearchResult, []float32) {
+	byID := make(map[int]store.SearchResult)
+	fused := make(map[int]float64)
+	var order []int
+	for _, list := range lists {
+		for rank, r := range list {
+			if _, ok := byID[r.ChunkID]; !ok {
+				byID[r.ChunkID] = r
+				order = append(order, r.ChunkID)
+			}
+			fused[r.ChunkID] += 1 / float64(rrfK+rank+1)
 		}
-		logger.Debug("reranked", "results", len(reranked), "duration", time.Since(rerankStart))
-		return s.rerankedResult(p.Query, reranked, limit), nil
 	}
 
-	return s.vectorResult(p.Query, vectorResults, limit, false), nil
+	// Ties keep the order of the first list
+	sort.SliceStable(order, func(i, j int) bool {
+		return fused[order[i]] > fused[order[j]]
+	})
+
+	results := make([]store.SearchResult, len(order))
+	scores := make([]float32, len(order))
+	for i, id := range order {
+		results[i] = byID[id]
+		scores[i] = float32(fused[id])
+	}
+	return results, scores
 }
 
-func (s *Service) vectorResult(query string, results []store.SearchResult, limit int, reranked bool) *Result {
+func scoredResult(query string, mode Mode, results []store.SearchResult, scores []float32, limit int) *Result {
 	if limit > len(results) {
 		limit = len(results)
 	}
@@ -141,21 +256,25 @@ func (s *Service) vectorResult(query string, results []store.SearchResult, limit
 		items[i] = Item{
 			FilePath:    r.FilePath,
 			Title:       r.Title,
+			Collection:  r.Collection,
 			HeadingPath: r.HeadingPath,
 			Content:     r.Content,
 			StartLine:   r.StartLine,
-			Score:       float32(1.0 - r.Distance), // Convert distance to similarity
+			Kind:        r.Kind,
+			Lang:        r.Lang,
+			Metadata:    r.Metadata,
+			Score:       scores[i],
 		}
 	}
 
 	return &Result{
-		Query:    query,
-		Items:    items,
-		Reranked: reranked,
+		Query: query,
+		Mode:  mode,
+		Items: items,
 	}
 }
 
-func (s *Service) rerankedResult(query string, results []reranker.ScoredResult, limit int) *Result {
+func (s *Service) rerankedResult(query string, mode Mode, results []reranker.ScoredResult, limit int) *Result {
 	if limit > len(results) {
 		limit = len(results)
 	}
@@ -166,15 +285,20 @@ func (s *Service) rerankedResult(query string, results []reranker.ScoredResult,
 		items[i] = Item{
 			FilePath:    r.Result.FilePath,
 			Title:       r.Result.Title,
+			Collection:  r.Result.Collection,
 			HeadingPath: r.Result.HeadingPath,
 			Content:     r.Result.Content,
 			StartLine:   r.Result.StartLine,
+			Kind:        r.Result.Kind,
+			Lang:        r.Result.Lang,
+			Metadata:    r.Result.Metadata,
 			Score:       r.Score,
 		}
 	}
 
 	return &Result{
 		Query:    query,
+		Mode:     mode,
 		Items:    items,
 		Reranked: true,
 	}
@@ -2,6 +2,8 @@ package search
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
@@ -154,6 +156,53 @@ func findRerankerPath() string {
 
 // Integration tests - require ONNX runtime and models
 
+func TestParseMode(t *testing.T) {
+	tests := map[string]Mode{"": ModeVector, "vector": ModeVector, "keyword": ModeKeyword, "hybrid": ModeHybrid}
+	for name, want := range tests {
+		if got, err := ParseMode(name); err != nil || got != want {
+			t.Errorf("ParseMode(%q) = %q, %v; want %q", name, got, err, want)
+		}
+	}
+	if _, err := ParseMode("bm25"); err == nil {
+		t.Error("expected an unknown mode to be rejected")
+	}
+}
+
+func TestFuse(t *testing.T) {
+	vector := []store.SearchResult{{ChunkID: 1}, {ChunkID: 2}, {ChunkID: 3}}
+	keyword := []store.SearchResult{{ChunkID: 3}, {ChunkID: 4}, {ChunkID: 1}}
+
+	results, scores := fuse(vector, keyword)
+
+	var ids []int
+	for _, r := range results {
+		ids = append(ids, r.ChunkID)
+	}
+	// Chunks in both lists come first; ties keep the vector order
+	if want := []int{1, 3, 2, 4}; fmt.Sprint(ids) != fmt.Sprint(want) {
+		t.Errorf("fused order = %v, want %v", ids, want)
+	}
+	if want := float32(1.0/61 + 1.0/63); scores[0] != want {
+		t.Errorf("fused score = %v, want %v", scores[0], want)
+	}
+	for i := 1; i < len(scores); i++ {
+		if scores[i] > scores[i-1] {
+			t.Errorf("scores should be descending: %v", scores)
+		}
+	}
+
+	if results, _ := fuse(nil, keyword); len(results) != len(keyword) {
+		t.Errorf("fusing with an empty list should keep the other, got %d results", len(results))
+	}
+}
+
+func TestSearch_InvalidMode(t *testing.T) {
+	svc := New(nil, nil, nil)
+	if _, err := svc.Search(context.Background(), Params{Query: "test", Mode: "fuzzy"}); err == nil {
+		t.Error("expected an error for an invalid mode")
+	}
+}
+
 func TestSearch_NoResults(t *testing.T) {
 	modelPath := findModelPath()
 	onnxLib := findONNXLib()
@@ -271,6 +320,34 @@ func TestSearch_WithResults(t *testing.T) {
 	}
 }
 
+func TestSearch_UnknownCollection(t *testing.T) {
+	modelPath := findModelPath()
+	onnxLib := findONNXLib()
+	if modelPath == "" || onnxLib == "" {
+		t.Skip("ONNX model or library not available")
+	}
+
+	tmpDir := t.TempDir()
+	st, err := store.New(filepath.Join(tmpDir, "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	defer st.Close()
+
+	emb, err := embedder.New(modelPath, onnxLib)
+	if err != nil {
+		t.Skipf("failed to create embedder: %v", err)
+	}
+	defer emb.Close()
+
+	svc := New(st, emb, nil)
+
+	_, err = svc.Search(context.Background(), Params{Query: "test", Filter: store.Filter{Collection: "missing"}})
+	if !errors.Is(err, store.ErrCollectionNotFound) {
+		t.Errorf("expected ErrCollectionNotFound, got %v", err)
+	}
+}
+
 func TestSearch_LimitClamping(t *testing.T) {
 	modelPath := findModelPath()
 	onnxLib := findONNXLib()
@@ -0,0 +1,119 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CachedEmbeddings returns the cached embeddings computed by model for the
+// given text hashes, keyed by hash. Hashes without a cache entry are absent.
+func (s *Store) CachedEmbeddings(ctx context.Context, model string, hashes []string) (map[string][]float32, error) {
+	embeddings := make(map[string][]float32)
+	if model == "" || len(hashes) == 0 {
+		return embeddings, nil
+	}
+
+	args := make([]any, 0, len(hashes)+1)
+	args = append(args, model)
+	for _, h := range hashes {
+		args = append(args, h)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(hashes)), ", ")
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT text_hash, embedding FROM embedding_cache WHERE model = ? AND text_hash IN (`+placeholders+`)`, args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var hash string
+		var raw any
+		if err := rows.Scan(&hash, &raw); err != nil {
+			return nil, err
+		}
+		embedding, err := arrayToFloatSlice(raw)
+		if err != nil {
+			return nil, err
+		}
+		embeddings[hash] = embedding
+	}
+
+	return embeddings, rows.Err()
+}
+
+// cacheEmbeddings adds the embeddings of chunks with a content hash to the
+// cache, refreshing the last use of entries that already exist. Writes are
+// serialized, so concurrent callers never conflict on an entry.
+func (s *Store) cacheEmbeddings(ctx context.Context, model string, chunks []Chunk, embeddings [][]float32) error {
+	if model == "" {
+		return nil
+	}
+
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO embedding_cache (model, text_hash, embedding) VALUES (?, ?, ?::FLOAT[384])
+		ON CONFLICT DO UPDATE SET last_used_at = now()
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	seen := make(map[string]struct{}, len(chunks))
+	for i, chunk := range chunks {
+		if chunk.ContentHash == "" || len(embeddings[i]) == 0 {
+			continue
+		}
+		if _, ok := seen[chunk.ContentHash]; ok {
+			continue
+		}
+		seen[chunk.ContentHash] = struct{}{}
+
+		if _, err := stmt.ExecContext(ctx, model, chunk.ContentHash, floatSliceToArrayString(embeddings[i])); err != nil {
+			return fmt.Errorf("failed to cache embeddings: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// PruneEmbeddingCache removes cache entries that no indexed chunk uses and
+// that have not been used for at least unusedFor. It returns the number of
+// removed and remaining entries.
+func (s *Store) PruneEmbeddingCache(ctx context.Context, unusedFor time.Duration) (int, int, error) {
+	result, err := s.db.ExecContext(ctx, `
+		DELETE FROM embedding_cache
+		WHERE last_used_at <= CAST(CURRENT_TIMESTAMP AS TIMESTAMP) - to_microseconds(?::BIGINT)
+			AND NOT EXISTS (
+				SELECT 1 FROM chunks c
+				JOIN documents d ON c.document_id = d.id
+				WHERE c.content_hash = embedding_cache.text_hash AND d.embedding_model = embedding_cache.model
+			)
+	`, unusedFor.Microseconds())
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to prune embedding cache: %w", err)
+	}
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var remaining int
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM embedding_cache").Scan(&remaining); err != nil {
+		return 0, 0, err
+	}
+	return int(removed), remaining, nil
+}
@@ -0,0 +1,239 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// BM25 parameters for keyword search.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Tokenize splits text into lowercase keyword search terms. Identifiers such
+// as error codes, config keys and CLI flags are kept whole, and their parts
+// are added as separate terms, so "--dry-run" yields "dry-run", "dry" and
+// "run".
+func Tokenize(text string) []string {
+	var terms []string
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !isWordJoiner(r)
+	})
+	for _, word := range words {
+		word = strings.TrimFunc(word, isWordJoiner)
+		if word == "" {
+			continue
+		}
+		terms = append(terms, word)
+
+		if parts := strings.FieldsFunc(word, isWordJoiner); len(parts) > 1 {
+			terms = append(terms, parts...)
+		}
+	}
+	return terms
+}
+
+// isWordJoiner reports whether r joins the parts of an identifier.
+func isWordJoiner(r rune) bool {
+	switch r {
+	case '_', '-', '.', ':', '/':
+		return true
+	}
+	return false
+}
+
+// termFrequencies counts the terms of text and returns them with the total.
+func termFrequencies(text string) (map[string]int, int) {
+	terms := Tokenize(text)
+	freqs := make(map[string]int, len(terms))
+	for _, term := range terms {
+		freqs[term]++
+	}
+	return freqs, len(terms)
+}
+
+// insertTermsTx adds a chunk's terms to the keyword index.
+func insertTermsTx(ctx context.Context, tx *sql.Tx, chunkID int, freqs map[string]int) error {
+	if len(freqs) == 0 {
+		return nil
+	}
+
+	values := make([]string, 0, len(freqs))
+	args := make([]any, 0, 3*len(freqs))
+	for term, tf := range freqs {
+		values = append(values, "(?, ?, ?)")
+		args = append(args, chunkID, term, tf)
+	}
+	_, err := tx.ExecContext(ctx,
+		"INSERT INTO chunk_terms (chunk_id, term, tf) VALUES "+strings.Join(values, ", "), args...)
+	if err != nil {
+		return fmt.Errorf("failed to index terms: %w", err)
+	}
+	return nil
+}
+
+// deleteDocumentContentTx deletes the chunks of the documents matching
+// docCond, a condition on the documents table, along with their keyword index
+// terms, links and anchors.
+func deleteDocumentContentTx(ctx context.Context, tx *sql.Tx, docCond string, args ...any) error {
+	chunkIDs := "SELECT c.id FROM chunks c JOIN documents d ON c.document_id = d.id WHERE " + docCond
+	if _, err := tx.ExecContext(ctx, "DELETE FROM chunk_terms WHERE chunk_id IN ("+chunkIDs+")", args...); err != nil {
+		return fmt.Errorf("failed to delete terms: %w", err)
+	}
+	docIDs := "SELECT d.id FROM documents d WHERE " + docCond
+	if _, err := tx.ExecContext(ctx, "DELETE FROM chunks WHERE document_id IN ("+docIDs+")", args...); err != nil {
+		return fmt.Errorf("failed to delete chunks: %w", err)
+	}
+	for _, table := range []string{"links", "anchors"} {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE document_id IN ("+docIDs+")", args...); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// backfillTerms adds chunks indexed before keyword search to the keyword index.
+func (s *Store) backfillTerms(ctx context.Context) error {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, content FROM chunks WHERE term_count IS NULL")
+	if err != nil {
+		return err
+	}
+	type pending struct {
+		id      int
+		content string
+	}
+	var chunks []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.content); err != nil {
+			rows.Close()
+			return err
+		}
+		chunks = append(chunks, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(chunks) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, p := range chunks {
+		freqs, count := termFrequencies(p.content)
+		if err := insertTermsTx(ctx, tx, p.id, freqs); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE chunks SET term_count = ? WHERE id = ?", count, p.id); err != nil {
+			return fmt.Errorf("failed to backfill keyword index: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// KeywordSearch finds chunks matching the query terms among those matching
+// the filter, ranked by BM25. Results carry the BM25 score in Score.
+func (s *Store) KeywordSearch(ctx context.Context, query string, limit int, filter Filter) ([]SearchResult, error) {
+	if limit <= 0 {
+		return nil, fmt.Errorf("limit must be positive")
+	}
+
+	// Repeated query terms are scored once
+	seen := make(map[string]bool)
+	var placeholders []string
+	var args []any
+	for _, term := range Tokenize(query) {
+		if !seen[term] {
+			seen[term] = true
+			placeholders = append(placeholders, "(?)")
+			args = append(args, term)
+		}
+	}
+	if len(placeholders) == 0 {
+		return nil, nil
+	}
+
+	where, filterArgs := filter.where()
+	q := `
+		WITH query_terms(term) AS (VALUES ` + strings.Join(placeholders, ", ") + `),
+		corpus AS (
+			SELECT COUNT(*)::DOUBLE AS n, GREATEST(AVG(term_count), 1) AS avg_len
+			FROM chunks WHERE term_count IS NOT NULL
+		),
+		doc_freq AS (
+			SELECT t.term, COUNT(*) AS df
+			FROM chunk_terms t JOIN query_terms q ON t.term = q.term
+			GROUP BY t.term
+		),
+		scores AS (
+			SELECT t.chunk_id, SUM(
+				ln(1 + (corpus.n - f.df + 0.5) / (f.df + 0.5))
+				* t.tf * (? + 1) / (t.tf + ? * (1 - ? + ? * c.term_count / corpus.avg_len))
+			) AS score
+			FROM chunk_terms t
+			JOIN doc_freq f ON t.term = f.term
+			JOIN chunks c ON c.id = t.chunk_id
+			CROSS JOIN corpus
+			GROUP BY t.chunk_id
+		)
+		SELECT
+			c.id,
+			src.root_path,
+			d.file_path,
+			d.title,
+			col.name,
+			c.heading_path,
+			c.content,
+			c.start_line,
+			COALESCE(c.kind, ?),
+			COALESCE(c.lang, ''),
+			d.metadata,
+			s.score
+		FROM scores s
+		JOIN chunks c ON c.id = s.chunk_id
+		JOIN documents d ON c.document_id = d.id
+		JOIN sources src ON d.source_id = src.id
+		JOIN collections col ON d.collection_id = col.id
+		` + where + `
+		ORDER BY s.score DESC, c.id
+		LIMIT ?
+	`
+
+	args = append(args, bm25K1, bm25K1, bm25B, bm25B, ChunkKindText)
+	args = append(args, filterArgs...)
+	args = append(args, limit)
+
+	rows, err := s.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("keyword search query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	for rows.Next() {
+		var r SearchResult
+		var root, relPath string
+		var metadata sql.NullString
+		if err := rows.Scan(&r.ChunkID, &root, &relPath, &r.Title, &r.Collection, &r.HeadingPath, &r.Content, &r.StartLine, &r.Kind, &r.Lang, &metadata, &r.Score); err != nil {
+			return nil, fmt.Errorf("failed to scan result: %w", err)
+		}
+		r.FilePath = joinSourcePath(root, relPath)
+		if r.Metadata, err = decodeMetadata(metadata); err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+
+	return results, rows.Err()
+}
@@ -0,0 +1,158 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Link is a link from a section of a document, as stored with it.
+type Link struct {
+	HeadingPath string
+	Line        int
+	Text        string
+	Destination string // as written in the document
+	TargetPath  string // target document relative to the source root; "" for external links
+	TargetName  string // note named by a wikilink, resolved when queried; "" for other links
+	Fragment    string // heading anchor in the target, without the "#"; "" for none
+}
+
+// Anchor is a heading of a document that links can point to.
+type Anchor struct {
+	Slug        string
+	HeadingPath string
+	Line        int
+}
+
+// LinkInfo is a link resolved against the indexed documents.
+type LinkInfo struct {
+	FilePath      string // absolute path of the linking document
+	Title         string
+	HeadingPath   string
+	Line          int
+	Text          string
+	Destination   string
+	Fragment      string
+	TargetPath    string // absolute path of the target document; "" for external links
+	TargetTitle   string // "" if the target document is not indexed
+	TargetHeading string // heading path of the fragment's anchor; "" if none matched
+}
+
+// External reports whether the link points outside the indexed documents,
+// such as to a web page.
+func (l LinkInfo) External() bool {
+	return l.TargetPath == ""
+}
+
+// Broken reports whether an internal link points to a document that is not
+// indexed or to a heading the document does not have.
+func (l LinkInfo) Broken() bool {
+	if l.External() {
+		return false
+	}
+	return l.TargetTitle == "" || (l.Fragment != "" && l.TargetHeading == "")
+}
+
+func insertLinksTx(ctx context.Context, tx *sql.Tx, docID int, links []Link, anchors []Anchor) error {
+	for _, l := range links {
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO links (document_id, heading_path, line, text, destination, target_path, target_name, fragment) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+			docID, l.HeadingPath, l.Line, l.Text, l.Destination, nullIfZero(l.TargetPath), nullIfZero(l.TargetName), l.Fragment,
+		); err != nil {
+			return fmt.Errorf("failed to insert link: %w", err)
+		}
+	}
+	for _, a := range anchors {
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO anchors (document_id, slug, heading_path, line) VALUES (?, ?, ?, ?)",
+			docID, a.Slug, a.HeadingPath, a.Line,
+		); err != nil {
+			return fmt.Errorf("failed to insert anchor: %w", err)
+		}
+	}
+	return nil
+}
+
+// linksQuery selects links with their target documents and anchors, which are
+// looked up in the source of the linking document. A wikilink names a note as
+// Obsidian does, case-insensitively: by its path without ".md", the end of
+// its path or one of its aliases, with the shortest path winning. Notes that
+// are not indexed are expected at the root of the source. The query is
+// completed with conditions on l and an ORDER BY clause.
+const linksQuery = `
+	SELECT src.root_path, l.file_path, l.title, l.heading_path, l.line, l.text, l.destination, l.fragment,
+		COALESCE(l.target, ''), COALESCE(t.title, ''), COALESCE(a.heading_path, '')
+	FROM (
+		SELECT l.*, d.source_id, d.collection_id, d.file_path, d.title,
+			COALESCE(l.target_path, (
+				SELECT n.file_path FROM documents n
+				WHERE n.source_id = d.source_id AND (
+					lower(n.file_path) = lower(l.target_name) || '.md'
+					OR ends_with(lower(n.file_path), '/' || lower(l.target_name) || '.md')
+					OR list_contains(list_transform(json_extract_string(n.metadata, '$.aliases[*]'), x -> lower(x)), lower(l.target_name)))
+				ORDER BY length(n.file_path), n.file_path
+				LIMIT 1
+			), l.target_name || '.md') AS target
+		FROM links l
+		JOIN documents d ON l.document_id = d.id
+	) l
+	JOIN sources src ON l.source_id = src.id
+	JOIN collections col ON l.collection_id = col.id
+	LEFT JOIN documents t ON t.source_id = l.source_id AND t.file_path = l.target
+	LEFT JOIN anchors a ON a.document_id = t.id AND a.slug = l.fragment
+`
+
+// Links returns the links in the document at filePath, in order.
+func (s *Store) Links(ctx context.Context, filePath string) ([]LinkInfo, error) {
+	sourceID, relPath, err := s.locate(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+	return s.queryLinks(ctx, linksQuery+"WHERE l.source_id = ? AND l.file_path = ? ORDER BY l.line", sourceID, relPath)
+}
+
+// Backlinks returns the links from other documents to the document at
+// filePath, ordered by linking document.
+func (s *Store) Backlinks(ctx context.Context, filePath string) ([]LinkInfo, error) {
+	sourceID, relPath, err := s.locate(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+	return s.queryLinks(ctx, linksQuery+`
+		WHERE l.source_id = ? AND l.target = ? AND l.file_path != l.target
+		ORDER BY l.file_path, l.line`, sourceID, relPath)
+}
+
+// BrokenLinks returns the internal links, in the given collection or in all
+// collections if it is empty, that point to a document that is not indexed or
+// to a heading the document does not have.
+func (s *Store) BrokenLinks(ctx context.Context, collection string) ([]LinkInfo, error) {
+	return s.queryLinks(ctx, linksQuery+`
+		WHERE l.target IS NOT NULL AND (t.id IS NULL OR (l.fragment != '' AND a.slug IS NULL))
+			AND (? = '' OR col.name = ?)
+		ORDER BY src.root_path, l.file_path, l.line`, collection, collection)
+}
+
+func (s *Store) queryLinks(ctx context.Context, query string, args ...any) ([]LinkInfo, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("links query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var links []LinkInfo
+	for rows.Next() {
+		var l LinkInfo
+		var root, relPath, targetPath string
+		if err := rows.Scan(&root, &relPath, &l.Title, &l.HeadingPath, &l.Line, &l.Text, &l.Destination, &l.Fragment,
+			&targetPath, &l.TargetTitle, &l.TargetHeading); err != nil {
+			return nil, fmt.Errorf("failed to scan link: %w", err)
+		}
+		l.FilePath = joinSourcePath(root, relPath)
+		if targetPath != "" {
+			l.TargetPath = joinSourcePath(root, targetPath)
+		}
+		links = append(links, l)
+	}
+	return links, rows.Err()
+}
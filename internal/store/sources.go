@@ -0,0 +1,331 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// LegacySourceID is the source of documents addressed by absolute path,
+// including those indexed before sources were recorded.
+const LegacySourceID = 0
+
+// legacySourceRoot is the root of the legacy source; its file paths are
+// absolute paths without the leading slash.
+const legacySourceRoot = "/"
+
+// ErrSourceNotFound is returned when no source is registered for a root directory.
+var ErrSourceNotFound = errors.New("source not found")
+
+// ErrSourceOverlap is returned when a root directory is inside, or contains,
+// the root of another source, whose files would then be indexed twice.
+var ErrSourceOverlap = errors.New("directory overlaps an indexed directory")
+
+// ErrSourceCollection is returned when a root directory is registered as a
+// source of another collection.
+var ErrSourceCollection = errors.New("directory is indexed into another collection")
+
+// Source is a root directory that documents were indexed from.
+type Source struct {
+	ID            int
+	Root          string
+	Collection    string
+	Options       SourceOptions
+	DocumentCount int
+}
+
+// SourceOptions are the options a source was indexed with, so that it can be
+// indexed again the same way.
+type SourceOptions struct {
+	Include        []string `json:"include,omitempty"`
+	Exclude        []string `json:"exclude,omitempty"`
+	MaxChunkTokens int      `json:"max_chunk_tokens,omitempty"`
+	ChunkOverlap   int      `json:"chunk_overlap,omitempty"`
+	MinChunkTokens int      `json:"min_chunk_tokens,omitempty"`
+	SeparateCode   bool     `json:"separate_code,omitempty"`
+	Obsidian       bool     `json:"obsidian,omitempty"`
+	EmbedTemplate  string   `json:"embed_template,omitempty"`
+}
+
+// joinSourcePath turns a source root and a relative file path back into an absolute path.
+func joinSourcePath(root, relPath string) string {
+	return filepath.Join(root, filepath.FromSlash(relPath))
+}
+
+// relativeTo returns filePath relative to root in slash-separated form, and
+// whether filePath is inside root.
+func relativeTo(root, filePath string) (string, bool) {
+	rel, err := filepath.Rel(root, filePath)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// locate maps an absolute file path to the registered source with the
+// deepest root containing it, falling back to the legacy source.
+func (s *Store) locate(ctx context.Context, filePath string) (int, string, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, root_path FROM sources WHERE id != ?", LegacySourceID)
+	if err != nil {
+		return 0, "", err
+	}
+	defer rows.Close()
+
+	bestID, bestRoot := LegacySourceID, ""
+	for rows.Next() {
+		var id int
+		var root string
+		if err := rows.Scan(&id, &root); err != nil {
+			return 0, "", err
+		}
+		if _, ok := relativeTo(root, filePath); ok && len(root) > len(bestRoot) {
+			bestID, bestRoot = id, root
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, "", err
+	}
+
+	if bestRoot == "" {
+		return LegacySourceID, strings.TrimLeft(filepath.ToSlash(filePath), "/"), nil
+	}
+	rel, _ := relativeTo(bestRoot, filePath)
+	return bestID, rel, nil
+}
+
+// CheckSource reports whether root can be registered as a source of the given
+// collection. It returns ErrSourceOverlap if root is inside or contains
+// another source, and ErrSourceCollection if root is a source of another
+// collection: its documents are not moved between collections implicitly.
+func (s *Store) CheckSource(ctx context.Context, root string, collectionID int) error {
+	root = filepath.Clean(root)
+	if root == legacySourceRoot {
+		return nil
+	}
+
+	var current int
+	var name string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT src.collection_id, col.name FROM sources src
+		JOIN collections col ON src.collection_id = col.id
+		WHERE src.root_path = ? AND src.id != ?
+	`, root, LegacySourceID).Scan(&current, &name)
+	switch {
+	case err == nil:
+		if current != collectionID {
+			return fmt.Errorf("%w: %s is indexed into collection %q; run 'mcpmydocs sources remove %s' before indexing it into another collection",
+				ErrSourceCollection, root, name, root)
+		}
+		return nil
+	case err != sql.ErrNoRows:
+		return err
+	}
+
+	return s.checkSourceOverlap(ctx, root, LegacySourceID)
+}
+
+// checkSourceOverlap returns ErrSourceOverlap if root is inside or contains
+// the root of a source other than skipID.
+func (s *Store) checkSourceOverlap(ctx context.Context, root string, skipID int) error {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT root_path FROM sources WHERE id != ? AND id != ? ORDER BY root_path", LegacySourceID, skipID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var other string
+		if err := rows.Scan(&other); err != nil {
+			return err
+		}
+		if _, ok := relativeTo(other, root); ok {
+			return fmt.Errorf("%w: %s is inside %s; index %s with --include to narrow it down instead",
+				ErrSourceOverlap, root, other, other)
+		}
+		if _, ok := relativeTo(root, other); ok {
+			return fmt.Errorf("%w: %s contains %s; run 'mcpmydocs sources remove %s' first",
+				ErrSourceOverlap, root, other, other)
+		}
+	}
+	return rows.Err()
+}
+
+// EnsureSource registers root as a source of the given collection and returns
+// its ID. Documents in the legacy source that lie under root are moved into
+// the new source, keeping their chunks and embeddings. Roots rejected by
+// CheckSource are not registered.
+func (s *Store) EnsureSource(ctx context.Context, root string, collectionID int) (int, error) {
+	if !filepath.IsAbs(root) {
+		return 0, fmt.Errorf("source root must be absolute: %s", root)
+	}
+	root = filepath.Clean(root)
+	if root == legacySourceRoot {
+		return LegacySourceID, nil
+	}
+	if err := s.CheckSource(ctx, root, collectionID); err != nil {
+		return 0, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRowContext(ctx, "SELECT id FROM sources WHERE root_path = ?", root).Scan(&id)
+	if err == sql.ErrNoRows {
+		err = tx.QueryRowContext(ctx,
+			"INSERT INTO sources (root_path, collection_id) VALUES (?, ?) RETURNING id", root, collectionID,
+		).Scan(&id)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to register source %s: %w", root, err)
+	}
+
+	prefix := strings.TrimLeft(filepath.ToSlash(root), "/") + "/"
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE documents SET source_id = ?, file_path = substr(file_path, ?)
+		WHERE source_id = ? AND starts_with(file_path, ?)`,
+		id, len(prefix)+1, LegacySourceID, prefix,
+	); err != nil {
+		return 0, fmt.Errorf("failed to move documents into source %s: %w", root, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// SourceID returns the ID of the source registered for root, or ErrSourceNotFound.
+func (s *Store) SourceID(ctx context.Context, root string) (int, error) {
+	var id int
+	err := s.db.QueryRowContext(ctx,
+		"SELECT id FROM sources WHERE root_path = ? AND id != ?", filepath.Clean(root), LegacySourceID,
+	).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("%w: %s", ErrSourceNotFound, root)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// SetSourceOptions records the options a source was indexed with.
+func (s *Store) SetSourceOptions(ctx context.Context, sourceID int, opts SourceOptions) error {
+	data, err := json.Marshal(opts)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, "UPDATE sources SET options = ? WHERE id = ?", string(data), sourceID)
+	return err
+}
+
+// ListSources returns the registered sources with their options and document counts.
+func (s *Store) ListSources(ctx context.Context) ([]Source, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT src.id, src.root_path, col.name, src.options, COUNT(d.id)
+		FROM sources src
+		JOIN collections col ON src.collection_id = col.id
+		LEFT JOIN documents d ON d.source_id = src.id
+		WHERE src.id != ?
+		GROUP BY src.id, src.root_path, col.name, src.options
+		ORDER BY src.root_path
+	`, LegacySourceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sources []Source
+	for rows.Next() {
+		var src Source
+		var options sql.NullString
+		if err := rows.Scan(&src.ID, &src.Root, &src.Collection, &options, &src.DocumentCount); err != nil {
+			return nil, err
+		}
+		if options.Valid {
+			if err := json.Unmarshal([]byte(options.String), &src.Options); err != nil {
+				return nil, fmt.Errorf("invalid options for source %s: %w", src.Root, err)
+			}
+		}
+		sources = append(sources, src)
+	}
+
+	return sources, rows.Err()
+}
+
+// RemoveSource unregisters the source for root and deletes all of its
+// documents and chunks. It returns the number of deleted documents.
+func (s *Store) RemoveSource(ctx context.Context, root string) (int, error) {
+	id, err := s.SourceID(ctx, root)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := deleteDocumentContentTx(ctx, tx, "d.source_id = ?", id); err != nil {
+		return 0, err
+	}
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM documents WHERE source_id = ?", id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete documents: %w", err)
+	}
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM sources WHERE id = ?", id); err != nil {
+		return 0, fmt.Errorf("failed to delete source: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return int(removed), nil
+}
+
+// RelocateSource points the source registered for oldRoot at newRoot, so its
+// documents resolve to the new location without being re-embedded. It
+// returns the number of documents in the source.
+func (s *Store) RelocateSource(ctx context.Context, oldRoot, newRoot string) (int, error) {
+	if !filepath.IsAbs(newRoot) {
+		return 0, fmt.Errorf("source root must be absolute: %s", newRoot)
+	}
+	newRoot = filepath.Clean(newRoot)
+
+	id, err := s.SourceID(ctx, oldRoot)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := s.SourceID(ctx, newRoot); err == nil {
+		return 0, fmt.Errorf("a source is already registered for %s", newRoot)
+	}
+	if err := s.checkSourceOverlap(ctx, newRoot, id); err != nil {
+		return 0, err
+	}
+
+	if _, err := s.db.ExecContext(ctx, "UPDATE sources SET root_path = ? WHERE id = ?", newRoot, id); err != nil {
+		return 0, fmt.Errorf("failed to relocate source: %w", err)
+	}
+
+	var count int
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM documents WHERE source_id = ?", id).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
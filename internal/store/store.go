@@ -3,17 +3,39 @@ package store
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	_ "github.com/marcboeker/go-duckdb"
 )
 
 const EmbeddingDim = 384
 
+// DefaultCollection is the collection documents belong to unless another is named.
+const (
+	DefaultCollection   = "default"
+	DefaultCollectionID = 0
+)
+
+// ErrCollectionNotFound is returned when a named collection does not exist.
+var ErrCollectionNotFound = errors.New("collection not found")
+
+// ErrSchemaOutdated is returned by NewReadOnly for a database created by an
+// older version, which cannot be upgraded without writing to it.
+var ErrSchemaOutdated = errors.New("database was created by an older version of mcpmydocs; run 'mcpmydocs index <directory>' to upgrade it")
+
 type Store struct {
 	db *sql.DB
+
+	// cacheMu serializes writes to the embedding cache, which files indexed
+	// concurrently share.
+	cacheMu sync.Mutex
 }
 
 // New creates a new Store and initializes the database schema.
@@ -46,7 +68,76 @@ func NewReadOnly(dbPath string) (*Store, error) {
 		return nil, fmt.Errorf("failed to load vss extension: %w", err)
 	}
 
-	return &Store{db: db}, nil
+	store := &Store{db: db}
+	if err := store.checkSchema(context.Background()); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// currentSchema lists the tables queries rely on, with the columns added to
+// them since they were introduced. initialize adds them to older databases.
+var currentSchema = map[string][]string{
+	"collections":     {"name"},
+	"sources":         {"root_path", "options"},
+	"documents":       {"source_id", "collection_id", "embedding_model", "file_size", "file_mtime", "metadata", "index_settings"},
+	"chunks":          {"token_count", "content_hash", "term_count", "kind", "lang"},
+	"chunk_terms":     {"term"},
+	"links":           {"target_name"},
+	"anchors":         {"slug"},
+	"embedding_cache": {"text_hash"},
+}
+
+// checkSchema returns ErrSchemaOutdated if the database lacks any of the
+// tables and columns of currentSchema.
+func (s *Store) checkSchema(ctx context.Context) error {
+	rows, err := s.db.QueryContext(ctx, "SELECT table_name, column_name FROM information_schema.columns")
+	if err != nil {
+		return fmt.Errorf("failed to read schema: %w", err)
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var table, column string
+		if err := rows.Scan(&table, &column); err != nil {
+			return fmt.Errorf("failed to read schema: %w", err)
+		}
+		columns[table+"."+column] = true
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read schema: %w", err)
+	}
+
+	for table, required := range currentSchema {
+		for _, column := range required {
+			if !columns[table+"."+column] {
+				return fmt.Errorf("%w (missing %s.%s)", ErrSchemaOutdated, table, column)
+			}
+		}
+	}
+	return nil
+}
+
+// CheckVSS verifies that the vss extension can be loaded without
+// downloading it, using a temporary in-memory database.
+func CheckVSS() error {
+	db, err := sql.Open("duckdb", "")
+	if err != nil {
+		return fmt.Errorf("failed to open duckdb: %w", err)
+	}
+	defer db.Close()
+
+	// LOAD only uses locally installed extensions
+	ctx := context.Background()
+	if _, err := db.ExecContext(ctx, "SET autoinstall_known_extensions = false"); err != nil {
+		return err
+	}
+	if _, err := db.ExecContext(ctx, "LOAD vss"); err != nil {
+		return fmt.Errorf("vss extension is not installed: %w", err)
+	}
+	return nil
 }
 
 func (s *Store) initialize() error {
@@ -59,17 +150,50 @@ func (s *Store) initialize() error {
 		"SET hnsw_enable_experimental_persistence = true",
 
 		// Create sequences for auto-increment
+		`CREATE SEQUENCE IF NOT EXISTS collections_id_seq`,
 		`CREATE SEQUENCE IF NOT EXISTS documents_id_seq`,
 		`CREATE SEQUENCE IF NOT EXISTS chunks_id_seq`,
 
-		// Documents table
-		`CREATE TABLE IF NOT EXISTS documents (
-			id INTEGER PRIMARY KEY DEFAULT nextval('documents_id_seq'),
-			file_path VARCHAR NOT NULL UNIQUE,
-			file_hash VARCHAR NOT NULL,
-			title VARCHAR,
-			indexed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		// Collections table (the default collection has a fixed ID)
+		`CREATE TABLE IF NOT EXISTS collections (
+			id INTEGER PRIMARY KEY DEFAULT nextval('collections_id_seq'),
+			name VARCHAR NOT NULL UNIQUE,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		fmt.Sprintf(`INSERT INTO collections (id, name) VALUES (%d, '%s') ON CONFLICT DO NOTHING`,
+			DefaultCollectionID, DefaultCollection),
+
+		// Sources are the root directories documents are indexed from. The
+		// legacy source holds documents addressed by absolute path.
+		`CREATE SEQUENCE IF NOT EXISTS sources_id_seq START 1`,
+		`CREATE TABLE IF NOT EXISTS sources (
+			id INTEGER PRIMARY KEY DEFAULT nextval('sources_id_seq'),
+			root_path VARCHAR NOT NULL,
+			collection_id INTEGER NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 		)`,
+		fmt.Sprintf(`INSERT INTO sources (id, root_path, collection_id) VALUES (%d, '%s', %d) ON CONFLICT DO NOTHING`,
+			LegacySourceID, legacySourceRoot, DefaultCollectionID),
+		// Index options as JSON; NULL for sources registered before they were recorded
+		`ALTER TABLE sources ADD COLUMN IF NOT EXISTS options VARCHAR`,
+
+		// Documents table; file paths are relative to the source root
+		`CREATE TABLE IF NOT EXISTS documents ` + documentsSchema,
+
+		// Added after the initial schema; existing documents join the default collection
+		fmt.Sprintf(`ALTER TABLE documents ADD COLUMN IF NOT EXISTS collection_id INTEGER DEFAULT %d`, DefaultCollectionID),
+		`ALTER TABLE documents ADD COLUMN IF NOT EXISTS embedding_model VARCHAR`,
+
+		// File stats let unchanged files be skipped without reading them; NULL
+		// for documents indexed before they were recorded
+		`ALTER TABLE documents ADD COLUMN IF NOT EXISTS file_size BIGINT`,
+		`ALTER TABLE documents ADD COLUMN IF NOT EXISTS file_mtime BIGINT`,
+
+		// Front matter as a JSON object; NULL for documents without it
+		`ALTER TABLE documents ADD COLUMN IF NOT EXISTS metadata VARCHAR`,
+
+		// Settings the document was chunked and embedded with; NULL for the defaults
+		`ALTER TABLE documents ADD COLUMN IF NOT EXISTS index_settings VARCHAR`,
 
 		// Chunks table with embeddings
 		`CREATE TABLE IF NOT EXISTS chunks (
@@ -83,8 +207,63 @@ func (s *Store) initialize() error {
 			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 		)`,
 
+		// Token counts and content hashes are NULL for chunks indexed before they were recorded
+		`ALTER TABLE chunks ADD COLUMN IF NOT EXISTS token_count INTEGER`,
+		`ALTER TABLE chunks ADD COLUMN IF NOT EXISTS content_hash VARCHAR`,
+
 		// Index for document lookups
 		`CREATE INDEX IF NOT EXISTS chunks_document_idx ON chunks(document_id)`,
+
+		// Keyword index: term frequencies per chunk, and the number of terms
+		// in each chunk for BM25 length normalization. term_count is NULL for
+		// chunks indexed before keyword search, which are backfilled below.
+		`ALTER TABLE chunks ADD COLUMN IF NOT EXISTS term_count INTEGER`,
+
+		// Kind of chunk and the languages of its fenced code blocks,
+		// space-separated; NULL kind is prose
+		`ALTER TABLE chunks ADD COLUMN IF NOT EXISTS kind VARCHAR`,
+		`ALTER TABLE chunks ADD COLUMN IF NOT EXISTS lang VARCHAR`,
+		`CREATE TABLE IF NOT EXISTS chunk_terms (
+			chunk_id INTEGER NOT NULL,
+			term VARCHAR NOT NULL,
+			tf INTEGER NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS chunk_terms_term_idx ON chunk_terms(term)`,
+		`CREATE INDEX IF NOT EXISTS chunk_terms_chunk_idx ON chunk_terms(chunk_id)`,
+
+		// Links between documents. target_path is relative to the source root
+		// like documents.file_path, and NULL for external links; links are
+		// resolved to documents and their anchors when queried, so they may
+		// point to files indexed later.
+		`CREATE TABLE IF NOT EXISTS links (
+			document_id INTEGER NOT NULL,
+			heading_path VARCHAR NOT NULL,
+			line INTEGER NOT NULL,
+			text VARCHAR NOT NULL,
+			destination VARCHAR NOT NULL,
+			target_path VARCHAR,
+			fragment VARCHAR NOT NULL
+		)`,
+		`ALTER TABLE links ADD COLUMN IF NOT EXISTS target_name VARCHAR`,
+		`CREATE INDEX IF NOT EXISTS links_document_idx ON links(document_id)`,
+		`CREATE INDEX IF NOT EXISTS links_target_idx ON links(target_path)`,
+		`CREATE TABLE IF NOT EXISTS anchors (
+			document_id INTEGER NOT NULL,
+			slug VARCHAR NOT NULL,
+			heading_path VARCHAR NOT NULL,
+			line INTEGER NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS anchors_document_idx ON anchors(document_id)`,
+
+		// Embeddings by model and text hash; kept when documents are removed
+		`CREATE TABLE IF NOT EXISTS embedding_cache (
+			model VARCHAR NOT NULL,
+			text_hash VARCHAR NOT NULL,
+			embedding FLOAT[384] NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			last_used_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (model, text_hash)
+		)`,
 	}
 
 	for _, q := range queries {
@@ -93,28 +272,184 @@ func (s *Store) initialize() error {
 		}
 	}
 
+	if err := s.migrateDocumentSources(ctx); err != nil {
+		return err
+	}
+	if err := s.backfillTerms(ctx); err != nil {
+		return fmt.Errorf("failed to build keyword index: %w", err)
+	}
+
 	// Create HNSW index (ignore error if exists)
 	s.db.ExecContext(ctx, `CREATE INDEX chunks_embedding_idx ON chunks USING HNSW (embedding) WITH (metric = 'cosine')`)
 
 	return nil
 }
 
+// documentsSchema is the column list of the documents table. A file path is
+// unique within its source, but this is maintained by ReplaceDocument rather
+// than a constraint: DuckDB cannot update indexed columns, which moving
+// documents between sources requires. The same holds for sources.root_path.
+const documentsSchema = `(
+	id INTEGER PRIMARY KEY DEFAULT nextval('documents_id_seq'),
+	source_id INTEGER NOT NULL,
+	file_path VARCHAR NOT NULL,
+	file_hash VARCHAR NOT NULL,
+	title VARCHAR,
+	indexed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	collection_id INTEGER DEFAULT 0,
+	embedding_model VARCHAR,
+	file_size BIGINT,
+	file_mtime BIGINT, -- Unix nanoseconds
+	metadata VARCHAR,
+	index_settings VARCHAR
+)`
+
+// migrateDocumentSources rebuilds a documents table from before sources
+// existed, whose file paths are absolute and globally unique, moving its
+// documents into the legacy source. DuckDB cannot alter constraints, so the
+// table is copied. Document IDs are kept, so chunks stay attached.
+func (s *Store) migrateDocumentSources(ctx context.Context) error {
+	var hasSource int
+	err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM information_schema.columns WHERE table_name = 'documents' AND column_name = 'source_id'`,
+	).Scan(&hasSource)
+	if err != nil {
+		return fmt.Errorf("failed to inspect documents table: %w", err)
+	}
+	if hasSource > 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	queries := []string{
+		`CREATE TABLE documents_migrated ` + documentsSchema,
+		fmt.Sprintf(`INSERT INTO documents_migrated (id, source_id, file_path, file_hash, title, indexed_at, collection_id, embedding_model)
+			SELECT id, %d, ltrim(file_path, '/'), file_hash, title, indexed_at, collection_id, embedding_model FROM documents`, LegacySourceID),
+		`DROP TABLE documents`,
+		`ALTER TABLE documents_migrated RENAME TO documents`,
+	}
+	for _, q := range queries {
+		if _, err := tx.ExecContext(ctx, q); err != nil {
+			return fmt.Errorf("failed to migrate documents table: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
 // FileUnchanged checks if a file has already been indexed with the same hash.
 func (s *Store) FileUnchanged(ctx context.Context, filePath, hash string) bool {
+	return s.FileUnchangedInCollection(ctx, DefaultCollectionID, filePath, hash)
+}
+
+// FileUnchangedInCollection checks if a file, given by absolute path, has
+// already been indexed into the given collection with the same hash.
+func (s *Store) FileUnchangedInCollection(ctx context.Context, collectionID int, filePath, hash string) bool {
+	sourceID, relPath, err := s.locate(ctx, filePath)
+	if err != nil {
+		return false
+	}
+	return s.FileUnchangedInSource(ctx, sourceID, collectionID, relPath, hash, "")
+}
+
+// FileUnchangedInSource checks if the file at relPath within a source has
+// already been indexed into the given collection with the same hash and
+// index settings.
+func (s *Store) FileUnchangedInSource(ctx context.Context, sourceID, collectionID int, relPath, hash, settings string) bool {
 	var count int
 	err := s.db.QueryRowContext(ctx,
-		"SELECT COUNT(*) FROM documents WHERE file_path = ? AND file_hash = ?",
-		filePath, hash,
+		`SELECT COUNT(*) FROM documents
+		WHERE source_id = ? AND file_path = ? AND file_hash = ? AND collection_id = ? AND COALESCE(index_settings, '') = ?`,
+		sourceID, relPath, hash, collectionID, settings,
 	).Scan(&count)
 	return err == nil && count > 0
 }
 
-// DeleteDocumentByPath deletes a document and its chunks by file path.
+// FileStatUnchanged checks if the file at relPath within a source has already
+// been indexed into the given collection with the same size, modification
+// time and index settings, so it can be skipped without reading it.
+func (s *Store) FileStatUnchanged(ctx context.Context, sourceID, collectionID int, relPath string, size int64, modTime time.Time, settings string) bool {
+	var count int
+	err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM documents
+		WHERE source_id = ? AND file_path = ? AND file_size = ? AND file_mtime = ? AND collection_id = ? AND COALESCE(index_settings, '') = ?`,
+		sourceID, relPath, size, unixNanos(modTime), collectionID, settings,
+	).Scan(&count)
+	return err == nil && count > 0
+}
+
+// IndexedFile is the stored state of an indexed file.
+type IndexedFile struct {
+	CollectionID int
+	Hash         string
+	Size         int64     // 0 if unknown
+	ModTime      time.Time // zero if unknown
+	Settings     string    // index settings; "" for the defaults
+}
+
+// FileState returns the stored state of the file at filePath, an absolute
+// path, or nil if the file is not indexed.
+func (s *Store) FileState(ctx context.Context, filePath string) (*IndexedFile, error) {
+	sourceID, relPath, err := s.locate(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var f IndexedFile
+	var size, mtime sql.NullInt64
+	err = s.db.QueryRowContext(ctx,
+		"SELECT collection_id, file_hash, file_size, file_mtime, COALESCE(index_settings, '') FROM documents WHERE source_id = ? AND file_path = ?",
+		sourceID, relPath,
+	).Scan(&f.CollectionID, &f.Hash, &size, &mtime, &f.Settings)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	f.Size = size.Int64
+	if mtime.Valid {
+		f.ModTime = time.Unix(0, mtime.Int64)
+	}
+	return &f, nil
+}
+
+// UpdateFileStat records a new size and modification time for a document
+// whose content is unchanged, e.g. after the file was touched or copied.
+func (s *Store) UpdateFileStat(ctx context.Context, sourceID int, relPath string, size int64, modTime time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE documents SET file_size = ?, file_mtime = ? WHERE source_id = ? AND file_path = ?",
+		size, unixNanos(modTime), sourceID, relPath,
+	)
+	return err
+}
+
+// unixNanos stores modification times as Unix nanoseconds, since TIMESTAMP
+// only keeps microseconds. The zero time is stored as NULL.
+func unixNanos(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UnixNano()
+}
+
+// DeleteDocumentByPath deletes a document and its chunks by absolute file path.
 func (s *Store) DeleteDocumentByPath(ctx context.Context, filePath string) error {
+	sourceID, relPath, err := s.locate(ctx, filePath)
+	if err != nil {
+		return err
+	}
+
 	// Get document ID first
 	var docID int
-	err := s.db.QueryRowContext(ctx,
-		"SELECT id FROM documents WHERE file_path = ?", filePath,
+	err = s.db.QueryRowContext(ctx,
+		"SELECT id FROM documents WHERE source_id = ? AND file_path = ?", sourceID, relPath,
 	).Scan(&docID)
 	if err == sql.ErrNoRows {
 		return nil
@@ -123,21 +458,51 @@ func (s *Store) DeleteDocumentByPath(ctx context.Context, filePath string) error
 		return err
 	}
 
+	return s.DeleteDocument(ctx, docID)
+}
+
+// DeleteDocument deletes a document and its chunks by ID.
+func (s *Store) DeleteDocument(ctx context.Context, docID int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	// Delete chunks then document
-	if _, err := s.db.ExecContext(ctx, "DELETE FROM chunks WHERE document_id = ?", docID); err != nil {
+	if err := deleteDocumentContentTx(ctx, tx, "d.id = ?", docID); err != nil {
 		return err
 	}
-	_, err = s.db.ExecContext(ctx, "DELETE FROM documents WHERE id = ?", docID)
-	return err
+	if _, err := tx.ExecContext(ctx, "DELETE FROM documents WHERE id = ?", docID); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-// InsertDocument inserts a new document and returns its ID.
+// InsertDocument inserts a new document into the default collection and returns its ID.
 func (s *Store) InsertDocument(ctx context.Context, filePath, hash, title string) (int, error) {
+	return s.InsertDocumentInCollection(ctx, DefaultCollectionID, filePath, hash, title)
+}
+
+// InsertDocumentInCollection inserts a new document, given by absolute path,
+// into the given collection and returns its ID.
+func (s *Store) InsertDocumentInCollection(ctx context.Context, collectionID int, filePath, hash, title string) (int, error) {
+	sourceID, relPath, err := s.locate(ctx, filePath)
+	if err != nil {
+		return 0, err
+	}
+
 	var id int
-	err := s.db.QueryRowContext(ctx,
-		`INSERT INTO documents (file_path, file_hash, title) VALUES (?, ?, ?) RETURNING id`,
-		filePath, hash, title,
+	err = s.db.QueryRowContext(ctx,
+		`INSERT INTO documents (source_id, file_path, file_hash, title, collection_id)
+		SELECT ?, ?, ?, ?, ?
+		WHERE NOT EXISTS (SELECT 1 FROM documents WHERE source_id = ? AND file_path = ?)
+		RETURNING id`,
+		sourceID, relPath, hash, title, collectionID, sourceID, relPath,
 	).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("document already exists: %s", filePath)
+	}
 	if err != nil {
 		return 0, err
 	}
@@ -150,24 +515,30 @@ type Chunk struct {
 	HeadingLevel int
 	Content      string
 	StartLine    int
+	TokenCount   int    // embedding model tokens before truncation; 0 if unknown
+	ContentHash  string // hash of the embedded text; "" if unknown
+	Kind         string // ChunkKindText or ChunkKindCode; "" is text
+	Lang         string // languages of the chunk's fenced code blocks, space-separated
 }
 
-// InsertChunk inserts a chunk with its embedding.
-func (s *Store) InsertChunk(ctx context.Context, docID int, chunk Chunk, embedding []float32) error {
-	var embeddingParam any
-	if len(embedding) > 0 {
-		embeddingParam = floatSliceToArrayString(embedding)
-	}
+// Kinds of chunk.
+const (
+	ChunkKindText = "text"
+	ChunkKindCode = "code"
+)
 
-	query := `
-		INSERT INTO chunks (document_id, heading_path, heading_level, content, start_line, embedding)
-		VALUES (?, ?, ?, ?, ?, ?::FLOAT[384])
-	`
+// nullIfZero stores zero values as NULL.
+func nullIfZero[T comparable](v T) any {
+	var zero T
+	if v == zero {
+		return nil
+	}
+	return v
+}
 
-	_, err := s.db.ExecContext(ctx, query,
-		docID, chunk.HeadingPath, chunk.HeadingLevel, chunk.Content, chunk.StartLine, embeddingParam,
-	)
-	return err
+// InsertChunk inserts a chunk with its embedding.
+func (s *Store) InsertChunk(ctx context.Context, docID int, chunk Chunk, embedding []float32) error {
+	return s.InsertChunks(ctx, docID, []Chunk{chunk}, [][]float32{embedding})
 }
 
 // InsertChunks inserts multiple chunks in a single transaction.
@@ -185,9 +556,18 @@ func (s *Store) InsertChunks(ctx context.Context, docID int, chunks []Chunk, emb
 	}
 	defer tx.Rollback()
 
+	if err := insertChunksTx(ctx, tx, docID, chunks, embeddings); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func insertChunksTx(ctx context.Context, tx *sql.Tx, docID int, chunks []Chunk, embeddings [][]float32) error {
 	query := `
-		INSERT INTO chunks (document_id, heading_path, heading_level, content, start_line, embedding)
-		VALUES (?, ?, ?, ?, ?, ?::FLOAT[384])
+		INSERT INTO chunks (document_id, heading_path, heading_level, content, start_line, token_count, content_hash, term_count, kind, lang, embedding)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?::FLOAT[384])
+		RETURNING id
 	`
 	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
@@ -201,13 +581,181 @@ func (s *Store) InsertChunks(ctx context.Context, docID int, chunks []Chunk, emb
 			embeddingParam = floatSliceToArrayString(embeddings[i])
 		}
 
-		_, err := stmt.ExecContext(ctx, docID, chunk.HeadingPath, chunk.HeadingLevel, chunk.Content, chunk.StartLine, embeddingParam)
+		freqs, termCount := termFrequencies(chunk.Content)
+		var chunkID int
+		err := stmt.QueryRowContext(ctx, docID, chunk.HeadingPath, chunk.HeadingLevel, chunk.Content, chunk.StartLine,
+			nullIfZero(chunk.TokenCount), nullIfZero(chunk.ContentHash), termCount, nullIfZero(chunk.Kind), nullIfZero(chunk.Lang), embeddingParam).Scan(&chunkID)
 		if err != nil {
 			return err
 		}
+		if err := insertTermsTx(ctx, tx, chunkID, freqs); err != nil {
+			return err
+		}
 	}
 
-	return tx.Commit()
+	return nil
+}
+
+// ChunkEmbeddings returns the stored embeddings of a document's chunks keyed
+// by content hash, so that unchanged chunks need not be embedded again. Only
+// embeddings computed by the given model are returned.
+func (s *Store) ChunkEmbeddings(ctx context.Context, sourceID int, relPath, model string) (map[string][]float32, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT c.content_hash, c.embedding
+		FROM chunks c
+		JOIN documents d ON c.document_id = d.id
+		WHERE d.source_id = ? AND d.file_path = ? AND d.embedding_model = ?
+			AND c.content_hash IS NOT NULL AND c.embedding IS NOT NULL
+	`, sourceID, relPath, model)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	embeddings := make(map[string][]float32)
+	for rows.Next() {
+		var hash string
+		var raw any
+		if err := rows.Scan(&hash, &raw); err != nil {
+			return nil, err
+		}
+		embedding, err := arrayToFloatSlice(raw)
+		if err != nil {
+			return nil, err
+		}
+		embeddings[hash] = embedding
+	}
+
+	return embeddings, rows.Err()
+}
+
+// arrayToFloatSlice converts a FLOAT array scanned from DuckDB to []float32.
+func arrayToFloatSlice(v any) ([]float32, error) {
+	values, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("unexpected embedding type %T", v)
+	}
+
+	out := make([]float32, len(values))
+	for i, value := range values {
+		f, ok := value.(float32)
+		if !ok {
+			return nil, fmt.Errorf("unexpected embedding element type %T", value)
+		}
+		out[i] = f
+	}
+	return out, nil
+}
+
+// DocumentVersion describes the indexed state of a file.
+type DocumentVersion struct {
+	SourceID     int
+	CollectionID int
+	FilePath     string // slash-separated, relative to the source root
+	Hash         string
+	Title        string
+	Model        string // embedding model identifier
+	Size         int64
+	ModTime      time.Time
+	Metadata     map[string]any // front matter
+	Settings     string         // chunking and embedding settings; "" for the defaults
+	Links        []Link
+	Anchors      []Anchor
+}
+
+// ReplaceDocument stores a document together with all of its chunks in one
+// transaction, replacing any previous version of the file. Either the new
+// version is stored completely or the old one is left untouched, so an
+// interrupted run never leaves a document without its chunks. Embeddings
+// must be computed before calling, to keep the transaction short.
+func (s *Store) ReplaceDocument(ctx context.Context, doc DocumentVersion, chunks []Chunk, embeddings [][]float32) (int, error) {
+	if len(chunks) != len(embeddings) {
+		return 0, fmt.Errorf("chunks and embeddings count mismatch: %d != %d", len(chunks), len(embeddings))
+	}
+
+	metadata, err := encodeMetadata(doc.Metadata)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// The document row is updated in place rather than deleted and re-inserted,
+	// which also keeps the file path unique within its source.
+	var docID int
+	err = tx.QueryRowContext(ctx,
+		"SELECT id FROM documents WHERE source_id = ? AND file_path = ?", doc.SourceID, doc.FilePath,
+	).Scan(&docID)
+	switch {
+	case err == sql.ErrNoRows:
+		err = tx.QueryRowContext(ctx,
+			`INSERT INTO documents (source_id, file_path, file_hash, title, collection_id, embedding_model, file_size, file_mtime, metadata, index_settings)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+			doc.SourceID, doc.FilePath, doc.Hash, doc.Title, doc.CollectionID, nullIfZero(doc.Model), doc.Size, unixNanos(doc.ModTime), metadata, nullIfZero(doc.Settings),
+		).Scan(&docID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to insert document: %w", err)
+		}
+	case err != nil:
+		return 0, err
+	default:
+		if err := deleteDocumentContentTx(ctx, tx, "d.id = ?", docID); err != nil {
+			return 0, err
+		}
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE documents SET file_hash = ?, title = ?, collection_id = ?, embedding_model = ?, file_size = ?, file_mtime = ?,
+			metadata = ?, index_settings = ?, indexed_at = CURRENT_TIMESTAMP WHERE id = ?`,
+			doc.Hash, doc.Title, doc.CollectionID, nullIfZero(doc.Model), doc.Size, unixNanos(doc.ModTime), metadata, nullIfZero(doc.Settings), docID,
+		); err != nil {
+			return 0, fmt.Errorf("failed to update document: %w", err)
+		}
+	}
+
+	if err := insertChunksTx(ctx, tx, docID, chunks, embeddings); err != nil {
+		return 0, fmt.Errorf("failed to insert chunks: %w", err)
+	}
+
+	if err := insertLinksTx(ctx, tx, docID, doc.Links, doc.Anchors); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	// Outside of the document's transaction, since files with a section in
+	// common would otherwise conflict on its cache entry. The cache only saves
+	// work, so the document is stored even if it cannot be updated.
+	_ = s.cacheEmbeddings(ctx, doc.Model, chunks, embeddings)
+	return docID, nil
+}
+
+// encodeMetadata stores metadata as a JSON object, or NULL if empty.
+func encodeMetadata(metadata map[string]any) (any, error) {
+	if len(metadata) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode metadata: %w", err)
+	}
+	return string(data), nil
+}
+
+// decodeMetadata reads a metadata column written by encodeMetadata.
+func decodeMetadata(raw sql.NullString) (map[string]any, error) {
+	if !raw.Valid {
+		return nil, nil
+	}
+	var metadata map[string]any
+	if err := json.Unmarshal([]byte(raw.String), &metadata); err != nil {
+		return nil, fmt.Errorf("failed to decode metadata: %w", err)
+	}
+	return metadata, nil
 }
 
 // floatSliceToArrayString converts []float32 to DuckDB array literal.
@@ -240,36 +788,187 @@ type SearchResult struct {
 	ChunkID     int
 	FilePath    string
 	Title       string
+	Collection  string
 	HeadingPath string
 	Content     string
 	StartLine   int
-	Distance    float64
+	Kind        string         // ChunkKindText or ChunkKindCode
+	Lang        string         // languages of the chunk's fenced code blocks, space-separated
+	Metadata    map[string]any // front matter of the document; nil if none
+	Distance    float64        // cosine distance, for vector search
+	Score       float64        // BM25 score, for keyword search
+}
+
+// Filter restricts the chunks a search considers. The zero value matches everything.
+//
+// Paths in PathPrefix and PathGlob are matched against the absolute file path
+// if they start with a slash, and otherwise against the path relative to the
+// indexed directory. In globs, * also matches slashes.
+type Filter struct {
+	Collection      string            // collection name; empty means all collections
+	PathPrefix      string            // file path prefix
+	PathGlob        string            // file path glob, e.g. "guides/*.md"
+	Tags            []string          // front matter tags; all must be present
+	Metadata        map[string]string // front matter key/value pairs; an empty value only requires the key
+	MinHeadingLevel int               // 0 means no minimum; the preamble has level 0
+	MaxHeadingLevel int               // 0 means no maximum
+	IndexedAfter    time.Time         // zero means unbounded
+	IndexedBefore   time.Time
+	ModifiedAfter   time.Time // file modification time; zero means unbounded
+	ModifiedBefore  time.Time
+	Kind            string // ChunkKindText or ChunkKindCode; empty means both
+	Lang            string // language of a fenced code block in the chunk, e.g. "yaml"
+}
+
+// Validate reports filter values that cannot be matched.
+func (f Filter) Validate() error {
+	for key := range f.Metadata {
+		if key == "" || strings.Contains(key, `"`) {
+			return fmt.Errorf("invalid metadata key %q", key)
+		}
+	}
+	if f.MinHeadingLevel < 0 || f.MaxHeadingLevel < 0 || (f.MaxHeadingLevel > 0 && f.MinHeadingLevel > f.MaxHeadingLevel) {
+		return fmt.Errorf("invalid heading level range %d-%d", f.MinHeadingLevel, f.MaxHeadingLevel)
+	}
+	if f.Kind != "" && f.Kind != ChunkKindText && f.Kind != ChunkKindCode {
+		return fmt.Errorf("invalid chunk kind %q (use %s or %s)", f.Kind, ChunkKindText, ChunkKindCode)
+	}
+	return nil
+}
+
+// pathColumn returns the column a path filter is matched against.
+func pathColumn(pattern string) string {
+	if strings.HasPrefix(pattern, "/") {
+		return fmt.Sprintf("(CASE WHEN src.id = %d THEN '/' || d.file_path ELSE src.root_path || '/' || d.file_path END)", LegacySourceID)
+	}
+	return "d.file_path"
+}
+
+// metadataPath returns the JSON path of a front matter key.
+func metadataPath(key string) string {
+	return `$."` + key + `"`
+}
+
+// where builds the SQL conditions and arguments for the filter.
+func (f Filter) where() (string, []any) {
+	var conds []string
+	var args []any
+
+	if f.Collection != "" {
+		conds = append(conds, "col.name = ?")
+		args = append(args, f.Collection)
+	}
+	if f.PathPrefix != "" {
+		conds = append(conds, "starts_with("+pathColumn(f.PathPrefix)+", ?)")
+		args = append(args, f.PathPrefix)
+	}
+	if f.PathGlob != "" {
+		conds = append(conds, pathColumn(f.PathGlob)+" GLOB ?")
+		args = append(args, f.PathGlob)
+	}
+
+	// Front matter values match if they equal the value or are a list containing it
+	match := func(key, value string) {
+		conds = append(conds, "(json_extract_string(d.metadata, ?) = ? OR list_contains(json_extract_string(d.metadata, ?), ?))")
+		args = append(args, metadataPath(key), value, metadataPath(key)+"[*]", value)
+	}
+	for _, tag := range f.Tags {
+		match("tags", tag)
+	}
+	keys := make([]string, 0, len(f.Metadata))
+	for key := range f.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if value := f.Metadata[key]; value != "" {
+			match(key, value)
+		} else {
+			conds = append(conds, "json_extract(d.metadata, ?) IS NOT NULL")
+			args = append(args, metadataPath(key))
+		}
+	}
+
+	if f.MinHeadingLevel > 0 {
+		conds = append(conds, "c.heading_level >= ?")
+		args = append(args, f.MinHeadingLevel)
+	}
+	if f.MaxHeadingLevel > 0 {
+		conds = append(conds, "c.heading_level <= ?")
+		args = append(args, f.MaxHeadingLevel)
+	}
+	if !f.IndexedAfter.IsZero() {
+		conds = append(conds, "d.indexed_at >= ?")
+		args = append(args, f.IndexedAfter.UTC())
+	}
+	if !f.IndexedBefore.IsZero() {
+		conds = append(conds, "d.indexed_at < ?")
+		args = append(args, f.IndexedBefore.UTC())
+	}
+	if !f.ModifiedAfter.IsZero() {
+		conds = append(conds, "d.file_mtime >= ?")
+		args = append(args, f.ModifiedAfter.UnixNano())
+	}
+	if !f.ModifiedBefore.IsZero() {
+		conds = append(conds, "d.file_mtime < ?")
+		args = append(args, f.ModifiedBefore.UnixNano())
+	}
+	if f.Kind != "" {
+		conds = append(conds, "COALESCE(c.kind, ?) = ?")
+		args = append(args, ChunkKindText, f.Kind)
+	}
+	if f.Lang != "" {
+		conds = append(conds, "list_contains(string_split(c.lang, ' '), ?)")
+		args = append(args, strings.ToLower(f.Lang))
+	}
+
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conds, " AND "), args
 }
 
 // Search finds chunks similar to the query embedding.
 func (s *Store) Search(ctx context.Context, queryEmbedding []float32, limit int) ([]SearchResult, error) {
+	return s.SearchWithFilter(ctx, queryEmbedding, limit, Filter{})
+}
+
+// SearchWithFilter finds chunks similar to the query embedding among those matching the filter.
+func (s *Store) SearchWithFilter(ctx context.Context, queryEmbedding []float32, limit int, filter Filter) ([]SearchResult, error) {
 	if limit <= 0 {
 		return nil, fmt.Errorf("limit must be positive")
 	}
 
 	arrayStr := floatSliceToArrayString(queryEmbedding)
+	where, filterArgs := filter.where()
 
 	query := `
 		SELECT
 			c.id,
+			src.root_path,
 			d.file_path,
 			d.title,
+			col.name,
 			c.heading_path,
 			c.content,
 			c.start_line,
+			COALESCE(c.kind, ?),
+			COALESCE(c.lang, ''),
+			d.metadata,
 			array_cosine_distance(c.embedding, ?::FLOAT[384]) as distance
 		FROM chunks c
 		JOIN documents d ON c.document_id = d.id
+		JOIN sources src ON d.source_id = src.id
+		JOIN collections col ON d.collection_id = col.id
+		` + where + `
 		ORDER BY distance ASC
 		LIMIT ?
 	`
 
-	rows, err := s.db.QueryContext(ctx, query, arrayStr, limit)
+	args := append([]any{ChunkKindText, arrayStr}, filterArgs...)
+	args = append(args, limit)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("search query failed: %w", err)
 	}
@@ -278,9 +977,15 @@ func (s *Store) Search(ctx context.Context, queryEmbedding []float32, limit int)
 	var results []SearchResult
 	for rows.Next() {
 		var r SearchResult
-		if err := rows.Scan(&r.ChunkID, &r.FilePath, &r.Title, &r.HeadingPath, &r.Content, &r.StartLine, &r.Distance); err != nil {
+		var root, relPath string
+		var metadata sql.NullString
+		if err := rows.Scan(&r.ChunkID, &root, &relPath, &r.Title, &r.Collection, &r.HeadingPath, &r.Content, &r.StartLine, &r.Kind, &r.Lang, &metadata, &r.Distance); err != nil {
 			return nil, fmt.Errorf("failed to scan result: %w", err)
 		}
+		r.FilePath = joinSourcePath(root, relPath)
+		if r.Metadata, err = decodeMetadata(metadata); err != nil {
+			return nil, err
+		}
 		results = append(results, r)
 	}
 
@@ -289,15 +994,23 @@ func (s *Store) Search(ctx context.Context, queryEmbedding []float32, limit int)
 
 // Document represents an indexed document.
 type Document struct {
-	ID       int
-	FilePath string
-	Title    string
+	ID         int
+	FilePath   string // absolute path
+	Title      string
+	Collection string
+	SourceID   int
+	RelPath    string         // slash-separated, relative to the source root
+	Metadata   map[string]any // front matter; nil if none
 }
 
 // ListDocuments returns all indexed documents.
 func (s *Store) ListDocuments(ctx context.Context) ([]Document, error) {
 	rows, err := s.db.QueryContext(ctx, `
-		SELECT id, file_path, title FROM documents ORDER BY title
+		SELECT d.id, src.id, src.root_path, d.file_path, d.title, col.name, d.metadata
+		FROM documents d
+		JOIN sources src ON d.source_id = src.id
+		JOIN collections col ON d.collection_id = col.id
+		ORDER BY d.title
 	`)
 	if err != nil {
 		return nil, err
@@ -307,7 +1020,13 @@ func (s *Store) ListDocuments(ctx context.Context) ([]Document, error) {
 	var docs []Document
 	for rows.Next() {
 		var d Document
-		if err := rows.Scan(&d.ID, &d.FilePath, &d.Title); err != nil {
+		var root string
+		var metadata sql.NullString
+		if err := rows.Scan(&d.ID, &d.SourceID, &root, &d.RelPath, &d.Title, &d.Collection, &metadata); err != nil {
+			return nil, err
+		}
+		d.FilePath = joinSourcePath(root, d.RelPath)
+		if d.Metadata, err = decodeMetadata(metadata); err != nil {
 			return nil, err
 		}
 		docs = append(docs, d)
@@ -316,6 +1035,208 @@ func (s *Store) ListDocuments(ctx context.Context) ([]Document, error) {
 	return docs, rows.Err()
 }
 
+// Stats summarizes the contents of the index.
+type Stats struct {
+	Documents int
+	Chunks    int
+
+	// Distribution of chunks per document
+	MinChunks    int
+	MedianChunks int
+	P90Chunks    int
+	MaxChunks    int
+	MeanChunks   float64
+
+	TotalTokens       int64 // over chunks with a known token count
+	MaxTokens         int
+	TruncatedChunks   int // chunks longer than the token limit
+	UnknownTokenCount int // chunks indexed before token counts were recorded
+	NullEmbeddings    int
+
+	LastIndexedAt time.Time // zero if nothing is indexed
+	Models        []string  // embedding models used; "" for documents indexed before models were recorded
+}
+
+// Stats computes aggregate statistics for one collection, or all collections
+// if collection is empty. Chunks with more than tokenLimit tokens are counted
+// as truncated.
+func (s *Store) Stats(ctx context.Context, collection string, tokenLimit int) (*Stats, error) {
+	where, args := Filter{Collection: collection}.where()
+	from := `
+		FROM documents d
+		JOIN collections col ON d.collection_id = col.id
+	`
+	st := &Stats{}
+
+	err := s.db.QueryRowContext(ctx, `
+		WITH per_doc AS (
+			SELECT d.id, COUNT(c.id) AS n
+			`+from+`
+			LEFT JOIN chunks c ON c.document_id = d.id
+			`+where+`
+			GROUP BY d.id
+		)
+		SELECT
+			COUNT(*),
+			COALESCE(SUM(n), 0),
+			COALESCE(MIN(n), 0),
+			COALESCE(quantile_disc(n, 0.5), 0),
+			COALESCE(quantile_disc(n, 0.9), 0),
+			COALESCE(MAX(n), 0),
+			COALESCE(AVG(n), 0)
+		FROM per_doc
+	`, args...).Scan(&st.Documents, &st.Chunks, &st.MinChunks, &st.MedianChunks, &st.P90Chunks, &st.MaxChunks, &st.MeanChunks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count chunks: %w", err)
+	}
+
+	err = s.db.QueryRowContext(ctx, `
+		SELECT
+			COALESCE(SUM(c.token_count), 0),
+			COALESCE(MAX(c.token_count), 0),
+			COUNT(*) FILTER (WHERE c.token_count > ?),
+			COUNT(*) FILTER (WHERE c.token_count IS NULL),
+			COUNT(*) FILTER (WHERE c.embedding IS NULL)
+		`+from+`
+		JOIN chunks c ON c.document_id = d.id
+		`+where,
+		append([]any{tokenLimit}, args...)...,
+	).Scan(&st.TotalTokens, &st.MaxTokens, &st.TruncatedChunks, &st.UnknownTokenCount, &st.NullEmbeddings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate chunks: %w", err)
+	}
+
+	var lastIndexed sql.NullTime
+	if err := s.db.QueryRowContext(ctx, `SELECT MAX(d.indexed_at) `+from+where, args...).Scan(&lastIndexed); err != nil {
+		return nil, fmt.Errorf("failed to read last indexed time: %w", err)
+	}
+	if lastIndexed.Valid {
+		st.LastIndexedAt = lastIndexed.Time
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT DISTINCT COALESCE(d.embedding_model, '') AS model `+from+where+` ORDER BY model`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list models: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var model string
+		if err := rows.Scan(&model); err != nil {
+			return nil, err
+		}
+		st.Models = append(st.Models, model)
+	}
+
+	return st, rows.Err()
+}
+
+// Collection represents a named group of documents.
+type Collection struct {
+	ID            int
+	Name          string
+	DocumentCount int
+}
+
+// EnsureCollection returns the ID of the named collection, creating it if needed.
+func (s *Store) EnsureCollection(ctx context.Context, name string) (int, error) {
+	if name == "" {
+		return 0, fmt.Errorf("collection name is required")
+	}
+
+	if _, err := s.db.ExecContext(ctx,
+		"INSERT INTO collections (name) VALUES (?) ON CONFLICT DO NOTHING", name,
+	); err != nil {
+		return 0, fmt.Errorf("failed to create collection %q: %w", name, err)
+	}
+
+	return s.CollectionID(ctx, name)
+}
+
+// CollectionID returns the ID of the named collection, or ErrCollectionNotFound.
+func (s *Store) CollectionID(ctx context.Context, name string) (int, error) {
+	var id int
+	err := s.db.QueryRowContext(ctx, "SELECT id FROM collections WHERE name = ?", name).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("%w: %s", ErrCollectionNotFound, name)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// ListCollections returns all collections with their document counts.
+func (s *Store) ListCollections(ctx context.Context) ([]Collection, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT col.id, col.name, COUNT(d.id)
+		FROM collections col
+		LEFT JOIN documents d ON d.collection_id = col.id
+		GROUP BY col.id, col.name
+		ORDER BY col.name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var collections []Collection
+	for rows.Next() {
+		var c Collection
+		if err := rows.Scan(&c.ID, &c.Name, &c.DocumentCount); err != nil {
+			return nil, err
+		}
+		collections = append(collections, c)
+	}
+
+	return collections, rows.Err()
+}
+
+// DeleteCollection removes a collection along with its documents and chunks,
+// returning the number of documents removed. The default collection itself is
+// kept, but emptied.
+func (s *Store) DeleteCollection(ctx context.Context, name string) (int, error) {
+	id, err := s.CollectionID(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := deleteDocumentContentTx(ctx, tx, "d.collection_id = ?", id); err != nil {
+		return 0, err
+	}
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM documents WHERE collection_id = ?", id)
+	if err != nil {
+		return 0, err
+	}
+	removed, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		"DELETE FROM sources WHERE collection_id = ? AND id != ?", id, LegacySourceID,
+	); err != nil {
+		return 0, err
+	}
+
+	if id != DefaultCollectionID {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM collections WHERE id = ?", id); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return int(removed), nil
+}
+
 // Close closes the database connection.
 func (s *Store) Close() error {
 	return s.db.Close()
@@ -2,10 +2,13 @@ package store
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"math"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -88,7 +91,7 @@ func TestInsertDocument_DuplicatePath(t *testing.T) {
 		t.Fatalf("first insert failed: %v", err)
 	}
 
-	// Try to insert with same path - should fail due to UNIQUE constraint
+	// Try to insert with same path - should fail
 	_, err = store.InsertDocument(ctx, "/path/to/file.md", "hash2", "Title 2")
 	if err == nil {
 		t.Error("expected error for duplicate path, got nil")
@@ -972,6 +975,1347 @@ func TestConcurrentReadWhileWriting(t *testing.T) {
 	}
 }
 
+func TestCollections(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	// Default collection always exists
+	id, err := store.CollectionID(ctx, DefaultCollection)
+	if err != nil {
+		t.Fatalf("CollectionID(default) failed: %v", err)
+	}
+	if id != DefaultCollectionID {
+		t.Errorf("expected default collection ID %d, got %d", DefaultCollectionID, id)
+	}
+
+	runbooksID, err := store.EnsureCollection(ctx, "runbooks")
+	if err != nil {
+		t.Fatalf("EnsureCollection failed: %v", err)
+	}
+
+	// EnsureCollection is idempotent
+	again, err := store.EnsureCollection(ctx, "runbooks")
+	if err != nil {
+		t.Fatalf("EnsureCollection (again) failed: %v", err)
+	}
+	if again != runbooksID {
+		t.Errorf("expected same ID %d, got %d", runbooksID, again)
+	}
+
+	if _, err := store.CollectionID(ctx, "missing"); !errors.Is(err, ErrCollectionNotFound) {
+		t.Errorf("expected ErrCollectionNotFound, got %v", err)
+	}
+
+	store.InsertDocument(ctx, "/docs/readme.md", "hash1", "Readme")
+	store.InsertDocumentInCollection(ctx, runbooksID, "/runbooks/deploy.md", "hash2", "Deploy")
+
+	collections, err := store.ListCollections(ctx)
+	if err != nil {
+		t.Fatalf("ListCollections failed: %v", err)
+	}
+	if len(collections) != 2 {
+		t.Fatalf("expected 2 collections, got %d", len(collections))
+	}
+	for _, c := range collections {
+		if c.DocumentCount != 1 {
+			t.Errorf("collection %s: expected 1 document, got %d", c.Name, c.DocumentCount)
+		}
+	}
+
+	docs, err := store.ListDocuments(ctx)
+	if err != nil {
+		t.Fatalf("ListDocuments failed: %v", err)
+	}
+	for _, d := range docs {
+		if d.FilePath == "/runbooks/deploy.md" && d.Collection != "runbooks" {
+			t.Errorf("expected collection 'runbooks', got %q", d.Collection)
+		}
+		if d.FilePath == "/docs/readme.md" && d.Collection != DefaultCollection {
+			t.Errorf("expected collection %q, got %q", DefaultCollection, d.Collection)
+		}
+	}
+
+	// Hash matches only within the document's collection
+	if !store.FileUnchangedInCollection(ctx, runbooksID, "/runbooks/deploy.md", "hash2") {
+		t.Error("FileUnchangedInCollection should return true in the document's collection")
+	}
+	if store.FileUnchanged(ctx, "/runbooks/deploy.md", "hash2") {
+		t.Error("FileUnchanged should return false for a document in another collection")
+	}
+}
+
+func TestSearchWithFilter_Collection(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	adrID, _ := store.EnsureCollection(ctx, "adrs")
+	docID, _ := store.InsertDocument(ctx, "/docs/a.md", "hash1", "A")
+	adrDocID, _ := store.InsertDocumentInCollection(ctx, adrID, "/adrs/b.md", "hash2", "B")
+
+	embedding := make([]float32, EmbeddingDim)
+	embedding[0] = 1
+	store.InsertChunk(ctx, docID, Chunk{HeadingPath: "# A", HeadingLevel: 1, Content: "a", StartLine: 1}, embedding)
+	store.InsertChunk(ctx, adrDocID, Chunk{HeadingPath: "# B", HeadingLevel: 1, Content: "b", StartLine: 1}, embedding)
+
+	results, err := store.SearchWithFilter(ctx, embedding, 10, Filter{Collection: "adrs"})
+	if err != nil {
+		t.Fatalf("SearchWithFilter failed: %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("expected 1 result, got %d", len(results))
+	}
+	if results[0].FilePath != "/adrs/b.md" || results[0].Collection != "adrs" {
+		t.Errorf("unexpected result: %+v", results[0])
+	}
+
+	results, err = store.Search(ctx, embedding, 10)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Errorf("expected 2 results across collections, got %d", len(results))
+	}
+}
+
+func TestSearchWithFilter(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	embedding := make([]float32, EmbeddingDim)
+	embedding[0] = 1
+
+	sourceID, _ := store.EnsureSource(ctx, "/docs", DefaultCollectionID)
+	modified := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	docs := []DocumentVersion{
+		{FilePath: "guides/deploy.md", Title: "Deploy", ModTime: modified, Metadata: map[string]any{"tags": []any{"ops", "k8s"}, "owner": "alice"}},
+		{FilePath: "guides/setup/local.md", Title: "Local", ModTime: modified.AddDate(0, 1, 0), Metadata: map[string]any{"tags": "ops"}},
+		{FilePath: "adr/001.md", Title: "ADR", ModTime: modified.AddDate(0, 2, 0)},
+	}
+	for _, doc := range docs {
+		doc.SourceID, doc.CollectionID, doc.Hash = sourceID, DefaultCollectionID, doc.FilePath
+		chunks := []Chunk{
+			{HeadingPath: "(root)", HeadingLevel: 0, Content: "intro", StartLine: 1},
+			{HeadingPath: "# " + doc.Title, HeadingLevel: 1, Content: doc.Title, StartLine: 3},
+			{HeadingPath: "# " + doc.Title + " > ## Details", HeadingLevel: 2, Content: "details", StartLine: 5},
+		}
+		if _, err := store.ReplaceDocument(ctx, doc, chunks, [][]float32{embedding, embedding, embedding}); err != nil {
+			t.Fatalf("ReplaceDocument failed: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   int
+	}{
+		{"relative prefix", Filter{PathPrefix: "guides/"}, 6},
+		{"absolute prefix", Filter{PathPrefix: "/docs/adr"}, 3},
+		{"glob", Filter{PathGlob: "guides/*.md"}, 6},
+		{"absolute glob", Filter{PathGlob: "/docs/*/deploy.md"}, 3},
+		{"tag in list", Filter{Tags: []string{"k8s"}}, 3},
+		{"tag as string", Filter{Tags: []string{"ops"}}, 6},
+		{"all tags", Filter{Tags: []string{"ops", "k8s"}}, 3},
+		{"key and value", Filter{Metadata: map[string]string{"owner": "alice"}}, 3},
+		{"key only", Filter{Metadata: map[string]string{"tags": ""}}, 6},
+		{"max heading level", Filter{MaxHeadingLevel: 1}, 6},
+		{"heading level range", Filter{MinHeadingLevel: 2, MaxHeadingLevel: 2}, 3},
+		{"modified after", Filter{ModifiedAfter: modified.AddDate(0, 1, 0)}, 6},
+		{"modified range", Filter{ModifiedAfter: modified, ModifiedBefore: modified.AddDate(0, 1, 0)}, 3},
+		{"indexed after", Filter{IndexedAfter: time.Now().Add(-time.Hour)}, 9},
+		{"indexed before", Filter{IndexedBefore: time.Now().Add(-time.Hour)}, 0},
+		{"combined", Filter{PathPrefix: "guides/", Tags: []string{"ops"}, MinHeadingLevel: 1}, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := store.SearchWithFilter(ctx, embedding, 20, tt.filter)
+			if err != nil {
+				t.Fatalf("SearchWithFilter failed: %v", err)
+			}
+			if len(results) != tt.want {
+				t.Errorf("expected %d results, got %d", tt.want, len(results))
+			}
+		})
+	}
+}
+
+func TestSearchWithFilter_CodeBlocks(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	embedding := make([]float32, EmbeddingDim)
+	embedding[0] = 1
+
+	sourceID, _ := store.EnsureSource(ctx, "/docs", DefaultCollectionID)
+	doc := DocumentVersion{SourceID: sourceID, CollectionID: DefaultCollectionID, FilePath: "deploy.md", Hash: "hash", Title: "Deploy"}
+	chunks := []Chunk{
+		{HeadingPath: "# Deploy", HeadingLevel: 1, Content: "deploy steps", StartLine: 1},
+		{HeadingPath: "# Deploy > ## Config", HeadingLevel: 2, Content: "deploy config", StartLine: 5, Kind: ChunkKindText, Lang: "yaml json"},
+		{HeadingPath: "# Deploy > ## Config", HeadingLevel: 2, Content: "replicas: 3", StartLine: 9, Kind: ChunkKindCode, Lang: "yaml"},
+		{HeadingPath: "# Deploy > ## Run", HeadingLevel: 2, Content: "deploy now", StartLine: 14, Kind: ChunkKindCode},
+	}
+	embeddings := [][]float32{embedding, embedding, embedding, embedding}
+	if _, err := store.ReplaceDocument(ctx, doc, chunks, embeddings); err != nil {
+		t.Fatalf("ReplaceDocument failed: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   int
+	}{
+		{"code", Filter{Kind: ChunkKindCode}, 2},
+		{"text includes unset kind", Filter{Kind: ChunkKindText}, 2},
+		{"language", Filter{Lang: "yaml"}, 2},
+		{"second language", Filter{Lang: "json"}, 1},
+		{"code in language", Filter{Kind: ChunkKindCode, Lang: "YAML"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := store.SearchWithFilter(ctx, embedding, 10, tt.filter)
+			if err != nil {
+				t.Fatalf("SearchWithFilter failed: %v", err)
+			}
+			if len(results) != tt.want {
+				t.Errorf("expected %d results, got %d", tt.want, len(results))
+			}
+			keyword, err := store.KeywordSearch(ctx, "deploy config replicas", 10, tt.filter)
+			if err != nil {
+				t.Fatalf("KeywordSearch failed: %v", err)
+			}
+			for _, r := range keyword {
+				if tt.filter.Kind != "" && r.Kind != tt.filter.Kind {
+					t.Errorf("keyword result of kind %q does not match the filter", r.Kind)
+				}
+			}
+		})
+	}
+
+	results, _ := store.SearchWithFilter(ctx, embedding, 10, Filter{Lang: "yaml", Kind: ChunkKindCode})
+	if len(results) != 1 || results[0].Kind != ChunkKindCode || results[0].Lang != "yaml" || results[0].StartLine != 9 {
+		t.Errorf("unexpected code result: %+v", results)
+	}
+	results, _ = store.SearchWithFilter(ctx, embedding, 1, Filter{PathPrefix: "deploy", MaxHeadingLevel: 1})
+	if len(results) != 1 || results[0].Kind != ChunkKindText || results[0].Lang != "" {
+		t.Errorf("expected a chunk without a kind to read as text, got %+v", results)
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	got := Tokenize("Set max_connections, then run --dry-run (ERR_CONN_RESET)!")
+	want := []string{"set", "max_connections", "max", "connections", "then", "run", "dry-run", "dry", "run", "err_conn_reset", "err", "conn", "reset"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("Tokenize() = %v, want %v", got, want)
+	}
+	if got := Tokenize("... -- !!"); len(got) != 0 {
+		t.Errorf("expected no terms, got %v", got)
+	}
+}
+
+func TestKeywordSearch(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	embedding := make([]float32, EmbeddingDim)
+
+	docID, _ := store.InsertDocument(ctx, "/docs/errors.md", "hash1", "Errors")
+	otherID, _ := store.InsertDocument(ctx, "/docs/other.md", "hash2", "Other")
+	store.InsertChunk(ctx, docID, Chunk{HeadingPath: "# E1042", HeadingLevel: 1, Content: "Error E1042 means the connection was reset. Retry E1042 after a backoff.", StartLine: 1}, embedding)
+	store.InsertChunk(ctx, docID, Chunk{HeadingPath: "# Timeouts", HeadingLevel: 1, Content: "Connection timeouts are retried automatically.", StartLine: 5}, embedding)
+	store.InsertChunk(ctx, otherID, Chunk{HeadingPath: "# Config", HeadingLevel: 1, Content: "Set max_connections to limit the pool.", StartLine: 1}, embedding)
+
+	results, err := store.KeywordSearch(ctx, "e1042", 10, Filter{})
+	if err != nil {
+		t.Fatalf("KeywordSearch failed: %v", err)
+	}
+	if len(results) != 1 || results[0].HeadingPath != "# E1042" || results[0].Score <= 0 {
+		t.Fatalf("expected the E1042 chunk, got %+v", results)
+	}
+
+	// Rarer and more frequent terms rank higher
+	results, _ = store.KeywordSearch(ctx, "connection E1042", 10, Filter{})
+	if len(results) != 2 || results[0].HeadingPath != "# E1042" || results[0].Score <= results[1].Score {
+		t.Errorf("unexpected ranking: %+v", results)
+	}
+
+	// Identifiers match whole or by part
+	if results, _ := store.KeywordSearch(ctx, "max_connections", 10, Filter{}); len(results) != 1 || results[0].FilePath != "/docs/other.md" {
+		t.Errorf("expected the identifier to match, got %+v", results)
+	}
+
+	// Filters apply before ranking
+	results, _ = store.KeywordSearch(ctx, "connection connections", 10, Filter{PathPrefix: "/docs/other"})
+	if len(results) != 1 || results[0].FilePath != "/docs/other.md" {
+		t.Errorf("expected only the filtered document, got %+v", results)
+	}
+
+	if results, err := store.KeywordSearch(ctx, "?!", 10, Filter{}); err != nil || len(results) != 0 {
+		t.Errorf("expected no results for a query without terms, got %v, %v", results, err)
+	}
+
+	// Deleting a document removes its terms
+	if err := store.DeleteDocument(ctx, docID); err != nil {
+		t.Fatal(err)
+	}
+	if results, _ := store.KeywordSearch(ctx, "e1042", 10, Filter{}); len(results) != 0 {
+		t.Errorf("expected deleted chunks to be gone, got %+v", results)
+	}
+	var orphans int
+	store.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM chunk_terms WHERE chunk_id NOT IN (SELECT id FROM chunks)").Scan(&orphans)
+	if orphans != 0 {
+		t.Errorf("expected no orphaned terms, got %d", orphans)
+	}
+}
+
+func TestKeywordSearch_BackfillsExistingChunks(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	st, err := New(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	docID, _ := st.InsertDocument(ctx, "/docs/a.md", "hash1", "A")
+	st.InsertChunk(ctx, docID, Chunk{HeadingPath: "# A", HeadingLevel: 1, Content: "feature_flag rollout", StartLine: 1}, nil)
+
+	// Simulate a chunk indexed before keyword search
+	st.db.ExecContext(ctx, "DELETE FROM chunk_terms")
+	st.db.ExecContext(ctx, "UPDATE chunks SET term_count = NULL")
+	st.Close()
+
+	st, err = New(dbPath)
+	if err != nil {
+		t.Fatalf("reopening failed: %v", err)
+	}
+	defer st.Close()
+
+	results, err := st.KeywordSearch(ctx, "feature_flag", 10, Filter{})
+	if err != nil || len(results) != 1 {
+		t.Errorf("expected the backfilled chunk to match, got %v, %v", results, err)
+	}
+}
+
+func TestFilter_Validate(t *testing.T) {
+	valid := Filter{Metadata: map[string]string{"owner": ""}, MinHeadingLevel: 1, MaxHeadingLevel: 3}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("expected filter to be valid: %v", err)
+	}
+
+	invalid := []Filter{
+		{Metadata: map[string]string{"": "x"}},
+		{Metadata: map[string]string{`a"b`: "x"}},
+		{MinHeadingLevel: 3, MaxHeadingLevel: 2},
+		{MaxHeadingLevel: -1},
+		{Kind: "table"},
+	}
+	for _, f := range invalid {
+		if err := f.Validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", f)
+		}
+	}
+}
+
+func TestDeleteCollection(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	specsID, _ := store.EnsureCollection(ctx, "specs")
+	docID, _ := store.InsertDocumentInCollection(ctx, specsID, "/specs/a.md", "hash1", "A")
+	store.InsertDocument(ctx, "/docs/b.md", "hash2", "B")
+	embedding := make([]float32, EmbeddingDim)
+	store.InsertChunk(ctx, docID, Chunk{HeadingPath: "# A", HeadingLevel: 1, Content: "a", StartLine: 1}, embedding)
+
+	removed, err := store.DeleteCollection(ctx, "specs")
+	if err != nil {
+		t.Fatalf("DeleteCollection failed: %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("expected 1 document removed, got %d", removed)
+	}
+
+	if _, err := store.CollectionID(ctx, "specs"); !errors.Is(err, ErrCollectionNotFound) {
+		t.Errorf("collection should be gone, got %v", err)
+	}
+
+	results, _ := store.Search(ctx, embedding, 10)
+	if len(results) != 0 {
+		t.Errorf("expected chunks to be removed, got %d", len(results))
+	}
+
+	// Default collection is emptied but kept
+	removed, err = store.DeleteCollection(ctx, DefaultCollection)
+	if err != nil {
+		t.Fatalf("DeleteCollection(default) failed: %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("expected 1 document removed, got %d", removed)
+	}
+	if _, err := store.CollectionID(ctx, DefaultCollection); err != nil {
+		t.Errorf("default collection should be kept, got %v", err)
+	}
+
+	if _, err := store.DeleteCollection(ctx, "missing"); !errors.Is(err, ErrCollectionNotFound) {
+		t.Errorf("expected ErrCollectionNotFound, got %v", err)
+	}
+}
+
+func TestNew_MigratesDocumentsWithoutCollection(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "old.db")
+
+	// Create a database with the schema that predates collections
+	db, err := sql.Open("duckdb", dbPath)
+	if err != nil {
+		t.Fatalf("failed to open duckdb: %v", err)
+	}
+	for _, q := range []string{
+		`CREATE SEQUENCE documents_id_seq`,
+		`CREATE TABLE documents (
+			id INTEGER PRIMARY KEY DEFAULT nextval('documents_id_seq'),
+			file_path VARCHAR NOT NULL UNIQUE,
+			file_hash VARCHAR NOT NULL,
+			title VARCHAR,
+			indexed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`INSERT INTO documents (file_path, file_hash, title) VALUES ('/old.md', 'hash', 'Old')`,
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatalf("failed to create old schema: %v", err)
+		}
+	}
+	db.Close()
+
+	store, err := New(dbPath)
+	if err != nil {
+		t.Fatalf("New on old database failed: %v", err)
+	}
+	defer store.Close()
+
+	docs, err := store.ListDocuments(context.Background())
+	if err != nil {
+		t.Fatalf("ListDocuments failed: %v", err)
+	}
+	if len(docs) != 1 || docs[0].Collection != DefaultCollection {
+		t.Errorf("expected old document in default collection, got %+v", docs)
+	}
+	if docs[0].FilePath != "/old.md" || docs[0].SourceID != LegacySourceID {
+		t.Errorf("expected old document in the legacy source at its absolute path, got %+v", docs[0])
+	}
+	if !store.FileUnchanged(context.Background(), "/old.md", "hash") {
+		t.Error("migrated document should still be found by path")
+	}
+}
+
+func TestNewReadOnly_OutdatedSchema(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "old.db")
+
+	// Create a database with the schema that predates collections and sources
+	db, err := sql.Open("duckdb", dbPath)
+	if err != nil {
+		t.Fatalf("failed to open duckdb: %v", err)
+	}
+	for _, q := range []string{
+		`CREATE SEQUENCE documents_id_seq`,
+		`CREATE TABLE documents (
+			id INTEGER PRIMARY KEY DEFAULT nextval('documents_id_seq'),
+			file_path VARCHAR NOT NULL UNIQUE,
+			file_hash VARCHAR NOT NULL,
+			title VARCHAR,
+			indexed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`INSERT INTO documents (file_path, file_hash, title) VALUES ('/old.md', 'hash', 'Old')`,
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatalf("failed to create old schema: %v", err)
+		}
+	}
+	db.Close()
+
+	if _, err := NewReadOnly(dbPath); !errors.Is(err, ErrSchemaOutdated) {
+		t.Fatalf("expected ErrSchemaOutdated, got %v", err)
+	}
+
+	// Opening the database for writing upgrades it
+	store, err := New(dbPath)
+	if err != nil {
+		t.Fatalf("New on old database failed: %v", err)
+	}
+	store.Close()
+
+	ro, err := NewReadOnly(dbPath)
+	if err != nil {
+		t.Fatalf("NewReadOnly after upgrade failed: %v", err)
+	}
+	defer ro.Close()
+	if docs, err := ro.ListDocuments(context.Background()); err != nil || len(docs) != 1 {
+		t.Errorf("expected the upgraded document, got %+v, %v", docs, err)
+	}
+}
+
+func TestEnsureSource(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	if _, err := store.EnsureSource(ctx, "relative/docs", DefaultCollectionID); err == nil {
+		t.Error("expected error for relative root")
+	}
+
+	// Documents indexed by absolute path before the source existed
+	legacyID, _ := store.InsertDocument(ctx, "/home/me/docs/guide/setup.md", "hash1", "Setup")
+	store.InsertDocument(ctx, "/home/me/other/notes.md", "hash2", "Notes")
+
+	id, err := store.EnsureSource(ctx, "/home/me/docs/", DefaultCollectionID)
+	if err != nil {
+		t.Fatalf("EnsureSource failed: %v", err)
+	}
+	again, err := store.EnsureSource(ctx, "/home/me/docs", DefaultCollectionID)
+	if err != nil || again != id {
+		t.Errorf("EnsureSource should return the existing source %d, got %d (%v)", id, again, err)
+	}
+
+	docs, err := store.ListDocuments(ctx)
+	if err != nil {
+		t.Fatalf("ListDocuments failed: %v", err)
+	}
+	for _, d := range docs {
+		switch d.ID {
+		case legacyID:
+			if d.SourceID != id || d.RelPath != "guide/setup.md" || d.FilePath != "/home/me/docs/guide/setup.md" {
+				t.Errorf("document under the root should move into the source, got %+v", d)
+			}
+		default:
+			if d.SourceID != LegacySourceID {
+				t.Errorf("document outside the root should stay in the legacy source, got %+v", d)
+			}
+		}
+	}
+
+	// Absolute-path lookups resolve to the source
+	if !store.FileUnchanged(ctx, "/home/me/docs/guide/setup.md", "hash1") {
+		t.Error("FileUnchanged should find the moved document")
+	}
+
+	sources, err := store.ListSources(ctx)
+	if err != nil {
+		t.Fatalf("ListSources failed: %v", err)
+	}
+	if len(sources) != 1 || sources[0].Root != "/home/me/docs" || sources[0].DocumentCount != 1 {
+		t.Errorf("unexpected sources: %+v", sources)
+	}
+}
+
+func TestEnsureSource_Overlap(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	parent, err := store.EnsureSource(ctx, "/docs", DefaultCollectionID)
+	if err != nil {
+		t.Fatalf("EnsureSource failed: %v", err)
+	}
+	doc := DocumentVersion{SourceID: parent, FilePath: "guide/setup.md", Hash: "hash", Title: "Setup"}
+	if _, err := store.ReplaceDocument(ctx, doc, nil, nil); err != nil {
+		t.Fatalf("ReplaceDocument failed: %v", err)
+	}
+
+	// Neither a subdirectory nor a parent directory of a source is registered
+	if _, err := store.EnsureSource(ctx, "/docs/guide", DefaultCollectionID); !errors.Is(err, ErrSourceOverlap) {
+		t.Errorf("expected ErrSourceOverlap for a subdirectory, got %v", err)
+	}
+	store.EnsureSource(ctx, "/home/me/notes", DefaultCollectionID)
+	if _, err := store.EnsureSource(ctx, "/home", DefaultCollectionID); !errors.Is(err, ErrSourceOverlap) {
+		t.Errorf("expected ErrSourceOverlap for a parent directory, got %v", err)
+	}
+	// A sibling with a common prefix does not overlap
+	if _, err := store.EnsureSource(ctx, "/docs-old", DefaultCollectionID); err != nil {
+		t.Errorf("EnsureSource for a sibling failed: %v", err)
+	}
+	if _, err := store.RelocateSource(ctx, "/docs-old", "/docs/old"); !errors.Is(err, ErrSourceOverlap) {
+		t.Errorf("expected ErrSourceOverlap when relocating into a source, got %v", err)
+	}
+
+	// The document stays in the parent source, once
+	docs, _ := store.ListDocuments(ctx)
+	if len(docs) != 1 || docs[0].SourceID != parent || docs[0].FilePath != "/docs/guide/setup.md" {
+		t.Errorf("expected the document to stay in /docs, got %+v", docs)
+	}
+}
+
+func TestEnsureSource_Collection(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	notesID, _ := store.EnsureCollection(ctx, "notes")
+	id, err := store.EnsureSource(ctx, "/docs", DefaultCollectionID)
+	if err != nil {
+		t.Fatalf("EnsureSource failed: %v", err)
+	}
+
+	if _, err := store.EnsureSource(ctx, "/docs", notesID); !errors.Is(err, ErrSourceCollection) {
+		t.Errorf("expected ErrSourceCollection, got %v", err)
+	}
+	if err := store.CheckSource(ctx, "/docs", notesID); !errors.Is(err, ErrSourceCollection) {
+		t.Errorf("CheckSource: expected ErrSourceCollection, got %v", err)
+	}
+	sources, _ := store.ListSources(ctx)
+	if len(sources) != 1 || sources[0].Collection != DefaultCollection {
+		t.Errorf("the source should stay in the default collection, got %+v", sources)
+	}
+
+	// Once removed, the directory can be indexed into another collection
+	store.RemoveSource(ctx, "/docs")
+	again, err := store.EnsureSource(ctx, "/docs", notesID)
+	if err != nil || again == id {
+		t.Errorf("expected a new source after removing the old one, got %d (%v)", again, err)
+	}
+}
+
+func TestSources_SameRelativePath(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	embedding := make([]float32, EmbeddingDim)
+	chunk := []Chunk{{HeadingPath: "# Readme", HeadingLevel: 1, Content: "readme"}}
+
+	for _, root := range []string{"/a", "/b"} {
+		id, err := store.EnsureSource(ctx, root, DefaultCollectionID)
+		if err != nil {
+			t.Fatalf("EnsureSource failed: %v", err)
+		}
+		doc := DocumentVersion{SourceID: id, FilePath: "README.md", Hash: "hash", Title: "Readme"}
+		if _, err := store.ReplaceDocument(ctx, doc, chunk, [][]float32{embedding}); err != nil {
+			t.Fatalf("ReplaceDocument for %s failed: %v", root, err)
+		}
+	}
+
+	results, err := store.Search(ctx, embedding, 10)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	paths := map[string]bool{}
+	for _, r := range results {
+		paths[r.FilePath] = true
+	}
+	if len(results) != 2 || !paths["/a/README.md"] || !paths["/b/README.md"] {
+		t.Errorf("expected results re-joined to both roots, got %+v", results)
+	}
+}
+
+func TestRelocateSource(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	id, _ := store.EnsureSource(ctx, "/old/docs", DefaultCollectionID)
+	store.EnsureSource(ctx, "/taken", DefaultCollectionID)
+	doc := DocumentVersion{SourceID: id, FilePath: "a.md", Hash: "hash", Title: "A"}
+	if _, err := store.ReplaceDocument(ctx, doc, nil, nil); err != nil {
+		t.Fatalf("ReplaceDocument failed: %v", err)
+	}
+
+	if _, err := store.RelocateSource(ctx, "/missing", "/new"); !errors.Is(err, ErrSourceNotFound) {
+		t.Errorf("expected ErrSourceNotFound, got %v", err)
+	}
+	if _, err := store.RelocateSource(ctx, "/old/docs", "/taken"); err == nil {
+		t.Error("expected error when the new root is already a source")
+	}
+
+	count, err := store.RelocateSource(ctx, "/old/docs", "/new/docs")
+	if err != nil {
+		t.Fatalf("RelocateSource failed: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("expected 1 document, got %d", count)
+	}
+
+	docs, _ := store.ListDocuments(ctx)
+	if len(docs) != 1 || docs[0].FilePath != "/new/docs/a.md" {
+		t.Errorf("expected document under the new root, got %+v", docs)
+	}
+	if !store.FileUnchanged(ctx, "/new/docs/a.md", "hash") {
+		t.Error("relocated document should keep its hash")
+	}
+}
+
+func TestSetSourceOptions(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	id, _ := store.EnsureSource(ctx, "/docs", DefaultCollectionID)
+	store.EnsureSource(ctx, "/plain", DefaultCollectionID)
+
+	opts := SourceOptions{Include: []string{"guides/**"}, Exclude: []string{"drafts/", "*.tmp.md"}}
+	if err := store.SetSourceOptions(ctx, id, opts); err != nil {
+		t.Fatalf("SetSourceOptions failed: %v", err)
+	}
+
+	sources, err := store.ListSources(ctx)
+	if err != nil {
+		t.Fatalf("ListSources failed: %v", err)
+	}
+	if len(sources) != 2 {
+		t.Fatalf("expected 2 sources, got %d", len(sources))
+	}
+	got := sources[0].Options
+	if sources[0].Root != "/docs" || len(got.Include) != 1 || got.Include[0] != "guides/**" || len(got.Exclude) != 2 {
+		t.Errorf("unexpected options: %+v", sources[0])
+	}
+	// Sources without recorded options have none
+	if sources[1].Options.Include != nil || sources[1].Options.Exclude != nil {
+		t.Errorf("expected no options, got %+v", sources[1].Options)
+	}
+}
+
+func TestRemoveSource(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	embedding := make([]float32, EmbeddingDim)
+	chunks := []Chunk{{HeadingPath: "# A", HeadingLevel: 1, Content: "text", StartLine: 1}}
+	for _, root := range []string{"/docs", "/other"} {
+		id, _ := store.EnsureSource(ctx, root, DefaultCollectionID)
+		for _, path := range []string{"a.md", "b.md"} {
+			doc := DocumentVersion{SourceID: id, FilePath: path, Hash: "hash"}
+			if _, err := store.ReplaceDocument(ctx, doc, chunks, [][]float32{embedding}); err != nil {
+				t.Fatalf("ReplaceDocument failed: %v", err)
+			}
+		}
+	}
+
+	if _, err := store.RemoveSource(ctx, "/missing"); !errors.Is(err, ErrSourceNotFound) {
+		t.Errorf("expected ErrSourceNotFound, got %v", err)
+	}
+
+	removed, err := store.RemoveSource(ctx, "/docs")
+	if err != nil {
+		t.Fatalf("RemoveSource failed: %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("expected 2 removed documents, got %d", removed)
+	}
+
+	sources, _ := store.ListSources(ctx)
+	if len(sources) != 1 || sources[0].Root != "/other" {
+		t.Errorf("expected only /other to remain, got %+v", sources)
+	}
+	results, _ := store.Search(ctx, embedding, 10)
+	if len(results) != 2 {
+		t.Errorf("expected the chunks of the removed source to be deleted, got %d results", len(results))
+	}
+}
+
+func TestReplaceDocument(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	embedding := make([]float32, EmbeddingDim)
+	embedding[0] = 1
+
+	doc := DocumentVersion{CollectionID: DefaultCollectionID, FilePath: "doc.md", Hash: "hash1", Title: "Version 1"}
+	chunks := []Chunk{
+		{HeadingPath: "# A", HeadingLevel: 1, Content: "first", StartLine: 1},
+		{HeadingPath: "# B", HeadingLevel: 1, Content: "second", StartLine: 5},
+	}
+	docID, err := store.ReplaceDocument(ctx, doc, chunks, [][]float32{embedding, embedding})
+	if err != nil {
+		t.Fatalf("ReplaceDocument (insert) failed: %v", err)
+	}
+
+	// Replace with a new version that has fewer chunks
+	doc.Hash, doc.Title = "hash2", "Version 2"
+	newID, err := store.ReplaceDocument(ctx, doc, chunks[:1], [][]float32{embedding})
+	if err != nil {
+		t.Fatalf("ReplaceDocument (replace) failed: %v", err)
+	}
+	if newID != docID {
+		t.Errorf("expected document ID %d to be kept, got %d", docID, newID)
+	}
+	if !store.FileUnchanged(ctx, "/doc.md", "hash2") {
+		t.Error("expected new hash to be stored")
+	}
+
+	results, err := store.Search(ctx, embedding, 10)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("expected old chunks to be replaced, got %d chunks", len(results))
+	}
+	if results[0].Title != "Version 2" || results[0].Content != "first" {
+		t.Errorf("unexpected result: %+v", results[0])
+	}
+
+	// A failed replacement leaves the previous version untouched
+	doc.Hash = "hash3"
+	if _, err := store.ReplaceDocument(ctx, doc, chunks, [][]float32{embedding}); err == nil {
+		t.Fatal("expected error for chunk/embedding mismatch")
+	}
+	if !store.FileUnchanged(ctx, "/doc.md", "hash2") {
+		t.Error("previous version should be kept after a failed replacement")
+	}
+	results, _ = store.Search(ctx, embedding, 10)
+	if len(results) != 1 {
+		t.Errorf("expected previous chunks to be kept, got %d", len(results))
+	}
+}
+
+func TestLinks(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	embedding := make([]float32, EmbeddingDim)
+	chunks := []Chunk{{HeadingPath: "# Doc", HeadingLevel: 1, Content: "text", StartLine: 1}}
+	embeddings := [][]float32{embedding}
+
+	guide := DocumentVersion{CollectionID: DefaultCollectionID, FilePath: "docs/guide.md", Hash: "h1", Title: "Guide",
+		Links: []Link{
+			{HeadingPath: "# Guide", Line: 3, Text: "setup", Destination: "setup.md#install", TargetPath: "docs/setup.md", Fragment: "install"},
+			{HeadingPath: "# Guide", Line: 4, Text: "removal", Destination: "setup.md#uninstall", TargetPath: "docs/setup.md", Fragment: "uninstall"},
+			{HeadingPath: "# Guide", Line: 5, Text: "faq", Destination: "faq.md", TargetPath: "docs/faq.md"},
+			{HeadingPath: "# Guide", Line: 6, Text: "site", Destination: "https://example.com"},
+			{HeadingPath: "# Guide", Line: 7, Text: "top", Destination: "#guide", TargetPath: "docs/guide.md", Fragment: "guide"},
+		},
+		Anchors: []Anchor{{Slug: "guide", HeadingPath: "# Guide", Line: 1}},
+	}
+	setup := DocumentVersion{CollectionID: DefaultCollectionID, FilePath: "docs/setup.md", Hash: "h2", Title: "Setup",
+		Anchors: []Anchor{{Slug: "install", HeadingPath: "# Setup > ## Install", Line: 3}},
+	}
+	for _, doc := range []DocumentVersion{guide, setup} {
+		if _, err := store.ReplaceDocument(ctx, doc, chunks, embeddings); err != nil {
+			t.Fatalf("ReplaceDocument failed: %v", err)
+		}
+	}
+
+	links, err := store.Links(ctx, "/docs/guide.md")
+	if err != nil {
+		t.Fatalf("Links failed: %v", err)
+	}
+	if len(links) != 5 {
+		t.Fatalf("expected 5 links, got %d: %+v", len(links), links)
+	}
+	if l := links[0]; l.FilePath != "/docs/guide.md" || l.TargetPath != "/docs/setup.md" || l.TargetTitle != "Setup" || l.TargetHeading != "# Setup > ## Install" || l.Broken() {
+		t.Errorf("unexpected resolved link: %+v", l)
+	}
+	if l := links[1]; !l.Broken() || l.TargetTitle != "Setup" || l.TargetHeading != "" {
+		t.Errorf("expected missing heading to be broken: %+v", l)
+	}
+	if l := links[2]; !l.Broken() || l.TargetTitle != "" {
+		t.Errorf("expected missing document to be broken: %+v", l)
+	}
+	if l := links[3]; !l.External() || l.Broken() {
+		t.Errorf("expected external link: %+v", l)
+	}
+	if l := links[4]; l.Broken() || l.TargetHeading != "# Guide" {
+		t.Errorf("expected link within the document to resolve: %+v", l)
+	}
+
+	backlinks, err := store.Backlinks(ctx, "/docs/setup.md")
+	if err != nil {
+		t.Fatalf("Backlinks failed: %v", err)
+	}
+	if len(backlinks) != 2 || backlinks[0].FilePath != "/docs/guide.md" || backlinks[0].Title != "Guide" {
+		t.Errorf("expected 2 backlinks from the guide, got %+v", backlinks)
+	}
+	// Links within a document are not backlinks
+	if backlinks, _ := store.Backlinks(ctx, "/docs/guide.md"); len(backlinks) != 0 {
+		t.Errorf("expected no backlinks to the guide, got %+v", backlinks)
+	}
+
+	broken, err := store.BrokenLinks(ctx, "")
+	if err != nil {
+		t.Fatalf("BrokenLinks failed: %v", err)
+	}
+	if len(broken) != 2 || broken[0].Line != 4 || broken[1].Line != 5 {
+		t.Errorf("expected 2 broken links, got %+v", broken)
+	}
+	if broken, _ := store.BrokenLinks(ctx, "other"); len(broken) != 0 {
+		t.Errorf("expected no broken links in another collection, got %+v", broken)
+	}
+
+	// Indexing the missing document fixes the links to it
+	faq := DocumentVersion{CollectionID: DefaultCollectionID, FilePath: "docs/faq.md", Hash: "h3", Title: "FAQ"}
+	if _, err := store.ReplaceDocument(ctx, faq, chunks, embeddings); err != nil {
+		t.Fatalf("ReplaceDocument failed: %v", err)
+	}
+	if broken, _ := store.BrokenLinks(ctx, ""); len(broken) != 1 {
+		t.Errorf("expected 1 broken link after indexing the target, got %+v", broken)
+	}
+
+	// Links are replaced and deleted with their document
+	guide.Hash, guide.Links = "h4", guide.Links[:1]
+	if _, err := store.ReplaceDocument(ctx, guide, chunks, embeddings); err != nil {
+		t.Fatalf("ReplaceDocument failed: %v", err)
+	}
+	if links, _ := store.Links(ctx, "/docs/guide.md"); len(links) != 1 {
+		t.Errorf("expected replaced links, got %+v", links)
+	}
+	if err := store.DeleteDocumentByPath(ctx, "/docs/guide.md"); err != nil {
+		t.Fatalf("DeleteDocumentByPath failed: %v", err)
+	}
+	if backlinks, _ := store.Backlinks(ctx, "/docs/setup.md"); len(backlinks) != 0 {
+		t.Errorf("expected links to be deleted with their document, got %+v", backlinks)
+	}
+	var anchors int
+	store.db.QueryRow("SELECT COUNT(*) FROM anchors WHERE slug = 'guide'").Scan(&anchors)
+	if anchors != 0 {
+		t.Errorf("expected anchors to be deleted with their document, got %d", anchors)
+	}
+}
+
+func TestLinks_WikiLinks(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	embedding := make([]float32, EmbeddingDim)
+	chunks := []Chunk{{HeadingPath: "# Doc", HeadingLevel: 1, Content: "text", StartLine: 1}}
+	embeddings := [][]float32{embedding}
+
+	docs := []DocumentVersion{
+		{FilePath: "index.md", Title: "Index", Links: []Link{
+			{Line: 1, Text: "setup", Destination: "[[setup]]", TargetName: "setup"},
+			{Line: 2, Text: "Deploy", Destination: "[[guides/Deploy]]", TargetName: "guides/Deploy"},
+			{Line: 3, Text: "Shipping", Destination: "[[Shipping#Steps]]", TargetName: "Shipping", Fragment: "steps"},
+			{Line: 4, Text: "Roadmap", Destination: "[[Roadmap]]", TargetName: "Roadmap"},
+		}},
+		{FilePath: "archive/old/Setup.md", Title: "Old setup"},
+		{FilePath: "Setup.md", Title: "Setup"},
+		{FilePath: "team/guides/deploy.md", Title: "Deploy", Metadata: map[string]any{"aliases": []any{"shipping"}},
+			Anchors: []Anchor{{Slug: "steps", HeadingPath: "# Deploy > ## Steps", Line: 5}}},
+	}
+	for i, doc := range docs {
+		doc.CollectionID, doc.Hash = DefaultCollectionID, fmt.Sprintf("h%d", i)
+		if _, err := store.ReplaceDocument(ctx, doc, chunks, embeddings); err != nil {
+			t.Fatalf("ReplaceDocument failed: %v", err)
+		}
+	}
+
+	links, err := store.Links(ctx, "/index.md")
+	if err != nil {
+		t.Fatalf("Links failed: %v", err)
+	}
+	if len(links) != 4 {
+		t.Fatalf("expected 4 links, got %+v", links)
+	}
+	// Names match case-insensitively, and the shortest path wins
+	if links[0].TargetPath != "/Setup.md" || links[0].TargetTitle != "Setup" {
+		t.Errorf("expected [[setup]] to resolve to /Setup.md, got %+v", links[0])
+	}
+	if links[1].TargetPath != "/team/guides/deploy.md" {
+		t.Errorf("expected a partial path to resolve, got %+v", links[1])
+	}
+	if links[2].TargetPath != "/team/guides/deploy.md" || links[2].TargetHeading != "# Deploy > ## Steps" {
+		t.Errorf("expected an alias to resolve, got %+v", links[2])
+	}
+	if !links[3].Broken() || links[3].TargetPath != "/Roadmap.md" {
+		t.Errorf("expected a missing note to be broken at the root, got %+v", links[3])
+	}
+
+	backlinks, err := store.Backlinks(ctx, "/team/guides/deploy.md")
+	if err != nil {
+		t.Fatalf("Backlinks failed: %v", err)
+	}
+	if len(backlinks) != 2 {
+		t.Errorf("expected 2 backlinks through the path and the alias, got %+v", backlinks)
+	}
+}
+
+func TestFileStatUnchanged(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	modTime := time.Date(2026, 1, 2, 3, 4, 5, 123456789, time.UTC)
+
+	if store.FileStatUnchanged(ctx, LegacySourceID, DefaultCollectionID, "doc.md", 42, modTime, "") {
+		t.Error("FileStatUnchanged should return false for non-existent file")
+	}
+
+	doc := DocumentVersion{CollectionID: DefaultCollectionID, FilePath: "doc.md", Hash: "hash1", Size: 42, ModTime: modTime}
+	if _, err := store.ReplaceDocument(ctx, doc, nil, nil); err != nil {
+		t.Fatalf("ReplaceDocument failed: %v", err)
+	}
+
+	if !store.FileStatUnchanged(ctx, LegacySourceID, DefaultCollectionID, "doc.md", 42, modTime, "") {
+		t.Error("FileStatUnchanged should return true for matching stat")
+	}
+	// Modification times are compared with full precision
+	if store.FileStatUnchanged(ctx, LegacySourceID, DefaultCollectionID, "doc.md", 42, modTime.Add(time.Nanosecond), "") {
+		t.Error("FileStatUnchanged should return false for a different modification time")
+	}
+	if store.FileStatUnchanged(ctx, LegacySourceID, DefaultCollectionID, "doc.md", 43, modTime, "") {
+		t.Error("FileStatUnchanged should return false for a different size")
+	}
+
+	touched := modTime.Add(time.Hour)
+	if err := store.UpdateFileStat(ctx, LegacySourceID, "doc.md", 42, touched); err != nil {
+		t.Fatalf("UpdateFileStat failed: %v", err)
+	}
+	if !store.FileStatUnchanged(ctx, LegacySourceID, DefaultCollectionID, "doc.md", 42, touched, "") {
+		t.Error("expected the updated stat to be stored")
+	}
+	if !store.FileUnchanged(ctx, "/doc.md", "hash1") {
+		t.Error("updating the stat should keep the hash")
+	}
+
+	// Documents without a recorded stat always fall back to the hash
+	if _, err := store.InsertDocument(ctx, "/old.md", "hash2", "Old"); err != nil {
+		t.Fatalf("InsertDocument failed: %v", err)
+	}
+	if store.FileStatUnchanged(ctx, LegacySourceID, DefaultCollectionID, "old.md", 0, time.Time{}, "") {
+		t.Error("FileStatUnchanged should return false without a recorded stat")
+	}
+}
+
+func TestChunkEmbeddings(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	embedding := make([]float32, EmbeddingDim)
+	embedding[0], embedding[1] = 0.25, -1.5
+
+	doc := DocumentVersion{CollectionID: DefaultCollectionID, FilePath: "doc.md", Hash: "hash1", Model: "model-a"}
+	chunks := []Chunk{
+		{HeadingPath: "# A", HeadingLevel: 1, Content: "first", StartLine: 1, ContentHash: "h1"},
+		{HeadingPath: "# B", HeadingLevel: 1, Content: "second", StartLine: 5},
+	}
+	if _, err := store.ReplaceDocument(ctx, doc, chunks, [][]float32{embedding, embedding}); err != nil {
+		t.Fatalf("ReplaceDocument failed: %v", err)
+	}
+
+	got, err := store.ChunkEmbeddings(ctx, LegacySourceID, "doc.md", "model-a")
+	if err != nil {
+		t.Fatalf("ChunkEmbeddings failed: %v", err)
+	}
+	// Chunks without a content hash cannot be matched
+	if len(got) != 1 {
+		t.Fatalf("expected 1 embedding, got %d", len(got))
+	}
+	if e := got["h1"]; len(e) != EmbeddingDim || e[0] != 0.25 || e[1] != -1.5 {
+		t.Errorf("unexpected embedding: %v", e[:2])
+	}
+
+	got, err = store.ChunkEmbeddings(ctx, LegacySourceID, "doc.md", "model-b")
+	if err != nil {
+		t.Fatalf("ChunkEmbeddings failed: %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("expected no embeddings for another model, got %d", len(got))
+	}
+}
+
+func TestEmbeddingCache(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	embedding := make([]float32, EmbeddingDim)
+	embedding[0] = 0.5
+
+	chunks := []Chunk{
+		{HeadingPath: "# License", HeadingLevel: 1, Content: "MIT", StartLine: 1, ContentHash: "license"},
+		{HeadingPath: "# Other", HeadingLevel: 1, Content: "MIT", StartLine: 3, ContentHash: "license"},
+	}
+	for _, path := range []string{"a.md", "b.md"} {
+		doc := DocumentVersion{CollectionID: DefaultCollectionID, FilePath: path, Hash: "hash", Model: "model-a"}
+		if _, err := store.ReplaceDocument(ctx, doc, chunks, [][]float32{embedding, embedding}); err != nil {
+			t.Fatalf("ReplaceDocument failed: %v", err)
+		}
+	}
+
+	cached, err := store.CachedEmbeddings(ctx, "model-a", []string{"license", "unknown"})
+	if err != nil {
+		t.Fatalf("CachedEmbeddings failed: %v", err)
+	}
+	if len(cached) != 1 || cached["license"][0] != 0.5 {
+		t.Fatalf("unexpected cached embeddings: %v", cached)
+	}
+	if cached, _ := store.CachedEmbeddings(ctx, "model-b", []string{"license"}); len(cached) != 0 {
+		t.Errorf("expected no cached embeddings for another model, got %d", len(cached))
+	}
+
+	// Entries outlive the documents that produced them
+	if _, err := store.DeleteCollection(ctx, DefaultCollection); err != nil {
+		t.Fatalf("DeleteCollection failed: %v", err)
+	}
+	if cached, _ := store.CachedEmbeddings(ctx, "model-a", []string{"license"}); len(cached) != 1 {
+		t.Error("expected the cache to survive removing documents")
+	}
+
+	// Recently used entries are kept until they have been unused long enough
+	removed, remaining, err := store.PruneEmbeddingCache(ctx, time.Hour)
+	if err != nil {
+		t.Fatalf("PruneEmbeddingCache failed: %v", err)
+	}
+	if removed != 0 || remaining != 1 {
+		t.Errorf("expected recent entry to be kept, got %d removed, %d remaining", removed, remaining)
+	}
+	removed, remaining, err = store.PruneEmbeddingCache(ctx, 0)
+	if err != nil {
+		t.Fatalf("PruneEmbeddingCache failed: %v", err)
+	}
+	if removed != 1 || remaining != 0 {
+		t.Errorf("expected unused entry to be removed, got %d removed, %d remaining", removed, remaining)
+	}
+}
+
+func TestPruneEmbeddingCache_KeepsReferencedEntries(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	embedding := make([]float32, EmbeddingDim)
+	doc := DocumentVersion{CollectionID: DefaultCollectionID, FilePath: "a.md", Hash: "hash", Model: "model-a"}
+	chunks := []Chunk{{HeadingPath: "# A", HeadingLevel: 1, Content: "text", StartLine: 1, ContentHash: "h1"}}
+	if _, err := store.ReplaceDocument(ctx, doc, chunks, [][]float32{embedding}); err != nil {
+		t.Fatalf("ReplaceDocument failed: %v", err)
+	}
+
+	removed, remaining, err := store.PruneEmbeddingCache(ctx, 0)
+	if err != nil {
+		t.Fatalf("PruneEmbeddingCache failed: %v", err)
+	}
+	if removed != 0 || remaining != 1 {
+		t.Errorf("expected entry used by a document to be kept, got %d removed, %d remaining", removed, remaining)
+	}
+}
+
+func TestReplaceDocument_Metadata(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	embedding := make([]float32, EmbeddingDim)
+	embedding[0] = 1
+	chunks := []Chunk{{HeadingPath: "# A", HeadingLevel: 1, Content: "first", StartLine: 1}}
+
+	doc := DocumentVersion{
+		CollectionID: DefaultCollectionID, FilePath: "doc.md", Hash: "hash1", Title: "Doc",
+		Metadata: map[string]any{"owner": "alice", "tags": []any{"ops", "k8s"}},
+	}
+	if _, err := store.ReplaceDocument(ctx, doc, chunks, [][]float32{embedding}); err != nil {
+		t.Fatalf("ReplaceDocument failed: %v", err)
+	}
+
+	docs, err := store.ListDocuments(ctx)
+	if err != nil || len(docs) != 1 {
+		t.Fatalf("ListDocuments failed: %v (%d docs)", err, len(docs))
+	}
+	if docs[0].Metadata["owner"] != "alice" {
+		t.Errorf("unexpected document metadata: %v", docs[0].Metadata)
+	}
+	results, err := store.Search(ctx, embedding, 10)
+	if err != nil || len(results) != 1 {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if tags, ok := results[0].Metadata["tags"].([]any); !ok || len(tags) != 2 {
+		t.Errorf("unexpected result metadata: %v", results[0].Metadata)
+	}
+
+	// Removing the front matter clears the metadata
+	doc.Hash, doc.Metadata = "hash2", nil
+	if _, err := store.ReplaceDocument(ctx, doc, chunks, [][]float32{embedding}); err != nil {
+		t.Fatalf("ReplaceDocument failed: %v", err)
+	}
+	docs, _ = store.ListDocuments(ctx)
+	if docs[0].Metadata != nil {
+		t.Errorf("expected metadata to be cleared, got %v", docs[0].Metadata)
+	}
+}
+
+func TestReplaceDocument_RollsBackOnChunkError(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	embedding := make([]float32, EmbeddingDim)
+	chunk := Chunk{HeadingPath: "# A", HeadingLevel: 1, Content: "content", StartLine: 1}
+
+	doc := DocumentVersion{CollectionID: DefaultCollectionID, FilePath: "doc.md", Hash: "hash1", Title: "Doc"}
+	if _, err := store.ReplaceDocument(ctx, doc, []Chunk{chunk}, [][]float32{embedding}); err != nil {
+		t.Fatalf("ReplaceDocument failed: %v", err)
+	}
+
+	// An embedding of the wrong dimension fails inside the transaction
+	doc.Hash = "hash2"
+	if _, err := store.ReplaceDocument(ctx, doc, []Chunk{chunk}, [][]float32{{1, 2, 3}}); err == nil {
+		t.Fatal("expected error for invalid embedding")
+	}
+
+	if !store.FileUnchanged(ctx, "/doc.md", "hash1") {
+		t.Error("document should be rolled back to its previous hash")
+	}
+	results, err := store.Search(ctx, embedding, 10)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 1 {
+		t.Errorf("expected previous chunk to survive the rollback, got %d", len(results))
+	}
+}
+
+func TestReplaceDocument_Concurrent(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	embedding := make([]float32, EmbeddingDim)
+	embedding[0] = 1
+	chunks := []Chunk{{HeadingPath: "# A", HeadingLevel: 1, Content: "content", StartLine: 1}}
+
+	const numDocs = 20
+	errCh := make(chan error, numDocs)
+	for i := 0; i < numDocs; i++ {
+		go func(i int) {
+			doc := DocumentVersion{FilePath: fmt.Sprintf("/doc%d.md", i), Hash: "hash", Title: "Doc"}
+			_, err := store.ReplaceDocument(ctx, doc, chunks, [][]float32{embedding})
+			errCh <- err
+		}(i)
+	}
+	for i := 0; i < numDocs; i++ {
+		if err := <-errCh; err != nil {
+			t.Errorf("concurrent ReplaceDocument failed: %v", err)
+		}
+	}
+
+	docs, err := store.ListDocuments(ctx)
+	if err != nil {
+		t.Fatalf("ListDocuments failed: %v", err)
+	}
+	if len(docs) != numDocs {
+		t.Errorf("expected %d documents, got %d", numDocs, len(docs))
+	}
+}
+
+func TestReplaceDocument_ConcurrentSharedChunks(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	embedding := make([]float32, EmbeddingDim)
+	embedding[0] = 1
+	// Every file ends with the same section, like a license footer
+	license := Chunk{HeadingPath: "## License", HeadingLevel: 2, Content: "MIT", StartLine: 5, ContentHash: "license"}
+
+	const numDocs = 32
+	errCh := make(chan error, numDocs)
+	for i := 0; i < numDocs; i++ {
+		go func(i int) {
+			own := Chunk{HeadingPath: "# Doc", HeadingLevel: 1, Content: fmt.Sprintf("doc %d", i), StartLine: 1, ContentHash: fmt.Sprintf("doc%d", i)}
+			doc := DocumentVersion{FilePath: fmt.Sprintf("doc%d.md", i), Hash: "hash", Title: "Doc", Model: "embed.onnx@abc"}
+			_, err := store.ReplaceDocument(ctx, doc, []Chunk{own, license}, [][]float32{embedding, embedding})
+			errCh <- err
+		}(i)
+	}
+	for i := 0; i < numDocs; i++ {
+		if err := <-errCh; err != nil {
+			t.Errorf("concurrent ReplaceDocument failed: %v", err)
+		}
+	}
+
+	docs, _ := store.ListDocuments(ctx)
+	if len(docs) != numDocs {
+		t.Errorf("expected %d documents, got %d", numDocs, len(docs))
+	}
+	cached, err := store.CachedEmbeddings(ctx, "embed.onnx@abc", []string{"license", "doc0", "doc31"})
+	if err != nil {
+		t.Fatalf("CachedEmbeddings failed: %v", err)
+	}
+	if len(cached) != 3 {
+		t.Errorf("expected the shared and own chunks to be cached, got %d entries", len(cached))
+	}
+}
+
+func TestStats(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	empty, err := store.Stats(ctx, "", 256)
+	if err != nil {
+		t.Fatalf("Stats on empty database failed: %v", err)
+	}
+	if empty.Documents != 0 || empty.Chunks != 0 || !empty.LastIndexedAt.IsZero() {
+		t.Errorf("unexpected stats for empty database: %+v", empty)
+	}
+
+	embedding := make([]float32, EmbeddingDim)
+	doc := DocumentVersion{FilePath: "/a.md", Hash: "h", Title: "A", Model: "embed.onnx@abc"}
+	chunks := []Chunk{
+		{HeadingPath: "# A", HeadingLevel: 1, Content: "a", TokenCount: 10},
+		{HeadingPath: "# B", HeadingLevel: 1, Content: "b", TokenCount: 300},
+		{HeadingPath: "# C", HeadingLevel: 1, Content: "c", TokenCount: 50},
+	}
+	if _, err := store.ReplaceDocument(ctx, doc, chunks, [][]float32{embedding, embedding, nil}); err != nil {
+		t.Fatalf("ReplaceDocument failed: %v", err)
+	}
+
+	// A legacy document without a model or token counts, in another collection
+	otherID, _ := store.EnsureCollection(ctx, "other")
+	legacyID, _ := store.InsertDocumentInCollection(ctx, otherID, "/b.md", "h", "B")
+	store.InsertChunk(ctx, legacyID, Chunk{HeadingPath: "# B", HeadingLevel: 1, Content: "b"}, embedding)
+
+	// An empty document
+	store.InsertDocument(ctx, "/c.md", "h", "C")
+
+	stats, err := store.Stats(ctx, "", 256)
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+
+	if stats.Documents != 3 || stats.Chunks != 4 {
+		t.Errorf("expected 3 documents and 4 chunks, got %d and %d", stats.Documents, stats.Chunks)
+	}
+	if stats.MinChunks != 0 || stats.MaxChunks != 3 || stats.MedianChunks != 1 {
+		t.Errorf("unexpected distribution: min %d, median %d, max %d", stats.MinChunks, stats.MedianChunks, stats.MaxChunks)
+	}
+	if stats.TotalTokens != 360 || stats.MaxTokens != 300 {
+		t.Errorf("expected 360 total and 300 max tokens, got %d and %d", stats.TotalTokens, stats.MaxTokens)
+	}
+	if stats.TruncatedChunks != 1 {
+		t.Errorf("expected 1 truncated chunk, got %d", stats.TruncatedChunks)
+	}
+	if stats.UnknownTokenCount != 1 {
+		t.Errorf("expected 1 chunk without token count, got %d", stats.UnknownTokenCount)
+	}
+	if stats.NullEmbeddings != 1 {
+		t.Errorf("expected 1 NULL embedding, got %d", stats.NullEmbeddings)
+	}
+	if stats.LastIndexedAt.IsZero() {
+		t.Error("expected last indexed time")
+	}
+	if len(stats.Models) != 2 || stats.Models[0] != "" || stats.Models[1] != "embed.onnx@abc" {
+		t.Errorf("unexpected models: %q", stats.Models)
+	}
+
+	other, err := store.Stats(ctx, "other", 256)
+	if err != nil {
+		t.Fatalf("Stats for collection failed: %v", err)
+	}
+	if other.Documents != 1 || other.Chunks != 1 || other.TruncatedChunks != 0 {
+		t.Errorf("unexpected stats for collection: %+v", other)
+	}
+}
+
 // Benchmark tests
 
 func BenchmarkInsertDocument(b *testing.B) {
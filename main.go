@@ -31,6 +31,7 @@ markdown files using ONNX models and DuckDB. Includes a built-in MCP server.`,
 
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose debug logging")
 	rootCmd.PersistentFlags().StringVar(&cmd.OnnxLibraryPath, "onnx-lib", "", "Path to ONNX Runtime shared library")
+	rootCmd.PersistentFlags().StringVar(&cmd.DBPath, "db", "", "Path to the database file (default: $MCPMYDOCS_DB or ./mcpmydocs.db)")
 
 	versionCmd := &cobra.Command{
 		Use:   "version",
@@ -40,7 +41,7 @@ markdown files using ONNX models and DuckDB. Includes a built-in MCP server.`,
 		},
 	}
 
-	rootCmd.AddCommand(cmd.NewIndexCmd(), cmd.NewSearchCmd(), cmd.NewRunCmd(), versionCmd)
+	rootCmd.AddCommand(cmd.NewIndexCmd(), cmd.NewWatchCmd(), cmd.NewSearchCmd(), cmd.NewRunCmd(), cmd.NewCollectionsCmd(), cmd.NewStatsCmd(), cmd.NewDoctorCmd(), cmd.NewRelocateCmd(), cmd.NewReindexCmd(), cmd.NewSourcesCmd(), cmd.NewCacheCmd(), cmd.NewLinksCmd(), cmd.NewBacklinksCmd(), versionCmd)
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)